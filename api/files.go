@@ -0,0 +1,330 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type fileResponse struct {
+	Id          entities.FileId   `json:"id"`
+	Path        string            `json:"path"`
+	Fingerprint string            `json:"fingerprint"`
+	ModTime     time.Time         `json:"modTime"`
+	Size        int64             `json:"size"`
+	IsDir       bool              `json:"isDir"`
+	Tags        []fileTagResponse `json:"tags"`
+}
+
+type fileTagResponse struct {
+	Tag      string `json:"tag"`
+	Value    string `json:"value,omitempty"`
+	Explicit bool   `json:"explicit"`
+}
+
+type fileRequest struct {
+	Path string     `json:"path"`
+	Tags []tagValue `json:"tags"`
+}
+
+type fileTagsRequest struct {
+	Tags []tagValue `json:"tags"`
+}
+
+func (server *server) fileHandlers(path []string) map[string]handlerFunc {
+	switch {
+	case len(path) == 0:
+		return map[string]handlerFunc{http.MethodGet: server.listFiles, http.MethodPost: server.addFile}
+	case len(path) == 1:
+		return map[string]handlerFunc{http.MethodGet: server.getFile}
+	case len(path) == 2 && path[1] == "tags":
+		return map[string]handlerFunc{http.MethodPost: server.tagFile}
+	case len(path) == 3 && path[1] == "tags":
+		return map[string]handlerFunc{http.MethodDelete: server.untagFile}
+	}
+
+	return nil
+}
+
+// Lists the files, or those matching the query in the 'query' parameter.
+func (server *server) listFiles(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	parameters := request.URL.Query()
+
+	sort := parameters.Get("sort")
+	switch sort {
+	case "":
+		sort = "name"
+	case "id", "none", "name", "size", "time":
+	default:
+		return 0, nil, errorf(http.StatusBadRequest, "invalid sort '%v'", sort)
+	}
+
+	var files entities.Files
+	var err error
+	if queryText := parameters.Get("query"); queryText != "" {
+		expression, err := query.Parse(queryText)
+		if err != nil {
+			return 0, nil, errorf(http.StatusBadRequest, "could not parse query: %v", err)
+		}
+
+		explicitOnly := parameters.Get("explicit") == "true"
+		ignoreCase := parameters.Get("ignoreCase") == "true"
+
+		files, err = server.store.FilesForQuery(tx, expression, "", explicitOnly, ignoreCase, sort)
+		if err != nil {
+			return 0, nil, err
+		}
+	} else {
+		files, err = server.store.Files(tx, sort)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	start, end, page, err := paginate(request, len(files))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	names, err := server.names(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := make([]fileResponse, 0, end-start)
+	for _, file := range files[start:end] {
+		response, err := server.fileResponse(tx, names, file)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		items = append(items, response)
+	}
+	page.Items = items
+
+	return http.StatusOK, page, nil
+}
+
+// Adds the file at the path in the request to the database, applying any
+// tags given.
+func (server *server) addFile(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	var fileRequest fileRequest
+	if err := decodeRequest(request, &fileRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if !filepath.IsAbs(fileRequest.Path) {
+		return 0, nil, errorf(http.StatusBadRequest, "path '%v' is not absolute", fileRequest.Path)
+	}
+
+	filePath := filepath.Clean(fileRequest.Path)
+
+	file, err := server.store.FileByPath(tx, filePath)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	status := http.StatusOK
+	if file == nil {
+		file, err = server.addFileAt(tx, filePath)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		status = http.StatusCreated
+	}
+
+	if err := server.applyTags(tx, file.Id, fileRequest.Tags); err != nil {
+		return 0, nil, err
+	}
+
+	response, err := server.fileResponseById(tx, file.Id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return status, response, nil
+}
+
+func (server *server) getFile(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	fileId, err := parseFileId(path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	response, err := server.fileResponseById(tx, fileId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, response, nil
+}
+
+// Applies the tags in the request to the file.
+func (server *server) tagFile(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	fileId, err := parseFileId(path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var tagsRequest fileTagsRequest
+	if err := decodeRequest(request, &tagsRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := server.fileResponseById(tx, fileId); err != nil {
+		return 0, nil, err
+	}
+
+	if err := server.applyTags(tx, fileId, tagsRequest.Tags); err != nil {
+		return 0, nil, err
+	}
+
+	response, err := server.fileResponseById(tx, fileId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, response, nil
+}
+
+// Removes the tag, with the value in the 'value' parameter, from the file. The
+// storage removes the file from the database if it is left untagged.
+func (server *server) untagFile(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	fileId, err := parseFileId(path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	pair, err := server.tagValuePair(tx, tagValue{path[2], request.URL.Query().Get("value")}, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := server.store.DeleteFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func (server *server) applyTags(tx *storage.Tx, fileId entities.FileId, tagValues []tagValue) error {
+	for _, tagValue := range tagValues {
+		pair, err := server.tagValuePair(tx, tagValue, true)
+		if err != nil {
+			return err
+		}
+
+		if _, err := server.store.AddFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fingerprints the file at the path, according to the database settings, and
+// adds it to the database. Only files within the allowed paths can be added.
+func (server *server) addFileAt(tx *storage.Tx, path string) (*entities.File, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errorf(http.StatusBadRequest, "%v: no such file", path)
+		}
+
+		return nil, err
+	}
+
+	if !_path.Within(path, server.allowedPaths) {
+		return nil, errorf(http.StatusForbidden, "%v: not within the allowed paths", path)
+	}
+
+	settings, err := server.store.Settings(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := server.store.NewFingerprintCache(tx, settings.FileFingerprintAlgorithm())
+
+	fp, err := fingerprint.CreateWithCache(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), cache)
+	if err != nil {
+		return nil, errorf(http.StatusInternalServerError, "%v: could not create fingerprint: %v", path, err)
+	}
+
+	file, err := server.store.AddFile(tx, path, fp, settings.FileFingerprintAlgorithm(), stat.ModTime(), stat.Size(), stat.IsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	if imageAlgorithm := settings.ImageFingerprintAlgorithm(); imageAlgorithm != "none" && imageAlgorithm != "" {
+		if imageFp, err := fingerprint.CreateImage(path, imageAlgorithm); err == nil {
+			if err := server.store.UpdateImageFingerprint(tx, file.Id, imageAlgorithm, imageFp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return file, nil
+}
+
+func (server *server) fileResponseById(tx *storage.Tx, fileId entities.FileId) (fileResponse, error) {
+	file, err := server.store.File(tx, fileId)
+	if err != nil {
+		return fileResponse{}, err
+	}
+	if file == nil {
+		return fileResponse{}, errorf(http.StatusNotFound, "no such file #%v", fileId)
+	}
+
+	names, err := server.names(tx)
+	if err != nil {
+		return fileResponse{}, err
+	}
+
+	return server.fileResponse(tx, names, file)
+}
+
+func (server *server) fileResponse(tx *storage.Tx, names names, file *entities.File) (fileResponse, error) {
+	fileTags, err := server.store.FileTagsByFileId(tx, file.Id, false)
+	if err != nil {
+		return fileResponse{}, err
+	}
+
+	tags := make([]fileTagResponse, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tags = append(tags, fileTagResponse{names.tags[fileTag.TagId], names.values[fileTag.ValueId], fileTag.Explicit})
+	}
+
+	return fileResponse{file.Id, file.Path(), string(file.Fingerprint), file.ModTime, file.Size, file.IsDir, tags}, nil
+}
+
+func parseFileId(text string) (entities.FileId, error) {
+	id, err := strconv.ParseUint(text, 10, 32)
+	if err != nil || id == 0 {
+		return 0, errorf(http.StatusNotFound, "no such file '%v'", text)
+	}
+
+	return entities.FileId(id), nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"github.com/oniony/TMSU/storage"
+	"net/http"
+)
+
+type implicationMessage struct {
+	Implying tagValue `json:"implying"`
+	Implied  tagValue `json:"implied"`
+}
+
+func (server *server) implicationHandlers(path []string) map[string]handlerFunc {
+	if len(path) == 0 {
+		return map[string]handlerFunc{http.MethodGet: server.listImplications, http.MethodPost: server.addImplication, http.MethodDelete: server.deleteImplication}
+	}
+
+	return nil
+}
+
+func (server *server) listImplications(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	implications, err := server.store.Implications(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	start, end, page, err := paginate(request, len(implications))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := make([]implicationMessage, 0, end-start)
+	for _, implication := range implications[start:end] {
+		items = append(items, implicationMessage{tagValue{implication.ImplyingTag.Name, implication.ImplyingValue.Name},
+			tagValue{implication.ImpliedTag.Name, implication.ImpliedValue.Name}})
+	}
+	page.Items = items
+
+	return http.StatusOK, page, nil
+}
+
+func (server *server) addImplication(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	var implication implicationMessage
+	if err := decodeRequest(request, &implication); err != nil {
+		return 0, nil, err
+	}
+
+	implyingPair, err := server.tagValuePair(tx, implication.Implying, true)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	impliedPair, err := server.tagValuePair(tx, implication.Implied, true)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := server.store.AddImplication(tx, implyingPair, impliedPair); err != nil {
+		if storage.IsBusy(err) {
+			return 0, nil, err
+		}
+
+		// the implication already exists or would create a cycle
+		return 0, nil, errorf(http.StatusConflict, "%v", err)
+	}
+
+	return http.StatusCreated, implication, nil
+}
+
+// Deletes the implication described by the request body.
+func (server *server) deleteImplication(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	var implication implicationMessage
+	if err := decodeRequest(request, &implication); err != nil {
+		return 0, nil, err
+	}
+
+	implyingPair, err := server.tagValuePair(tx, implication.Implying, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	impliedPair, err := server.tagValuePair(tx, implication.Implied, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := server.store.DeleteImplication(tx, implyingPair, impliedPair); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
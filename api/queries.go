@@ -0,0 +1,84 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"net/http"
+)
+
+type queryMessage struct {
+	Text string `json:"text"`
+}
+
+func (server *server) queryHandlers(path []string) map[string]handlerFunc {
+	switch len(path) {
+	case 0:
+		return map[string]handlerFunc{http.MethodGet: server.listQueries, http.MethodPost: server.addQuery}
+	case 1:
+		return map[string]handlerFunc{http.MethodDelete: server.deleteQuery}
+	}
+
+	return nil
+}
+
+func (server *server) listQueries(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	queries, err := server.store.Queries(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	start, end, page, err := paginate(request, len(queries))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := make([]queryMessage, 0, end-start)
+	for _, query := range queries[start:end] {
+		items = append(items, queryMessage{query.Text})
+	}
+	page.Items = items
+
+	return http.StatusOK, page, nil
+}
+
+// Saves the query in the request body.
+func (server *server) addQuery(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	var queryRequest queryMessage
+	if err := decodeRequest(request, &queryRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := query.Parse(queryRequest.Text); err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "could not parse query: %v", err)
+	}
+
+	saved, err := server.store.AddQuery(tx, queryRequest.Text)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusCreated, queryMessage{saved.Text}, nil
+}
+
+func (server *server) deleteQuery(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	if err := server.store.DeleteQuery(tx, path[0]); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
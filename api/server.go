@@ -0,0 +1,315 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"hash/fnv"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPerPage = 100
+	maxPerPage     = 1000
+)
+
+// Creates an HTTP handler serving a REST API, with JSON responses, over the
+// database. Only files within the allowed paths, or the database root if none
+// are specified, can be added.
+func NewHandler(store *storage.Storage, readOnly bool, allowedPaths []string) http.Handler {
+	if len(allowedPaths) == 0 {
+		allowedPaths = []string{store.RootPath}
+	}
+
+	return &server{store, readOnly, allowedPaths}
+}
+
+// Wraps the handler so that only requests bearing the token, either as a
+// bearer token or as the password for basic authentication, are served.
+func Authenticate(token string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !hasToken(request, token) {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="tmsu"`)
+			writeError(writer, &httpError{http.StatusUnauthorized, "invalid or missing token"})
+			return
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// unexported
+
+type server struct {
+	store        *storage.Storage
+	readOnly     bool
+	allowedPaths []string
+}
+
+type handlerFunc func(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error)
+
+type httpError struct {
+	status  int
+	message string
+}
+
+func (err *httpError) Error() string {
+	return err.message
+}
+
+func errorf(status int, format string, values ...interface{}) error {
+	return &httpError{status, fmt.Sprintf(format, values...)}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type pageResponse struct {
+	Items   interface{} `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"perPage"`
+	Total   int         `json:"total"`
+}
+
+func (server *server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	log.Infof(2, "%v %v", request.Method, request.URL)
+
+	path, err := splitPath(request.URL.EscapedPath())
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	handler, err := server.route(request.Method, path)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	status, response, err := server.serve(handler, request, path)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	writeResponse(writer, request, status, response)
+}
+
+func (server *server) route(method string, path []string) (handlerFunc, error) {
+	if len(path) == 0 {
+		return nil, errorf(http.StatusNotFound, "no such resource")
+	}
+
+	var handlers map[string]handlerFunc
+	switch path[0] {
+	case "files":
+		handlers = server.fileHandlers(path[1:])
+	case "tags":
+		handlers = server.tagHandlers(path[1:])
+	case "values":
+		handlers = server.valueHandlers(path[1:])
+	case "implications":
+		handlers = server.implicationHandlers(path[1:])
+	case "queries":
+		handlers = server.queryHandlers(path[1:])
+	}
+
+	if handlers == nil {
+		return nil, errorf(http.StatusNotFound, "no such resource")
+	}
+
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	handler, ok := handlers[method]
+	if !ok {
+		return nil, errorf(http.StatusMethodNotAllowed, "method %v not allowed", method)
+	}
+
+	if server.readOnly && method != http.MethodGet {
+		return nil, errorf(http.StatusForbidden, "the database is being served read-only")
+	}
+
+	return handler, nil
+}
+
+// Runs the handler within a transaction, which is committed only if the
+// handler succeeds.
+func (server *server) serve(handler handlerFunc, request *http.Request, path []string) (int, interface{}, error) {
+	tx, err := server.store.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	status, response, err := handler(tx, request, path[1:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return status, response, nil
+}
+
+func splitPath(escapedPath string) ([]string, error) {
+	escapedPath = strings.Trim(escapedPath, "/")
+	if escapedPath == "" {
+		return []string{}, nil
+	}
+
+	path := strings.Split(escapedPath, "/")
+	for index, element := range path {
+		unescaped, err := url.PathUnescape(element)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid path: %v", err)
+		}
+
+		path[index] = unescaped
+	}
+
+	return path, nil
+}
+
+func hasToken(request *http.Request, token string) bool {
+	supplied := ""
+	if _, password, ok := request.BasicAuth(); ok {
+		supplied = password
+	} else if header := request.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		supplied = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	return supplied != "" && subtle.ConstantTimeCompare([]byte(supplied), []byte(token)) == 1
+}
+
+// Decodes the JSON request body into the target. Bodies of any other media type
+// are refused as browsers send these cross-site without asking the server first.
+func decodeRequest(request *http.Request, target interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return errorf(http.StatusUnsupportedMediaType, "request body must be of type application/json")
+	}
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(target); err != nil {
+		return errorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+
+	return nil
+}
+
+// Slices the items, of which there are count, to the page requested by the
+// 'page' and 'perPage' parameters.
+func paginate(request *http.Request, count int) (start, end int, response pageResponse, err error) {
+	response = pageResponse{Page: 1, PerPage: defaultPerPage, Total: count}
+
+	if text := request.URL.Query().Get("page"); text != "" {
+		response.Page, err = strconv.Atoi(text)
+		if err != nil || response.Page < 1 {
+			return 0, 0, response, errorf(http.StatusBadRequest, "invalid page '%v'", text)
+		}
+	}
+
+	if text := request.URL.Query().Get("perPage"); text != "" {
+		response.PerPage, err = strconv.Atoi(text)
+		if err != nil || response.PerPage < 1 || response.PerPage > maxPerPage {
+			return 0, 0, response, errorf(http.StatusBadRequest, "invalid page size '%v': must be between 1 and %v", text, maxPerPage)
+		}
+	}
+
+	start = (response.Page - 1) * response.PerPage
+	if start > count {
+		start = count
+	}
+
+	end = start + response.PerPage
+	if end > count {
+		end = count
+	}
+
+	return start, end, response, nil
+}
+
+func writeResponse(writer http.ResponseWriter, request *http.Request, status int, response interface{}) {
+	if status == http.StatusNoContent {
+		writer.WriteHeader(status)
+		return
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	body = append(body, '\n')
+
+	hash := fnv.New64a()
+	hash.Write(body)
+	etag := fmt.Sprintf(`"%x"`, hash.Sum64())
+
+	writer.Header().Set("ETag", etag)
+	writer.Header().Set("Content-Type", "application/json")
+
+	if status == http.StatusOK && request.Header.Get("If-None-Match") == etag {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writer.WriteHeader(status)
+	if request.Method != http.MethodHead {
+		writer.Write(body)
+	}
+}
+
+func writeError(writer http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case storage.IsNotFound(err):
+		status = http.StatusNotFound
+	case storage.IsConstraintViolation(err):
+		status = http.StatusConflict
+	case storage.IsBusy(err):
+		status = http.StatusServiceUnavailable
+	default:
+		if httpErr, ok := err.(*httpError); ok {
+			status = httpErr.status
+		}
+	}
+
+	if status == http.StatusInternalServerError {
+		log.Warnf("%v", err)
+	}
+
+	body, _ := json.Marshal(errorResponse{err.Error()})
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(append(body, '\n'))
+}
@@ -0,0 +1,299 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/oniony/TMSU/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagAndQueryFiles(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	handler := NewHandler(store, false, nil)
+	path := filepath.Join(dir, "photo.jpg")
+	if err := ioutil.WriteFile(path, []byte("photo"), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	response := serve(handler, "POST", "/files", `{"path": "`+path+`", "tags": [{"tag": "holiday"}, {"tag": "year", "value": "2017"}]}`, nil)
+	if response.Code != http.StatusCreated {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusCreated, response.Code, response.Body)
+	}
+
+	var file fileResponse
+	decode(test, response, &file)
+	if file.Path != path || len(file.Tags) != 2 {
+		test.Fatalf("Expected '%v' with two tags but was '%v' with %v.", path, file.Path, file.Tags)
+	}
+
+	response = serve(handler, "GET", "/files?query=year+>+2016", "", nil)
+	var page pageResponse
+	var files []fileResponse
+	page.Items = &files
+	decode(test, response, &page)
+	if page.Total != 1 || len(files) != 1 || files[0].Id != file.Id {
+		test.Fatalf("Expected one file matching the query but was %v.", response.Body)
+	}
+
+	response = serve(handler, "GET", "/files?query=year+<+2016", "", nil)
+	decode(test, response, &page)
+	if page.Total != 0 {
+		test.Fatalf("Expected no files matching the query but were %v.", page.Total)
+	}
+
+	response = serve(handler, "DELETE", "/files/1/tags/year?value=2017", "", nil)
+	if response.Code != http.StatusNoContent {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusNoContent, response.Code, response.Body)
+	}
+
+	response = serve(handler, "GET", "/files/1", "", nil)
+	decode(test, response, &file)
+	if len(file.Tags) != 1 || file.Tags[0].Tag != "holiday" {
+		test.Fatalf("Expected only 'holiday' to remain but was %v.", file.Tags)
+	}
+
+	response = serve(handler, "DELETE", "/files/1/tags/holiday", "", nil)
+	if response.Code != http.StatusNoContent {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusNoContent, response.Code, response.Body)
+	}
+
+	response = serve(handler, "GET", "/files/1", "", nil)
+	if response.Code != http.StatusNotFound {
+		test.Fatalf("Expected untagged file to be removed but status was %v.", response.Code)
+	}
+}
+
+func TestManageTags(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	handler := NewHandler(store, false, nil)
+
+	for _, name := range []string{"apple", "banana", "cherry"} {
+		if response := serve(handler, "POST", "/tags", `{"name": "`+name+`"}`, nil); response.Code != http.StatusCreated {
+			test.Fatalf("Expected status %v but was %v: %v", http.StatusCreated, response.Code, response.Body)
+		}
+	}
+
+	if response := serve(handler, "POST", "/tags", `{"name": "apple"}`, nil); response.Code != http.StatusConflict {
+		test.Fatalf("Expected status %v for a duplicate tag but was %v.", http.StatusConflict, response.Code)
+	}
+
+	if response := serve(handler, "PUT", "/tags/banana", `{"name": "blueberry"}`, nil); response.Code != http.StatusOK {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusOK, response.Code, response.Body)
+	}
+
+	if response := serve(handler, "DELETE", "/tags/cherry", "", nil); response.Code != http.StatusNoContent {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusNoContent, response.Code, response.Body)
+	}
+
+	response := serve(handler, "GET", "/tags?page=2&perPage=1", "", nil)
+	var page pageResponse
+	var tags []tagResponse
+	page.Items = &tags
+	decode(test, response, &page)
+	if page.Total != 2 || len(tags) != 1 || tags[0].Name != "blueberry" {
+		test.Fatalf("Expected the second of two tags to be 'blueberry' but was %v.", response.Body)
+	}
+
+	etag := response.Header().Get("ETag")
+	response = serve(handler, "GET", "/tags?page=2&perPage=1", "", map[string]string{"If-None-Match": etag})
+	if response.Code != http.StatusNotModified {
+		test.Fatalf("Expected status %v for a matching ETag but was %v.", http.StatusNotModified, response.Code)
+	}
+}
+
+func TestImplicationsAndQueries(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	handler := NewHandler(store, false, nil)
+
+	response := serve(handler, "POST", "/implications", `{"implying": {"tag": "mp3"}, "implied": {"tag": "music"}}`, nil)
+	if response.Code != http.StatusCreated {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusCreated, response.Code, response.Body)
+	}
+
+	response = serve(handler, "POST", "/implications", `{"implying": {"tag": "music"}, "implied": {"tag": "mp3"}}`, nil)
+	if response.Code != http.StatusConflict {
+		test.Fatalf("Expected status %v for a cyclic implication but was %v.", http.StatusConflict, response.Code)
+	}
+
+	response = serve(handler, "POST", "/queries", `{"text": "music and not mp3"}`, nil)
+	if response.Code != http.StatusCreated {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusCreated, response.Code, response.Body)
+	}
+
+	response = serve(handler, "POST", "/queries", `{"text": "music and"}`, nil)
+	if response.Code != http.StatusBadRequest {
+		test.Fatalf("Expected status %v for an invalid query but was %v.", http.StatusBadRequest, response.Code)
+	}
+
+	response = serve(handler, "DELETE", "/queries/music%20and%20not%20mp3", "", nil)
+	if response.Code != http.StatusNoContent {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusNoContent, response.Code, response.Body)
+	}
+
+	response = serve(handler, "DELETE", "/implications", `{"implying": {"tag": "mp3"}, "implied": {"tag": "music"}}`, nil)
+	if response.Code != http.StatusNoContent {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusNoContent, response.Code, response.Body)
+	}
+}
+
+func TestReadOnly(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	handler := NewHandler(store, true, nil)
+
+	if response := serve(handler, "POST", "/tags", `{"name": "apple"}`, nil); response.Code != http.StatusForbidden {
+		test.Fatalf("Expected status %v but was %v.", http.StatusForbidden, response.Code)
+	}
+
+	if response := serve(handler, "GET", "/tags", "", nil); response.Code != http.StatusOK {
+		test.Fatalf("Expected status %v but was %v.", http.StatusOK, response.Code)
+	}
+}
+
+func TestRefuseNonJsonBody(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	handler := NewHandler(store, false, nil)
+
+	response := serve(handler, "POST", "/tags", `{"name": "apple"}`, map[string]string{"Content-Type": "text/plain"})
+	if response.Code != http.StatusUnsupportedMediaType {
+		test.Fatalf("Expected status %v for a text body but was %v.", http.StatusUnsupportedMediaType, response.Code)
+	}
+
+	response = serve(handler, "POST", "/tags", `{"name": "apple"}`, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	if response.Code != http.StatusCreated {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusCreated, response.Code, response.Body)
+	}
+}
+
+func TestAddFileOutsideAllowedPaths(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	allowedPath := filepath.Join(dir, "allowed")
+	if err := os.Mkdir(allowedPath, 0700); err != nil {
+		test.Fatal(err)
+	}
+
+	handler := NewHandler(store, false, []string{allowedPath})
+
+	for _, path := range []string{filepath.Join(allowedPath, "photo.jpg"), filepath.Join(dir, "secret.txt")} {
+		if err := ioutil.WriteFile(path, []byte(path), 0600); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	response := serve(handler, "POST", "/files", `{"path": "`+filepath.Join(dir, "secret.txt")+`", "tags": [{"tag": "holiday"}]}`, nil)
+	if response.Code != http.StatusForbidden {
+		test.Fatalf("Expected status %v for a file outside the allowed paths but was %v.", http.StatusForbidden, response.Code)
+	}
+
+	response = serve(handler, "POST", "/files", `{"path": "`+filepath.Join(allowedPath, "photo.jpg")+`", "tags": [{"tag": "holiday"}]}`, nil)
+	if response.Code != http.StatusCreated {
+		test.Fatalf("Expected status %v but was %v: %v", http.StatusCreated, response.Code, response.Body)
+	}
+}
+
+func TestAuthenticate(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	handler := Authenticate("secret", NewHandler(store, false, nil))
+
+	if response := serve(handler, "GET", "/tags", "", nil); response.Code != http.StatusUnauthorized {
+		test.Fatalf("Expected status %v without a token but was %v.", http.StatusUnauthorized, response.Code)
+	}
+
+	if response := serve(handler, "GET", "/tags", "", map[string]string{"Authorization": "Bearer wrong"}); response.Code != http.StatusUnauthorized {
+		test.Fatalf("Expected status %v with the wrong token but was %v.", http.StatusUnauthorized, response.Code)
+	}
+
+	if response := serve(handler, "GET", "/tags", "", map[string]string{"Authorization": "Bearer secret"}); response.Code != http.StatusOK {
+		test.Fatalf("Expected status %v with a bearer token but was %v.", http.StatusOK, response.Code)
+	}
+
+	if response := serve(handler, "GET", "/tags", "", map[string]string{"Authorization": "Basic dXNlcjpzZWNyZXQ="}); response.Code != http.StatusOK {
+		test.Fatalf("Expected status %v with basic authentication but was %v.", http.StatusOK, response.Code)
+	}
+}
+
+// unexported
+
+func createStore(test *testing.T) (string, *storage.Storage) {
+	dir, err := ioutil.TempDir("", "tmsu-api")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "db")
+	if err := storage.CreateAt(path); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return dir, store
+}
+
+func serve(handler http.Handler, method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	return response
+}
+
+func decode(test *testing.T, response *httptest.ResponseRecorder, target interface{}) {
+	if response.Code != http.StatusOK && response.Code != http.StatusCreated {
+		test.Fatalf("Expected a successful response but status was %v: %v", response.Code, response.Body)
+	}
+
+	if err := json.Unmarshal(response.Body.Bytes(), target); err != nil {
+		test.Fatal(err)
+	}
+}
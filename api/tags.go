@@ -0,0 +1,393 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"net/http"
+)
+
+type tagValue struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value,omitempty"`
+}
+
+type tagResponse struct {
+	Name      string `json:"name"`
+	FileCount uint   `json:"fileCount"`
+}
+
+type valueResponse struct {
+	Name string `json:"name"`
+}
+
+type nameRequest struct {
+	Name string `json:"name"`
+}
+
+// The tag and value names by identifier.
+type names struct {
+	tags   map[entities.TagId]string
+	values map[entities.ValueId]string
+}
+
+func (server *server) tagHandlers(path []string) map[string]handlerFunc {
+	switch {
+	case len(path) == 0:
+		return map[string]handlerFunc{http.MethodGet: server.listTags, http.MethodPost: server.addTag}
+	case len(path) == 1:
+		return map[string]handlerFunc{http.MethodGet: server.getTag, http.MethodPut: server.renameTag, http.MethodDelete: server.deleteTag}
+	case len(path) == 2 && path[1] == "values":
+		return map[string]handlerFunc{http.MethodGet: server.listTagValues}
+	}
+
+	return nil
+}
+
+func (server *server) valueHandlers(path []string) map[string]handlerFunc {
+	switch len(path) {
+	case 0:
+		return map[string]handlerFunc{http.MethodGet: server.listValues, http.MethodPost: server.addValue}
+	case 1:
+		return map[string]handlerFunc{http.MethodGet: server.getValue, http.MethodPut: server.renameValue, http.MethodDelete: server.deleteValue}
+	}
+
+	return nil
+}
+
+func (server *server) listTags(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	tags, err := server.store.Tags(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	usages, err := server.store.TagUsage(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fileCounts := make(map[entities.TagId]uint, len(usages))
+	for _, usage := range usages {
+		fileCounts[usage.Id] = usage.FileCount
+	}
+
+	start, end, page, err := paginate(request, len(tags))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := make([]tagResponse, 0, end-start)
+	for _, tag := range tags[start:end] {
+		items = append(items, tagResponse{tag.Name, fileCounts[tag.Id]})
+	}
+	page.Items = items
+
+	return http.StatusOK, page, nil
+}
+
+func (server *server) addTag(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	var nameRequest nameRequest
+	if err := decodeRequest(request, &nameRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if err := entities.ValidateTagName(nameRequest.Name); err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	if existing, err := server.store.TagByName(tx, nameRequest.Name); err != nil {
+		return 0, nil, err
+	} else if existing != nil {
+		return 0, nil, errorf(http.StatusConflict, "tag '%v' already exists", nameRequest.Name)
+	}
+
+	tag, err := server.store.AddTag(tx, nameRequest.Name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusCreated, tagResponse{tag.Name, 0}, nil
+}
+
+func (server *server) getTag(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	tag, err := server.tag(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fileCount, err := server.store.FileTagCountByTagId(tx, tag.Id, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, tagResponse{tag.Name, fileCount}, nil
+}
+
+func (server *server) renameTag(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	tag, err := server.tag(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var nameRequest nameRequest
+	if err := decodeRequest(request, &nameRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if err := entities.ValidateTagName(nameRequest.Name); err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	if existing, err := server.store.TagByName(tx, nameRequest.Name); err != nil {
+		return 0, nil, err
+	} else if existing != nil {
+		return 0, nil, errorf(http.StatusConflict, "tag '%v' already exists", nameRequest.Name)
+	}
+
+	if _, err := server.store.RenameTag(tx, tag.Id, nameRequest.Name); err != nil {
+		return 0, nil, err
+	}
+
+	return server.getTag(tx, request, []string{nameRequest.Name})
+}
+
+// Deletes the tag, removing it from the files it was applied to.
+func (server *server) deleteTag(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	tag, err := server.tag(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := server.store.DeleteTag(tx, tag.Id); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func (server *server) listTagValues(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	tag, err := server.tag(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	values, err := server.store.ValuesByTag(tx, tag.Id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return valuesPage(request, values)
+}
+
+func (server *server) listValues(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	values, err := server.store.Values(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return valuesPage(request, values)
+}
+
+func (server *server) addValue(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	var nameRequest nameRequest
+	if err := decodeRequest(request, &nameRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if err := entities.ValidateValueName(nameRequest.Name); err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	if existing, err := server.store.ValueByName(tx, nameRequest.Name); err != nil {
+		return 0, nil, err
+	} else if existing != nil {
+		return 0, nil, errorf(http.StatusConflict, "value '%v' already exists", nameRequest.Name)
+	}
+
+	value, err := server.store.AddValue(tx, nameRequest.Name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusCreated, valueResponse{value.Name}, nil
+}
+
+func (server *server) getValue(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	value, err := server.value(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, valueResponse{value.Name}, nil
+}
+
+func (server *server) renameValue(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	value, err := server.value(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var nameRequest nameRequest
+	if err := decodeRequest(request, &nameRequest); err != nil {
+		return 0, nil, err
+	}
+
+	if err := entities.ValidateValueName(nameRequest.Name); err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	if existing, err := server.store.ValueByName(tx, nameRequest.Name); err != nil {
+		return 0, nil, err
+	} else if existing != nil {
+		return 0, nil, errorf(http.StatusConflict, "value '%v' already exists", nameRequest.Name)
+	}
+
+	renamed, err := server.store.RenameValue(tx, value.Id, nameRequest.Name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, valueResponse{renamed.Name}, nil
+}
+
+// Deletes the value, removing it from the files it was applied to.
+func (server *server) deleteValue(tx *storage.Tx, request *http.Request, path []string) (int, interface{}, error) {
+	value, err := server.value(tx, path[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := server.store.DeleteValue(tx, value.Id); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func valuesPage(request *http.Request, values entities.Values) (int, interface{}, error) {
+	start, end, page, err := paginate(request, len(values))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := make([]valueResponse, 0, end-start)
+	for _, value := range values[start:end] {
+		items = append(items, valueResponse{value.Name})
+	}
+	page.Items = items
+
+	return http.StatusOK, page, nil
+}
+
+func (server *server) tag(tx *storage.Tx, name string) (*entities.Tag, error) {
+	tag, err := server.store.TagByName(tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if tag == nil {
+		return nil, errorf(http.StatusNotFound, "no such tag '%v'", name)
+	}
+
+	return tag, nil
+}
+
+func (server *server) value(tx *storage.Tx, name string) (*entities.Value, error) {
+	value, err := server.store.ValueByName(tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil || value.Id == 0 {
+		return nil, errorf(http.StatusNotFound, "no such value '%v'", name)
+	}
+
+	return value, nil
+}
+
+// Resolves the tag and value names to their identifiers. If create is set
+// then missing tags and values are created where the database settings permit.
+func (server *server) tagValuePair(tx *storage.Tx, tagValue tagValue, create bool) (entities.TagIdValueIdPair, error) {
+	settings, err := server.store.Settings(tx)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+
+	tag, err := server.store.TagByName(tx, tagValue.Tag)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+	if tag == nil {
+		if !create || !settings.AutoCreateTags() {
+			return entities.TagIdValueIdPair{}, errorf(http.StatusNotFound, "no such tag '%v'", tagValue.Tag)
+		}
+
+		if err := entities.ValidateTagName(tagValue.Tag); err != nil {
+			return entities.TagIdValueIdPair{}, errorf(http.StatusBadRequest, "%v", err)
+		}
+
+		tag, err = server.store.AddTag(tx, tagValue.Tag)
+		if err != nil {
+			return entities.TagIdValueIdPair{}, err
+		}
+	}
+
+	if tagValue.Value == "" {
+		return entities.TagIdValueIdPair{tag.Id, 0}, nil
+	}
+
+	value, err := server.store.ValueByName(tx, tagValue.Value)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+	if value == nil {
+		if !create || !settings.AutoCreateValues() {
+			return entities.TagIdValueIdPair{}, errorf(http.StatusNotFound, "no such value '%v'", tagValue.Value)
+		}
+
+		if err := entities.ValidateValueName(tagValue.Value); err != nil {
+			return entities.TagIdValueIdPair{}, errorf(http.StatusBadRequest, "%v", err)
+		}
+
+		value, err = server.store.AddValue(tx, tagValue.Value)
+		if err != nil {
+			return entities.TagIdValueIdPair{}, err
+		}
+	}
+
+	return entities.TagIdValueIdPair{tag.Id, value.Id}, nil
+}
+
+func (server *server) names(tx *storage.Tx) (names, error) {
+	tags, err := server.store.Tags(tx)
+	if err != nil {
+		return names{}, err
+	}
+
+	values, err := server.store.Values(tx)
+	if err != nil {
+		return names{}, err
+	}
+
+	names := names{make(map[entities.TagId]string, len(tags)), make(map[entities.ValueId]string, len(values))}
+	for _, tag := range tags {
+		names.tags[tag.Id] = tag.Name
+	}
+	for _, value := range values {
+		names.values[value.Id] = value.Name
+	}
+
+	return names, nil
+}
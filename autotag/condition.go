@@ -0,0 +1,289 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package autotag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A condition against which a file's path or size is matched, of the form
+// 'FIELD OPERATOR ARGUMENT', e.g. 'extension in (mp3, flac)' or 'size > 1G'.
+type Condition struct {
+	Field    string
+	Operator string
+	Argument string
+
+	pattern *regexp.Regexp
+	values  []string
+	size    int64
+}
+
+// Parses the textual form of a condition.
+func ParseCondition(text string) (*Condition, error) {
+	text = strings.TrimSpace(text)
+
+	fieldEnd := strings.IndexFunc(text, func(char rune) bool { return !unicode.IsLetter(char) })
+	if fieldEnd == -1 {
+		return nil, fmt.Errorf("condition '%v' has no operator", text)
+	}
+	field := text[:fieldEnd]
+	remainder := strings.TrimLeftFunc(text[fieldEnd:], unicode.IsSpace)
+
+	var operatorEnd int
+	if strings.ContainsAny(remainder[:1], "=!<>") {
+		operatorEnd = strings.IndexFunc(remainder, func(char rune) bool { return !strings.ContainsRune("=!<>", char) })
+	} else {
+		operatorEnd = strings.IndexFunc(remainder, func(char rune) bool { return !unicode.IsLetter(char) })
+	}
+	switch operatorEnd {
+	case 0:
+		return nil, fmt.Errorf("condition '%v' has no operator", text)
+	case -1:
+		return nil, fmt.Errorf("condition '%v' has no argument", text)
+	}
+	operator := remainder[:operatorEnd]
+	argument := strings.TrimSpace(remainder[operatorEnd:])
+	if argument == "" {
+		return nil, fmt.Errorf("condition '%v' has no argument", text)
+	}
+
+	condition := Condition{Field: field, Operator: operator, Argument: argument}
+
+	var err error
+	switch field {
+	case "path", "name", "dirname", "extension":
+		err = condition.compileText()
+	case "size":
+		err = condition.compileSize()
+	default:
+		return nil, fmt.Errorf("unknown field '%v': must be one of path, name, dirname, extension or size", field)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &condition, nil
+}
+
+// The textual form of the condition.
+func (condition Condition) String() string {
+	return condition.Field + " " + condition.Operator + " " + condition.Argument
+}
+
+// Matches the condition against the file at the specified absolute path,
+// returning the matched text followed by any regular expression submatches,
+// or nil if the file does not match.
+func (condition Condition) Match(path string, stat os.FileInfo) []string {
+	if condition.Field == "size" {
+		if stat.IsDir() || !compare(stat.Size(), condition.size, condition.Operator) {
+			return nil
+		}
+
+		return []string{strconv.FormatInt(stat.Size(), 10)}
+	}
+
+	text := condition.fieldText(path)
+
+	switch condition.Operator {
+	case "glob", "regex":
+		return condition.pattern.FindStringSubmatch(text)
+	case "in", "=":
+		for _, value := range condition.values {
+			if text == value {
+				return []string{text}
+			}
+		}
+	case "!=":
+		if text != condition.values[0] {
+			return []string{text}
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+func (condition *Condition) compileText() error {
+	var err error
+
+	switch condition.Operator {
+	case "glob":
+		condition.pattern, err = regexp.Compile(globToRegexp(condition.Argument, condition.Field == "path"))
+	case "regex":
+		condition.pattern, err = regexp.Compile(condition.Argument)
+	case "in":
+		if !strings.HasPrefix(condition.Argument, "(") || !strings.HasSuffix(condition.Argument, ")") {
+			return fmt.Errorf("argument to 'in' must be a parenthesised list, e.g. (mp3, flac)")
+		}
+
+		for _, value := range strings.Split(condition.Argument[1:len(condition.Argument)-1], ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				condition.values = append(condition.values, condition.normalise(value))
+			}
+		}
+	case "=", "!=":
+		condition.values = []string{condition.normalise(condition.Argument)}
+	default:
+		return fmt.Errorf("operator '%v' cannot be used with field '%v'", condition.Operator, condition.Field)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid pattern '%v': %v", condition.Argument, err)
+	}
+
+	return nil
+}
+
+func (condition *Condition) compileSize() error {
+	switch condition.Operator {
+	case "=", "!=", "<", ">", "<=", ">=":
+	default:
+		return fmt.Errorf("operator '%v' cannot be used with field '%v'", condition.Operator, condition.Field)
+	}
+
+	size, err := parseSize(condition.Argument)
+	if err != nil {
+		return err
+	}
+	condition.size = size
+
+	return nil
+}
+
+func (condition Condition) fieldText(path string) string {
+	switch condition.Field {
+	case "name":
+		return filepath.Base(path)
+	case "dirname":
+		return filepath.Base(filepath.Dir(path))
+	case "extension":
+		return condition.normalise(strings.TrimPrefix(filepath.Ext(path), "."))
+	default:
+		return path
+	}
+}
+
+// Extensions are compared case-insensitively and without the leading dot.
+func (condition Condition) normalise(value string) string {
+	if condition.Field == "extension" {
+		return strings.ToLower(strings.TrimPrefix(value, "."))
+	}
+
+	return value
+}
+
+func compare(size, limit int64, operator string) bool {
+	switch operator {
+	case "=":
+		return size == limit
+	case "!=":
+		return size != limit
+	case "<":
+		return size < limit
+	case ">":
+		return size > limit
+	case "<=":
+		return size <= limit
+	case ">=":
+		return size >= limit
+	}
+
+	return false
+}
+
+// Parses a size such as '512', '10K' or '1.5G', the suffixes being powers of 1024.
+func parseSize(text string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.TrimSuffix(strings.ToUpper(text), "B")
+
+	if number != "" {
+		switch number[len(number)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier != 1 {
+			number = number[:len(number)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%v'", text)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// Converts a glob pattern to a regular expression. '**' matches across
+// directories whilst '*' and '?' do not. Relative path patterns may match any
+// trailing portion of the path.
+func globToRegexp(glob string, isPath bool) string {
+	var builder strings.Builder
+
+	builder.WriteString("^")
+	if isPath && !strings.HasPrefix(glob, "/") {
+		builder.WriteString("(?:.*/)?")
+	}
+
+	for index := 0; index < len(glob); index++ {
+		char := glob[index]
+
+		switch {
+		case strings.HasPrefix(glob[index:], "**/"):
+			builder.WriteString("(?:.*/)?")
+			index += 2
+		case strings.HasPrefix(glob[index:], "**"):
+			builder.WriteString(".*")
+			index++
+		case char == '*':
+			builder.WriteString("[^/]*")
+		case char == '?':
+			builder.WriteString("[^/]")
+		case char == '[':
+			end := strings.IndexByte(glob[index+1:], ']')
+			if end == -1 {
+				builder.WriteString(`\[`)
+				continue
+			}
+
+			class := glob[index+1 : index+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			index += end + 1
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	builder.WriteString("$")
+
+	return builder.String()
+}
@@ -0,0 +1,151 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package autotag
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGlobCondition(test *testing.T) {
+	condition := parse("path glob **/*.raw", test)
+
+	validateMatch(condition, "/photos/2017/img001.raw", 0, []string{"/photos/2017/img001.raw"}, test)
+	validateMatch(condition, "/img001.raw", 0, []string{"/img001.raw"}, test)
+	validateMatch(condition, "/photos/img001.raw.jpg", 0, nil, test)
+
+	condition = parse("path glob photos/*.jpg", test)
+
+	validateMatch(condition, "/home/bob/photos/a.jpg", 0, []string{"/home/bob/photos/a.jpg"}, test)
+	validateMatch(condition, "/home/bob/photos/2017/a.jpg", 0, nil, test)
+	validateMatch(condition, "/home/bob/myphotos/a.jpg", 0, nil, test)
+
+	condition = parse("name glob img??[0-9].*", test)
+
+	validateMatch(condition, "/photos/img001.raw", 0, []string{"img001.raw"}, test)
+	validateMatch(condition, "/photos/img01a.raw", 0, nil, test)
+}
+
+func TestRegexCondition(test *testing.T) {
+	condition := parse(`dirname regex ^(\d{4})`, test)
+
+	validateMatch(condition, "/photos/2017-summer/a.jpg", 0, []string{"2017", "2017"}, test)
+	validateMatch(condition, "/photos/summer/a.jpg", 0, nil, test)
+}
+
+func TestInCondition(test *testing.T) {
+	condition := parse("extension in (mp3, .FLAC)", test)
+
+	validateMatch(condition, "/music/song.mp3", 0, []string{"mp3"}, test)
+	validateMatch(condition, "/music/song.Flac", 0, []string{"flac"}, test)
+	validateMatch(condition, "/music/song.ogg", 0, nil, test)
+	validateMatch(condition, "/music/mp3", 0, nil, test)
+}
+
+func TestEqualityCondition(test *testing.T) {
+	condition := parse("name=README", test)
+
+	validateMatch(condition, "/src/README", 0, []string{"README"}, test)
+	validateMatch(condition, "/src/README.md", 0, nil, test)
+
+	condition = parse("extension != txt", test)
+
+	validateMatch(condition, "/src/README.md", 0, []string{"md"}, test)
+	validateMatch(condition, "/src/notes.TXT", 0, nil, test)
+}
+
+func TestSizeCondition(test *testing.T) {
+	condition := parse("size > 1G", test)
+
+	validateMatch(condition, "/films/big.mkv", 2<<30, []string{"2147483648"}, test)
+	validateMatch(condition, "/films/small.mkv", 1<<30, nil, test)
+
+	condition = parse("size<=1.5k", test)
+
+	validateMatch(condition, "/notes.txt", 1536, []string{"1536"}, test)
+	validateMatch(condition, "/notes.txt", 1537, nil, test)
+}
+
+func TestInvalidConditions(test *testing.T) {
+	for _, text := range []string{"path", "colour = red", "path ~ x", "size glob *", "size > lots", "extension in mp3", "path regex (", "size >"} {
+		if _, err := ParseCondition(text); err == nil {
+			test.Errorf("expected condition '%v' to be rejected", text)
+		}
+	}
+}
+
+func TestRuleApply(test *testing.T) {
+	rule, err := NewRule(entities.Rule{1, `dirname regex ^(\d{4})-(\w+)`, `year=$1 season=${2} "summer holiday"`})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagArgs := rule.Apply("/photos/2017-summer/a.jpg", fileInfo{"a.jpg", 0})
+	expected := []string{"year=2017", "season=summer", "summer holiday"}
+	if !reflect.DeepEqual(tagArgs, expected) {
+		test.Fatalf("expected tags %v but were %v", expected, tagArgs)
+	}
+
+	if tagArgs := rule.Apply("/photos/misc/a.jpg", fileInfo{"a.jpg", 0}); tagArgs != nil {
+		test.Fatalf("expected no tags but were %v", tagArgs)
+	}
+}
+
+func TestFormatTags(test *testing.T) {
+	tagArgs := []string{"raw", "summer holiday", `it's`, `back\slash`}
+
+	rule, err := NewRule(entities.Rule{1, "path glob *", FormatTags(tagArgs)})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rule.Tags, tagArgs) {
+		test.Fatalf("expected tags %v but were %v", tagArgs, rule.Tags)
+	}
+}
+
+// unexported
+
+type fileInfo struct {
+	name string
+	size int64
+}
+
+func (info fileInfo) Name() string       { return info.name }
+func (info fileInfo) Size() int64        { return info.size }
+func (info fileInfo) Mode() os.FileMode  { return 0 }
+func (info fileInfo) ModTime() time.Time { return time.Time{} }
+func (info fileInfo) IsDir() bool        { return false }
+func (info fileInfo) Sys() interface{}   { return nil }
+
+func parse(text string, test *testing.T) *Condition {
+	condition, err := ParseCondition(text)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return condition
+}
+
+func validateMatch(condition *Condition, path string, size int64, expected []string, test *testing.T) {
+	groups := condition.Match(path, fileInfo{path, size})
+	if !reflect.DeepEqual(groups, expected) {
+		test.Errorf("%v: expected '%v' to give %v but gave %v", condition, path, expected, groups)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package autotag
+
+import (
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A parsed automatic tagging rule.
+type Rule struct {
+	Id        entities.RuleId
+	Condition *Condition
+	Tags      []string
+}
+
+// Parses the stored form of a rule.
+func NewRule(rule entities.Rule) (*Rule, error) {
+	condition, err := ParseCondition(rule.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rule{rule.Id, condition, text.Tokenize(rule.Tags)}, nil
+}
+
+// Determines the tags the rule applies to the file at the specified path,
+// if any. References such as '$1' in the tags are replaced with the
+// corresponding submatches of the condition.
+func (rule Rule) Apply(path string, stat os.FileInfo) []string {
+	groups := rule.Condition.Match(path, stat)
+	if groups == nil {
+		return nil
+	}
+
+	tagArgs := make([]string, len(rule.Tags))
+	for index, tagArg := range rule.Tags {
+		tagArgs[index] = os.Expand(tagArg, func(name string) string {
+			number, err := strconv.Atoi(name)
+			if err != nil || number < 0 || number >= len(groups) {
+				return ""
+			}
+
+			return groups[number]
+		})
+	}
+
+	return tagArgs
+}
+
+// Formats tag arguments for storage such that they can be tokenized again.
+func FormatTags(tagArgs []string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, ` `, `\ `, "\t", "\\\t", `"`, `\"`, `'`, `\'`)
+
+	escaped := make([]string, len(tagArgs))
+	for index, tagArg := range tagArgs {
+		escaped[index] = escaper.Replace(tagArg)
+	}
+
+	return strings.Join(escaped, " ")
+}
@@ -0,0 +1,373 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/autotag"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var AutotagCommand = Command{
+	Name:     "autotag",
+	Synopsis: "Apply tags automatically using rules",
+	Usages: []string{"tmsu autotag [OPTION]... [PATH]...",
+		"tmsu autotag --add=CONDITION TAG[=VALUE]...",
+		"tmsu autotag --list",
+		"tmsu autotag --delete ID..."},
+	Description: `Applies tags to files according to the automatic tagging rules stored in the database. Each rule has a CONDITION and the tags to apply to the files that match it.
+
+The rules are also applied whenever the 'tag' subcommand adds a file to the database. This subcommand applies them retrospectively: to the files under each PATH, recursively, or to every file in the database if no PATH is specified. Hidden files and directories are skipped unless specified explicitly.
+
+A CONDITION has the form 'FIELD OPERATOR ARGUMENT' where FIELD is one of:
+
+  path        the absolute path of the file
+  name        the file name
+  dirname     the name of the directory containing the file
+  extension   the file extension, without the dot and compared case-insensitively
+  size        the file size, which may be suffixed with K, M, G or T
+
+The path, name, dirname and extension fields support the operators 'glob', 'regex', 'in', '=' and '!='. In a glob, '*' and '?' do not match '/' whilst '**' does, and a relative path pattern can match any trailing portion of the path. The argument to 'in' is a parenthesised, comma-separated list. The size field supports '=', '!=', '<', '>', '<=' and '>='.
+
+The tags may refer to the text matched by the condition as '$0' and to the groups of a regular expression as '$1', '$2', etc.`,
+	Examples: []string{`$ tmsu autotag --add='path glob **/*.raw' raw photo`,
+		`$ tmsu autotag --add='extension in (mp3, flac)' audio`,
+		`$ tmsu autotag --add='size > 1G' large`,
+		`$ tmsu autotag --add='dirname regex ^(\d{4})' 'year=$1'`,
+		`$ tmsu autotag --list
+1: path glob **/*.raw -> raw photo
+2: extension in (mp3, flac) -> audio
+3: size > 1G -> large
+4: dirname regex ^(\d{4}) -> year=$1`,
+		`$ tmsu autotag --pretend photos
+photos/2017/img001.raw: raw photo year=2017`,
+		`$ tmsu autotag --delete 3`},
+	Options: Options{Option{"--add", "-a", "adds a rule with the specified condition", true, false, ""},
+		Option{"--list", "-l", "lists the rules", false, false, ""},
+		Option{"--delete", "-d", "deletes the rules with the specified IDs", false, false, ""},
+		Option{"--pretend", "-P", "lists the tags that would be applied without applying them", false, false, ""}},
+	Exec: autotagExec,
+}
+
+// unexported
+
+type ruleRecord struct {
+	Id        entities.RuleId `json:"id"`
+	Condition string          `json:"condition"`
+	Tags      []string        `json:"tags"`
+}
+
+type autoTagger struct {
+	store    *storage.Storage
+	tx       *storage.Tx
+	settings entities.Settings
+	rules    []*autotag.Rule
+}
+
+func autotagExec(options Options, args []string, databasePath string) (error, warnings) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	switch {
+	case options.HasOption("--add"):
+		if len(args) == 0 {
+			return fmt.Errorf("tags to apply must be specified"), nil
+		}
+
+		return addRule(store, tx, options.Get("--add").Argument, args), nil
+	case options.HasOption("--list"):
+		if len(args) != 0 {
+			return fmt.Errorf("too many arguments"), nil
+		}
+
+		format, err := outputFormatFor(options)
+		if err != nil {
+			return err, nil
+		}
+
+		return listRules(store, tx, format), nil
+	case options.HasOption("--delete"):
+		if len(args) == 0 {
+			return fmt.Errorf("too few arguments"), nil
+		}
+
+		return deleteRules(store, tx, args)
+	default:
+		return autotagPaths(store, tx, args, options.HasOption("--pretend"))
+	}
+}
+
+func addRule(store *storage.Storage, tx *storage.Tx, conditionText string, tagArgs []string) error {
+	condition, err := autotag.ParseCondition(conditionText)
+	if err != nil {
+		return err
+	}
+
+	for _, tagArg := range tagArgs {
+		tagName, _ := parseTagEqValueName(tagArg)
+		if tagName == "" {
+			return fmt.Errorf("tag name cannot be empty")
+		}
+	}
+
+	log.Infof(2, "adding rule '%v'", condition)
+
+	if _, err := store.AddRule(tx, condition.String(), autotag.FormatTags(tagArgs)); err != nil {
+		return fmt.Errorf("could not add rule: %v", err)
+	}
+
+	return nil
+}
+
+func listRules(store *storage.Storage, tx *storage.Tx, format *outputFormat) error {
+	log.Infof(2, "retrieving rules")
+
+	rules, err := store.Rules(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve rules: %v", err)
+	}
+
+	records := make([]ruleRecord, 0, len(rules))
+	for _, rule := range rules {
+		parsed, err := autotag.NewRule(*rule)
+		if err != nil {
+			return fmt.Errorf("rule #%v: %v", rule.Id, err)
+		}
+
+		records = append(records, ruleRecord{rule.Id, rule.Condition, parsed.Tags})
+	}
+
+	if format != nil {
+		return format.print(records)
+	}
+
+	for _, record := range records {
+		fmt.Printf("%v: %v -> %v\n", record.Id, record.Condition, autotag.FormatTags(record.Tags))
+	}
+
+	return nil
+}
+
+func deleteRules(store *storage.Storage, tx *storage.Tx, ruleIds []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, text := range ruleIds {
+		ruleId, err := strconv.ParseUint(text, 10, 0)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("invalid rule ID '%v'", text))
+			continue
+		}
+
+		log.Infof(2, "deleting rule #%v", ruleId)
+
+		if err := store.DeleteRule(tx, entities.RuleId(ruleId)); err != nil {
+			if storage.IsNotFound(err) {
+				warnings = append(warnings, fmt.Sprintf("no such rule #%v", ruleId))
+				continue
+			}
+
+			return fmt.Errorf("could not delete rule #%v: %v", ruleId, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+func autotagPaths(store *storage.Storage, tx *storage.Tx, paths []string, pretend bool) (error, warnings) {
+	log.Infof(2, "loading settings")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	tagger, err := newAutoTagger(store, tx, settings)
+	if err != nil {
+		return err, nil
+	}
+	if len(tagger.rules) == 0 {
+		return fmt.Errorf("no rules have been added"), nil
+	}
+
+	tagsFor := func(path string, stat os.FileInfo) ([]string, error) {
+		return tagger.tagsFor(path, stat), nil
+	}
+
+	return sweep(store, tx, settings, paths, true, false, false, pretend, tagsFor, nil)
+}
+
+// Applies the tags that tagsFor derives for each file under the paths or, if
+// no paths are specified, for each file in the database. Files newly added to
+// the database are also given the tags of the automatic tagger, if specified.
+func sweep(store *storage.Storage, tx *storage.Tx, settings entities.Settings, paths []string, recursive, includeHidden, explicit, pretend bool, tagsFor func(string, os.FileInfo) ([]string, error), autoTagger *autoTagger) (error, warnings) {
+	fingerprinter := newFingerprinter(store, tx, settings)
+	fingerprinter.useStored()
+
+	warnings := make(warnings, 0, 10)
+
+	apply := func(path string, stat os.FileInfo) error {
+		tagArgs, err := tagsFor(path, stat)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: %v", _path.Rel(path), err))
+			return nil
+		}
+		if len(tagArgs) == 0 {
+			return nil
+		}
+
+		if pretend {
+			fmt.Printf("%v: %v\n", _path.Rel(path), autotag.FormatTags(tagArgs))
+			return nil
+		}
+
+		pairs, err := parseDerivedTagValuePairs(store, tx, settings, tagArgs)
+		if err != nil {
+			return err
+		}
+
+		return tagPath(store, tx, path, pairs, explicit, false, false, false, false, fingerprinter, settings.ReportDuplicates(), autoTagger)
+	}
+
+	if len(paths) == 0 {
+		log.Infof(2, "retrieving all files from the database")
+
+		files, err := store.Files(tx, "name")
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err), nil
+		}
+
+		for _, file := range files {
+			stat, err := os.Lstat(file.Path())
+			if err != nil {
+				log.Infof(2, "%v: skipping inaccessible file: %v", file.Path(), err)
+				continue
+			}
+
+			if err := apply(file.Path(), stat); err != nil {
+				return err, warnings
+			}
+		}
+
+		return nil, warnings
+	}
+
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err), warnings
+		}
+
+		err = filepath.Walk(absPath, func(walkPath string, stat os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if walkPath != absPath && strings.HasPrefix(stat.Name(), ".") && !includeHidden {
+				log.Infof(2, "%v: skipping hidden file/directory", walkPath)
+
+				if stat.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if err := apply(walkPath, stat); err != nil {
+				return err
+			}
+
+			if stat.IsDir() && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			switch {
+			case os.IsPermission(err):
+				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+			case os.IsNotExist(err):
+				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+			default:
+				return err, warnings
+			}
+		}
+	}
+
+	return nil, warnings
+}
+
+func newAutoTagger(store *storage.Storage, tx *storage.Tx, settings entities.Settings) (*autoTagger, error) {
+	log.Infof(2, "loading automatic tagging rules")
+
+	storedRules, err := store.Rules(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve rules: %v", err)
+	}
+
+	rules := make([]*autotag.Rule, len(storedRules))
+	for index, storedRule := range storedRules {
+		rules[index], err = autotag.NewRule(*storedRule)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%v: %v", storedRule.Id, err)
+		}
+	}
+
+	return &autoTagger{store, tx, settings, rules}, nil
+}
+
+// The tags the rules apply to the specified path.
+func (tagger *autoTagger) tagsFor(path string, stat os.FileInfo) []string {
+	tagArgs := make([]string, 0, 10)
+
+	for _, rule := range tagger.rules {
+		for _, tagArg := range rule.Apply(path, stat) {
+			tagName, _ := parseTagEqValueName(tagArg)
+			if tagName == "" {
+				log.Warnf("%v: rule #%v gives an empty tag name", path, rule.Id)
+				continue
+			}
+
+			tagArgs = append(tagArgs, tagArg)
+		}
+	}
+
+	return tagArgs
+}
+
+// Parses tag arguments derived from files, logging those skipped because the
+// tag or value does not exist.
+func parseDerivedTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entities.Settings, tagArgs []string) (entities.TagIdValueIdPairs, error) {
+	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, nil)
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+
+	return pairs, err
+}
@@ -0,0 +1,166 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"strings"
+)
+
+var BatchCommand = Command{
+	Name:     "batch",
+	Synopsis: "Run a script of subcommands in one transaction",
+	Usages:   []string{"tmsu batch [OPTION]... [FILE]"},
+	Description: `Runs the subcommands listed in FILE, one per line and without the 'tmsu' prefix, within a single transaction so that either all of the changes are made or, should a subcommand fail, none are. If FILE is '-' or omitted then the subcommands are read from standard input.
+
+Blank lines and lines starting with '#' are ignored. Arguments are quoted and escaped as in the shell. The 'batch', 'mount', 'serve' and 'shell' subcommands cannot be run in a batch.
+
+With --continue-on-error, the changes of a failed subcommand are undone but the batch carries on and the changes of the remaining subcommands are kept. With --pretend, the subcommands are run but all changes are undone at the end.
+
+A summary of the subcommands run and failed is printed once the batch is complete.`,
+	Examples: []string{"$ cat tagging.txt\ntag song.mp3 music mp3 year=2017\nimply mp3 music\nuntag old.mp3 music\n$ tmsu batch tagging.txt\n3 subcommands run, 0 failed: changes committed",
+		"$ find . -name '*.mp3' -printf 'tag \"%p\" mp3\\n' | tmsu batch --pretend"},
+	Options: Options{Option{"--continue-on-error", "-k", "skip subcommands that fail rather than abandoning the batch", false, false, ""},
+		Option{"--pretend", "-P", "undo all changes once the batch is complete", false, false, ""}},
+	Exec: batchExec,
+}
+
+// unexported
+
+var batchExcludedCommands = []string{"batch", "mount", "serve", "shell"}
+
+func batchExec(options Options, args []string, databasePath string) (error, warnings) {
+	continueOnError := options.HasOption("--continue-on-error")
+	pretend := options.HasOption("--pretend")
+
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+	if sharedStore != nil {
+		return fmt.Errorf("cannot run a batch within a shell or batch"), nil
+	}
+
+	var reader io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("could not open batch file: %v", err), nil
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Rollback()
+
+	run, failures, err := runBatch(store, tx, reader, databasePath, continueOnError)
+	if err != nil {
+		fmt.Printf("%v subcommands run, %v failed: changes rolled back\n", run, len(failures)+1)
+		return err, failures
+	}
+
+	if pretend {
+		fmt.Printf("%v subcommands run, %v failed: changes rolled back\n", run, len(failures))
+		return nil, failures
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %v", err), failures
+	}
+
+	fmt.Printf("%v subcommands run, %v failed: changes committed\n", run, len(failures))
+
+	return nil, failures
+}
+
+// Runs the subcommands read from reader, each within its own transaction
+// nested within tx, returning the number run and the failures skipped. An error
+// is returned for the first failure unless continueOnError is set.
+func runBatch(store *storage.Storage, tx *storage.Tx, reader io.Reader, databasePath string, continueOnError bool) (int, warnings, error) {
+	sharedStore = store.Nest(tx)
+	defer func() { sharedStore = nil }()
+
+	failures := make(warnings, 0, 10)
+	run := 0
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		log.Infof(2, "line %v: %v", lineNumber, line)
+
+		commandTx, err := tx.Nest()
+		if err != nil {
+			return run, failures, err
+		}
+		sharedStore = store.Nest(commandTx)
+
+		err, warnings := runSubcommand(text.Tokenize(line), databasePath, batchExcludedCommands...)
+		run++
+
+		// a subcommand that reports warnings has failed, as it would exit
+		// with an error status if run alone
+		if err == nil && len(warnings) > 0 {
+			err = fmt.Errorf("%v", strings.Join(warnings, "; "))
+		} else {
+			for _, warning := range warnings {
+				log.Warnf("line %v: %v", lineNumber, warning)
+			}
+		}
+
+		if err != nil {
+			commandTx.Rollback()
+
+			if _, interrupted := err.(InterruptedError); interrupted || !continueOnError {
+				return run, failures, fmt.Errorf("line %v: %v", lineNumber, err)
+			}
+
+			failures = append(failures, fmt.Sprintf("line %v: %v", lineNumber, err))
+			continue
+		}
+
+		if err := commandTx.Commit(); err != nil {
+			return run, failures, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return run, failures, fmt.Errorf("could not read batch: %v", err)
+	}
+
+	return run, failures, nil
+}
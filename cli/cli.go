@@ -26,6 +26,7 @@ import (
 
 func Run() {
 	helpCommands = commands
+	shellCommands = commands
 
 	parser := NewOptionParser(globalOptions, commands)
 	command, options, arguments, err := parser.Parse(os.Args[1:]...)
@@ -76,11 +77,12 @@ func Run() {
 
 // unexported
 
-var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, ""},
-	Option{"--help", "-h", "show help and exit", false, ""},
-	Option{"--version", "-V", "show version information and exit", false, ""},
-	Option{"--database", "-D", "use the specified database", true, ""},
-	Option{"--color", "", "colorize the output (auto/always/never)", true, ""},
+var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, false, ""},
+	Option{"--help", "-h", "show help and exit", false, false, ""},
+	Option{"--version", "-V", "show version information and exit", false, false, ""},
+	Option{"--database", "-D", "use the specified database", true, false, ""},
+	Option{"--color", "", "colorize the output (auto/always/never)", true, false, ""},
+	Option{"--format", "", "format the output: text, json, csv, tsv or a template", true, false, ""},
 }
 
 func findDatabase() (string, error) {
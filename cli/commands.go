@@ -20,6 +20,8 @@ package cli
 // unexported
 
 var commands = []*Command{
+	&AutotagCommand,
+	&BatchCommand,
 	&ConfigCommand,
 	&CopyCommand,
 	&DeleteCommand,
@@ -27,12 +29,15 @@ var commands = []*Command{
 	&FilesCommand,
 	&HelpCommand,
 	&ImplyCommand,
+	&ImportMetadataCommand,
 	&InfoCommand,
 	&InitCommand,
 	&MergeCommand,
 	&MountCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&ServeCommand,
+	&ShellCommand,
 	&StatusCommand,
 	&TagCommand,
 	&TagsCommand,
@@ -41,4 +46,5 @@ var commands = []*Command{
 	&UntaggedCommand,
 	&ValuesCommand,
 	&VersionCommand,
-	&VfsCommand}
+	&VfsCommand,
+	&XattrCommand}
@@ -20,6 +20,8 @@ package cli
 // unexported
 
 var commands = []*Command{
+	&AutotagCommand,
+	&BatchCommand,
 	&ConfigCommand,
 	&CopyCommand,
 	&DeleteCommand,
@@ -27,15 +29,19 @@ var commands = []*Command{
 	&FilesCommand,
 	&HelpCommand,
 	&ImplyCommand,
+	&ImportMetadataCommand,
 	&InfoCommand,
 	&InitCommand,
 	&MergeCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&ServeCommand,
+	&ShellCommand,
 	&StatusCommand,
 	&TagCommand,
 	&TagsCommand,
 	&UntagCommand,
 	&UntaggedCommand,
 	&ValuesCommand,
-	&VersionCommand}
+	&VersionCommand,
+	&XattrCommand}
@@ -31,7 +31,14 @@ import (
 
 // unexported
 
+// The database kept open by the 'shell' subcommand for its subcommands to use.
+var sharedStore *storage.Storage
+
 func openDatabase(path string) (*storage.Storage, error) {
+	if sharedStore != nil && sharedStore.DbPath == path {
+		return sharedStore.Borrow(), nil
+	}
+
 	storage, err := storage.OpenAt(path)
 	if err != nil {
 		switch err.(type) {
@@ -47,6 +54,17 @@ func openDatabase(path string) (*storage.Storage, error) {
 	return storage, nil
 }
 
+// Commits the transaction unless the command was interrupted, in which case the
+// transaction is rolled back so that no partial changes are made.
+func completeTransaction(tx *storage.Tx, err error) {
+	if _, interrupted := err.(InterruptedError); interrupted {
+		tx.Rollback()
+		return
+	}
+
+	tx.Commit()
+}
+
 func stdoutIsCharDevice() bool {
 	stat, err := os.Stdout.Stat()
 	if err != nil {
@@ -17,6 +17,7 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/storage"
 	"strings"
 )
@@ -25,13 +26,17 @@ var ConfigCommand = Command{
 	Name:     "config",
 	Synopsis: "Views or amends database settings",
 	Usages: []string{"tmsu config",
-		"tmsu config NAME[=VALUE]..."},
+		"tmsu config NAME[=VALUE]...",
+		"tmsu config --algorithms"},
 	Description: `Lists or views the database settings for the current database.
 
 Without arguments the complete set of settings are shown, otherwise lists the settings for the specified setting NAMEs.
 
-If a VALUE is specified then the setting is updated.`,
-	Options: Options{},
+If a VALUE is specified then the setting is updated. The fingerprint algorithm settings may only be set to one of the available algorithms, which are listed by the --algorithms option. The metadataTags setting lists the embedded metadata fields to apply as tags: see the 'import-metadata' subcommand.`,
+	Examples: []string{"$ tmsu config",
+		"$ tmsu config fileFingerprintAlgorithm=XXH3",
+		"$ tmsu config --algorithms"},
+	Options: Options{{"--algorithms", "-a", "list the available fingerprint algorithms", false, false, ""}},
 	Exec:    configExec,
 }
 
@@ -50,6 +55,11 @@ func configExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	if options.HasOption("--algorithms") {
+		listAlgorithms()
+		return nil, nil
+	}
+
 	if len(args) == 0 {
 		if err := listAllSettings(store, tx); err != nil {
 			return fmt.Errorf("could not list settings"), nil
@@ -62,7 +72,7 @@ func configExec(options Options, args []string, databasePath string) (error, war
 	}
 
 	for _, arg := range args {
-		parts := strings.Split(arg, "=")
+		parts := strings.SplitN(arg, "=", 2)
 		switch len(parts) {
 		case 1:
 			name := parts[0]
@@ -153,9 +163,54 @@ func amendSetting(store *storage.Storage, tx *storage.Tx, name, value string) er
 		return fmt.Errorf("no such setting '%v'", name)
 	}
 
+	if err := validateSetting(name, value); err != nil {
+		return err
+	}
+
 	if _, err = store.UpdateSetting(tx, name, value); err != nil {
 		return fmt.Errorf("could not update setting '%v': %v", name, err)
 	}
 
 	return nil
 }
+
+// The available values for the fingerprint algorithm settings.
+var algorithmSettings = []struct {
+	name       string
+	algorithms func() []string
+}{
+	{"directoryFingerprintAlgorithm", fingerprint.DirectoryAlgorithms},
+	{"fileFingerprintAlgorithm", fingerprint.FileAlgorithms},
+	{"imageFingerprintAlgorithm", fingerprint.ImageAlgorithms},
+	{"symlinkFingerprintAlgorithm", fingerprint.SymlinkAlgorithms},
+}
+
+func listAlgorithms() {
+	for _, setting := range algorithmSettings {
+		fmt.Printf("%v: %v\n", setting.name, strings.Join(setting.algorithms(), " "))
+	}
+}
+
+func validateSetting(name, value string) error {
+	if name == "metadataTags" {
+		_, err := parseMetadataMappings(value)
+		return err
+	}
+
+	for _, setting := range algorithmSettings {
+		if setting.name != name {
+			continue
+		}
+
+		algorithms := setting.algorithms()
+		for _, algorithm := range algorithms {
+			if algorithm == value {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("unsupported algorithm: available algorithms are %v", strings.Join(algorithms, ", "))
+	}
+
+	return nil
+}
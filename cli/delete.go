@@ -28,7 +28,7 @@ var DeleteCommand = Command{
 	Description: `Permanently deletes the TAGs specified.`,
 	Examples: []string{"$ tmsu delete pineapple",
 		"$ tmsu delete red green blue"},
-	Options: Options{Option{"--value", "", "delete a value", false, ""}},
+	Options: Options{Option{"--value", "", "delete a value", false, false, ""}},
 	Exec:    deleteExec,
 }
 
@@ -16,6 +16,7 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/oniony/TMSU/common/filesystem"
 	"github.com/oniony/TMSU/common/fingerprint"
@@ -23,25 +24,69 @@ import (
 	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var DupesCommand = Command{
-	Name:        "dupes",
-	Synopsis:    "Identify duplicate files",
-	Usages:      []string{"tmsu dupes [FILE]..."},
-	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.`,
+	Name:     "dupes",
+	Synopsis: "Identify duplicate files",
+	Usages: []string{"tmsu dupes [FILE]...",
+		"tmsu dupes --similar[=THRESHOLD] [FILE]...",
+		"tmsu dupes --resolve=STRATEGY [--delete|--hardlink] [--pretend]"},
+	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.
+
+When the --similar option is specified, images that look alike are identified instead. This requires perceptual image fingerprints, which are calculated as files are tagged when the 'imageFingerprintAlgorithm' setting is one of 'aHash', 'dHash' or 'pHash'. Images are considered similar when their fingerprints differ by no more than THRESHOLD bits (default 10) of 64.
+
+When the --resolve option is specified, one file of each set of duplicates in the database is kept according to the STRATEGY and the tags of the other copies are merged onto it. The other copies are then removed from the database and, if --delete or --hardlink is also specified, deleted or replaced by hard links to the kept file. Directories are never deleted or linked. The STRATEGY is one of:
+
+  keep-oldest         keep the file with the earliest modification time
+  keep-newest         keep the file with the latest modification time
+  keep-shortest-path  keep the file with the shortest path
+  interactive         prompt for the file to keep`,
 	Examples: []string{"$ tmsu dupes\nSet of 2 duplicates:\n  /tmp/song.mp3\n  /tmp/copy of song.mp3a",
-		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3"},
-	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""}},
-	Exec:    dupesExec,
+		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3",
+		"$ tmsu dupes --similar=5\nSet of 2 similar images:\n  /tmp/beach.jpg\n  /tmp/beach-small.png",
+		"$ tmsu dupes --resolve=keep-oldest --delete\n/tmp/song.mp3: kept\n/tmp/copy of song.mp3: merged tags into /tmp/song.mp3\n/tmp/copy of song.mp3: deleted"},
+	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, false, ""},
+		Option{"--similar", "-s", "identify similar images, optionally specifying the THRESHOLD", false, true, ""},
+		Option{"--resolve", "-R", "resolve duplicates in the database using STRATEGY", true, false, ""},
+		Option{"--delete", "", "delete the resolved duplicates from disk", false, false, ""},
+		Option{"--hardlink", "", "replace the resolved duplicates with hard links", false, false, ""},
+		Option{"--pretend", "-P", "do not make any changes", false, false, ""}},
+	Exec: dupesExec,
 }
 
+const defaultSimilarityThreshold = 10
+
+// The action taken on the disk for the copies of a duplicate that are not kept.
+type resolveAction int
+
+const (
+	resolveKeep resolveAction = iota
+	resolveDelete
+	resolveHardlink
+)
+
 // unexported
 
+// A file within a set of duplicates or similar images. Sets are numbered from
+// one and, when FILEs are specified, are the matches for the FILE given by Of.
+type dupeRecord struct {
+	Set  int    `json:"set"`
+	Of   string `json:"of,omitempty"`
+	Path string `json:"path"`
+}
+
 func dupesExec(options Options, args []string, databasePath string) (error, warnings) {
-	recursive := options.HasOption("--recursive")
+	format, err := outputFormatFor(options)
+	if err != nil {
+		return err, nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -49,21 +94,51 @@ func dupesExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer store.Close()
 
+	if options.HasOption("--resolve") {
+		return resolveWithOptions(store, options, args, format)
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
 	}
-	defer tx.Commit()
+
+	err, warnings := dupesWithOptions(store, tx, options, args, format)
+	completeTransaction(tx, err)
+
+	return err, warnings
+}
+
+func dupesWithOptions(store *storage.Storage, tx *storage.Tx, options Options, args []string, format *outputFormat) (error, warnings) {
+	recursive := options.HasOption("--recursive")
+
+	if options.HasOption("--similar") {
+		threshold := defaultSimilarityThreshold
+		if argument := options.Get("--similar").Argument; argument != "" {
+			var err error
+			threshold, err = strconv.Atoi(argument)
+			if err != nil || threshold < 0 || threshold > 64 {
+				return fmt.Errorf("invalid similarity threshold '%v': must be a number of bits from 0 to 64", argument), nil
+			}
+		}
+
+		switch len(args) {
+		case 0:
+			return findSimilarInDb(store, tx, threshold, format), nil
+		default:
+			return findSimilarTo(store, tx, args, recursive, threshold, format)
+		}
+	}
 
 	switch len(args) {
 	case 0:
-		return findDuplicatesInDb(store, tx), nil
+		return findDuplicatesInDb(store, tx, format), nil
 	default:
-		return findDuplicatesOf(store, tx, args, recursive)
+		return findDuplicatesOf(store, tx, args, recursive, format)
 	}
 }
 
-func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
+func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx, format *outputFormat) error {
 	log.Info(2, "identifying duplicate files.")
 
 	fileSets, err := store.DuplicateFiles(tx)
@@ -73,6 +148,17 @@ func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
 
 	log.Infof(2, "found %v sets of duplicate files.", len(fileSets))
 
+	if format != nil {
+		records := make([]dupeRecord, 0, len(fileSets)*2)
+		for index, fileSet := range fileSets {
+			for _, file := range fileSet {
+				records = append(records, dupeRecord{index + 1, "", _path.Rel(file.Path())})
+			}
+		}
+
+		return format.print(records)
+	}
+
 	for index, fileSet := range fileSets {
 		if index > 0 {
 			fmt.Println()
@@ -89,46 +175,412 @@ func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
 	return nil
 }
 
-func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) (error, warnings) {
-	settings, err := store.Settings(tx)
+func resolveWithOptions(store *storage.Storage, options Options, args []string, format *outputFormat) (error, warnings) {
+	if options.HasOption("--similar") {
+		return fmt.Errorf("--resolve cannot be used with --similar"), nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("--resolve applies only to duplicates within the database"), nil
+	}
+	if format != nil {
+		return fmt.Errorf("--resolve cannot be used with --format"), nil
+	}
+	if options.HasOption("--delete") && options.HasOption("--hardlink") {
+		return fmt.Errorf("--delete and --hardlink cannot be used together"), nil
+	}
+
+	strategy := options.Get("--resolve").Argument
+	action := resolveKeep
+	switch {
+	case options.HasOption("--delete"):
+		action = resolveDelete
+	case options.HasOption("--hardlink"):
+		action = resolveHardlink
+	}
+
+	return resolveDuplicatesInDb(store, strategy, action, options.HasOption("--pretend"))
+}
+
+// Resolves the sets of duplicates in the database. Each duplicate is resolved
+// within its own transaction, committed as soon as its copy on disk has been
+// dealt with, so that the database keeps step with the disk should the command
+// fail or be killed part way through.
+func resolveDuplicatesInDb(store *storage.Storage, strategy string, action resolveAction, pretend bool) (error, warnings) {
+	var choose func(entities.Files) (int, error)
+
+	switch strategy {
+	case "keep-oldest":
+		choose = oldestFile
+	case "keep-newest":
+		choose = newestFile
+	case "keep-shortest-path":
+		choose = shortestPathFile
+	case "interactive":
+		choose = promptForFile(bufio.NewReader(os.Stdin))
+	default:
+		return fmt.Errorf("invalid resolution strategy '%v': must be one of keep-oldest, keep-newest, keep-shortest-path or interactive", strategy), nil
+	}
+
+	log.Info(2, "identifying duplicate files.")
+
+	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
 	}
 
+	fileSets, err := store.DuplicateFiles(tx)
+	completeTransaction(tx, err)
+	if err != nil {
+		return fmt.Errorf("could not identify duplicate files: %v", err), nil
+	}
+
 	warnings := make(warnings, 0, 10)
-	for _, path := range paths {
-		_, err := os.Stat(path)
+
+	for index, fileSet := range fileSets {
+		if index > 0 && strategy == "interactive" {
+			fmt.Println()
+		}
+
+		keepIndex, err := choose(fileSet)
 		if err != nil {
-			switch {
-			case os.IsNotExist(err):
-				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
-				continue
-			case os.IsPermission(err):
-				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+			return err, warnings
+		}
+		if keepIndex < 0 {
+			continue
+		}
+
+		keep := fileSet[keepIndex]
+		fmt.Printf("%v: kept\n", _path.Rel(keep.Path()))
+
+		for otherIndex, other := range fileSet {
+			if otherIndex == keepIndex {
 				continue
-			default:
+			}
+
+			tx, err := store.Begin()
+			if err != nil {
+				return err, warnings
+			}
+
+			resolveWarnings, err := resolveDuplicate(store, tx, keep, other, action, pretend)
+			completeTransaction(tx, err)
+			warnings = append(warnings, resolveWarnings...)
+			if err != nil {
 				return err, warnings
 			}
 		}
 	}
 
-	if recursive {
-		p, err := filesystem.Enumerate(paths...)
+	return nil, warnings
+}
+
+// Merges the tags of the duplicate onto the file being kept and removes the
+// duplicate from the database and, depending upon the action, from the disk.
+// The database is left alone if the files turn out not to be identical. It is
+// changed before the disk, so that the duplicate's cached fingerprint is
+// removed by the duplicate's own identity rather than that of the hard link
+// replacing it, and should changing the disk then fail the duplicate is left
+// there as though it had been kept.
+func resolveDuplicate(store *storage.Storage, tx *storage.Tx, keep, other *entities.File, action resolveAction, pretend bool) (warnings, error) {
+	keepPath := _path.Rel(keep.Path())
+	otherPath := _path.Rel(other.Path())
+
+	action, diskMessage, diskWarnings, resolved, err := checkDuplicateOnDisk(keep, other, action)
+	if err != nil || !resolved {
+		return diskWarnings, err
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, other.Id, true)
+	if err != nil {
+		return diskWarnings, fmt.Errorf("%v: could not retrieve file tags: %v", otherPath, err)
+	}
+
+	if !pretend {
+		for _, fileTag := range fileTags {
+			if _, err := store.AddFileTag(tx, keep.Id, fileTag.TagId, fileTag.ValueId); err != nil {
+				return diskWarnings, fmt.Errorf("%v: could not add file tag: %v", keepPath, err)
+			}
+		}
+
+		if err := store.DeleteFileTagsByFileId(tx, other.Id); err != nil {
+			return diskWarnings, fmt.Errorf("%v: could not remove file from database: %v", otherPath, err)
+		}
+	}
+
+	fmt.Printf("%v: merged tags into %v\n", otherPath, keepPath)
+
+	if err := changeDuplicateOnDisk(keep, other, action, pretend); err != nil {
+		return diskWarnings, err
+	}
+
+	if diskMessage != "" {
+		fmt.Println(diskMessage)
+	}
+
+	return diskWarnings, nil
+}
+
+// Determines what is to be done with the duplicate on disk, returning the
+// action to take, which is resolveKeep if there is nothing to do, along with a
+// message describing it. The duplicate is left alone, and resolved is false, if
+// it is no longer identical to the file being kept.
+func checkDuplicateOnDisk(keep, other *entities.File, action resolveAction) (resolveAction, string, warnings, bool, error) {
+	keepPath := _path.Rel(keep.Path())
+	otherPath := _path.Rel(other.Path())
+
+	if action == resolveKeep {
+		return resolveKeep, "", nil, true, nil
+	}
+	if other.IsDir {
+		return resolveKeep, "", warnings{fmt.Sprintf("%v: is a directory: left on disk", otherPath)}, true, nil
+	}
+
+	stat, err := os.Lstat(other.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return resolveKeep, "", warnings{fmt.Sprintf("%v: missing from disk", otherPath)}, true, nil
+		}
+
+		return resolveKeep, "", nil, false, fmt.Errorf("%v: could not stat file: %v", otherPath, err)
+	}
+
+	keepStat, err := os.Lstat(keep.Path())
+	if err != nil {
+		return resolveKeep, "", nil, false, fmt.Errorf("%v: could not stat file: %v", keepPath, err)
+	}
+
+	if action == resolveHardlink && os.SameFile(stat, keepStat) {
+		return resolveKeep, fmt.Sprintf("%v: already a hard link to %v", otherPath, keepPath), nil, true, nil
+	}
+
+	identical, err := identicalFiles(keep, other, keepStat, stat)
+	if err != nil {
+		return resolveKeep, "", nil, false, err
+	}
+	if !identical {
+		return resolveKeep, "", warnings{fmt.Sprintf("%v: not identical to %v: left unchanged", otherPath, keepPath)}, false, nil
+	}
+
+	switch action {
+	case resolveDelete:
+		return action, fmt.Sprintf("%v: deleted", otherPath), nil, true, nil
+	case resolveHardlink:
+		return action, fmt.Sprintf("%v: replaced with hard link to %v", otherPath, keepPath), nil, true, nil
+	}
+
+	return resolveKeep, "", nil, true, nil
+}
+
+// Deletes the duplicate from disk or replaces it with a hard link to the file
+// being kept, depending upon the action.
+func changeDuplicateOnDisk(keep, other *entities.File, action resolveAction, pretend bool) error {
+	if pretend {
+		return nil
+	}
+
+	otherPath := _path.Rel(other.Path())
+
+	switch action {
+	case resolveDelete:
+		if err := os.Remove(other.Path()); err != nil {
+			return fmt.Errorf("%v: could not delete file: %v", otherPath, err)
+		}
+	case resolveHardlink:
+		if err := hardlink(keep.Path(), other.Path()); err != nil {
+			return fmt.Errorf("%v: could not replace with hard link: %v", otherPath, err)
+		}
+	}
+
+	return nil
+}
+
+// Determines whether two files with matching fingerprints are identical before
+// either is destroyed: fingerprints may match for different contents, such as
+// when only samples of larger files are fingerprinted, and the files may have
+// changed since they were fingerprinted.
+func identicalFiles(keep, other *entities.File, keepStat, otherStat os.FileInfo) (bool, error) {
+	if !keepStat.Mode().IsRegular() || !otherStat.Mode().IsRegular() {
+		return false, nil
+	}
+	if !unmodified(keep, keepStat) || !unmodified(other, otherStat) {
+		return false, nil
+	}
+
+	same, err := sameContents(keep.Path(), other.Path())
+	if err != nil || !same {
+		return false, err
+	}
+
+	// check neither file was modified whilst being compared
+	for _, file := range (entities.Files{keep, other}) {
+		stat, err := os.Lstat(file.Path())
 		if err != nil {
-			return fmt.Errorf("could not enumerate paths: %v", err), warnings
+			return false, fmt.Errorf("%v: could not stat file: %v", _path.Rel(file.Path()), err)
+		}
+		if !unmodified(file, stat) {
+			return false, nil
 		}
+	}
 
-		paths = make([]string, len(p))
-		for index, path := range p {
-			paths[index] = path.Path
+	return true, nil
+}
+
+// Determines whether the file on disk has the size and modification time
+// recorded in the database.
+func unmodified(file *entities.File, stat os.FileInfo) bool {
+	return file.Size == stat.Size() && file.ModTime.Equal(stat.ModTime().UTC())
+}
+
+// Compares the contents of two files byte by byte.
+func sameContents(pathA, pathB string) (bool, error) {
+	fileA, err := os.Open(pathA)
+	if err != nil {
+		return false, fmt.Errorf("%v: could not open file: %v", _path.Rel(pathA), err)
+	}
+	defer fileA.Close()
+
+	fileB, err := os.Open(pathB)
+	if err != nil {
+		return false, fmt.Errorf("%v: could not open file: %v", _path.Rel(pathB), err)
+	}
+	defer fileB.Close()
+
+	bufferA := make([]byte, 64*1024)
+	bufferB := make([]byte, 64*1024)
+
+	for {
+		countA, errA := io.ReadFull(fileA, bufferA)
+		countB, errB := io.ReadFull(fileB, bufferB)
+
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, fmt.Errorf("%v: could not read file: %v", _path.Rel(pathA), errA)
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, fmt.Errorf("%v: could not read file: %v", _path.Rel(pathB), errB)
+		}
+
+		if countA != countB || string(bufferA[:countA]) != string(bufferB[:countB]) {
+			return false, nil
+		}
+		if errA != nil {
+			return true, nil
 		}
 	}
+}
+
+// Replaces the file at path with a hard link to target. The link is created
+// alongside the file and then renamed over it so that the file is not lost
+// should linking fail.
+func hardlink(target, path string) error {
+	tempPath := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%v.tmsu-%v", filepath.Base(path), os.Getpid()))
+
+	if err := os.Link(target, tempPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
+
+func oldestFile(files entities.Files) (int, error) {
+	keep := 0
+	for index, file := range files {
+		if file.ModTime.Before(files[keep].ModTime) {
+			keep = index
+		}
+	}
+
+	return keep, nil
+}
+
+func newestFile(files entities.Files) (int, error) {
+	keep := 0
+	for index, file := range files {
+		if file.ModTime.After(files[keep].ModTime) {
+			keep = index
+		}
+	}
+
+	return keep, nil
+}
+
+func shortestPathFile(files entities.Files) (int, error) {
+	keep := 0
+	for index, file := range files {
+		if len(file.Path()) < len(files[keep].Path()) {
+			keep = index
+		}
+	}
+
+	return keep, nil
+}
+
+// Prompts the user to choose the file to keep, returning -1 if the set is
+// skipped.
+func promptForFile(reader *bufio.Reader) func(entities.Files) (int, error) {
+	return func(files entities.Files) (int, error) {
+		fmt.Printf("Set of %v duplicates:\n", len(files))
+		for index, file := range files {
+			fmt.Printf("  %v) %v\n", index+1, _path.Rel(file.Path()))
+		}
+
+		for {
+			fmt.Printf("Keep which file (1-%v, or s to skip)? ", len(files))
+
+			line, err := reader.ReadString('\n')
+			if err != nil && (err != io.EOF || line == "") {
+				if err == io.EOF {
+					fmt.Println()
+					return -1, fmt.Errorf("no file chosen")
+				}
+
+				return -1, err
+			}
+
+			answer := strings.TrimSpace(line)
+			if answer == "s" {
+				return -1, nil
+			}
+
+			number, err := strconv.Atoi(answer)
+			if err == nil && number >= 1 && number <= len(files) {
+				return number - 1, nil
+			}
+		}
+	}
+}
+
+func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool, format *outputFormat) (error, warnings) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	paths, warnings, err := existingPaths(paths, recursive)
+	if err != nil {
+		return err, warnings
+	}
+
+	fingerprinter := newFingerprinter(store, tx, settings)
+	fingerprinter.useStored()
+	if err := fingerprinter.calculate(paths); err != nil {
+		return err, warnings
+	}
+
+	var records []dupeRecord
+	if format != nil {
+		records = make([]dupeRecord, 0, len(paths))
+	}
 
 	first := true
-	for _, path := range paths {
+	for index, path := range paths {
 		log.Infof(2, "%v: identifying duplicate files.", path)
 
-		fp, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		fp, err := fingerprinter.create(path)
 		if err != nil {
 			return fmt.Errorf("%v: could not create fingerprint: %v", path, err), warnings
 		}
@@ -142,34 +594,295 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 			return fmt.Errorf("%v: could not retrieve files matching fingerprint '%v': %v", path, fp, err), warnings
 		}
 
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return fmt.Errorf("%v: could not determine absolute path: %v", path, err), warnings
+		if err := printMatches(path, files, len(paths) > 1, &first, index+1, &records); err != nil {
+			return err, warnings
 		}
+	}
+
+	if format != nil {
+		return format.print(records), warnings
+	}
+
+	return nil, warnings
+}
+
+func findSimilarInDb(store *storage.Storage, tx *storage.Tx, threshold int, format *outputFormat) error {
+	imageFingerprints, err := loadImageFingerprints(store, tx)
+	if err != nil {
+		return err
+	}
+
+	imageBits, err := decodeImageFingerprints(imageFingerprints)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(2, "grouping %v images by similarity.", len(imageFingerprints))
 
-		// filter out the file we're searching on
-		dupes := files.Where(func(file *entities.File) bool { return file.Path() != absPath })
+	// union-find over the pairs of images within the threshold
+	parents := make([]int, len(imageFingerprints))
+	for index := range parents {
+		parents[index] = index
+	}
 
-		if len(paths) > 1 && len(dupes) > 0 {
-			if first {
-				first = false
-			} else {
-				fmt.Println()
+	var root func(int) int
+	root = func(index int) int {
+		if parents[index] != index {
+			parents[index] = root(parents[index])
+		}
+		return parents[index]
+	}
+
+	for i := range imageBits {
+		for j := i + 1; j < len(imageBits); j++ {
+			if fingerprint.BitDistance(imageBits[i], imageBits[j]) <= threshold {
+				parents[root(j)] = root(i)
 			}
+		}
+	}
 
-			fmt.Printf("%v:\n", path)
+	groups := make(map[int]entities.Files)
+	roots := make([]int, 0, 10)
+	for index, imageFingerprint := range imageFingerprints {
+		file, err := store.File(tx, imageFingerprint.FileId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file #%v: %v", imageFingerprint.FileId, err)
+		}
+		if file == nil {
+			continue
+		}
+
+		groupRoot := root(index)
+		if _, ok := groups[groupRoot]; !ok {
+			roots = append(roots, groupRoot)
+		}
+		groups[groupRoot] = append(groups[groupRoot], file)
+	}
+
+	records := make([]dupeRecord, 0, len(imageFingerprints))
+	set := 0
+	first := true
+	for _, groupRoot := range roots {
+		group := groups[groupRoot]
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.Slice(group, func(i, j int) bool { return group[i].Path() < group[j].Path() })
 
-			for _, dupe := range dupes {
-				relPath := _path.Rel(dupe.Path())
-				fmt.Printf("  %v\n", relPath)
+		if format != nil {
+			set++
+			for _, file := range group {
+				records = append(records, dupeRecord{set, "", _path.Rel(file.Path())})
 			}
+
+			continue
+		}
+
+		if first {
+			first = false
 		} else {
-			for _, dupe := range dupes {
-				relPath := _path.Rel(dupe.Path())
-				fmt.Println(relPath)
+			fmt.Println()
+		}
+
+		fmt.Printf("Set of %v similar images:\n", len(group))
+
+		for _, file := range group {
+			fmt.Printf("  %v\n", _path.Rel(file.Path()))
+		}
+	}
+
+	if format != nil {
+		return format.print(records)
+	}
+
+	return nil
+}
+
+func findSimilarTo(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool, threshold int, format *outputFormat) (error, warnings) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	imageFingerprints, err := loadImageFingerprints(store, tx)
+	if err != nil {
+		return err, nil
+	}
+
+	imageBits, err := decodeImageFingerprints(imageFingerprints)
+	if err != nil {
+		return err, nil
+	}
+
+	paths, warnings, err := existingPaths(paths, recursive)
+	if err != nil {
+		return err, warnings
+	}
+
+	fingerprinter := newFingerprinter(store, tx, settings)
+	if err := fingerprinter.calculate(paths); err != nil {
+		return err, warnings
+	}
+
+	var records []dupeRecord
+	if format != nil {
+		records = make([]dupeRecord, 0, len(paths))
+	}
+
+	first := true
+	for index, path := range paths {
+		log.Infof(2, "%v: identifying similar images.", path)
+
+		fp, err := fingerprinter.createImage(path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v: could not create image fingerprint: %v", path, err))
+			continue
+		}
+		if fp == fingerprint.Empty {
+			continue
+		}
+
+		fpBits, err := fingerprint.ImageBits(fp)
+		if err != nil {
+			return err, warnings
+		}
+
+		files := make(entities.Files, 0, 10)
+		for index, imageFingerprint := range imageFingerprints {
+			if fingerprint.BitDistance(fpBits, imageBits[index]) > threshold {
+				continue
+			}
+
+			file, err := store.File(tx, imageFingerprint.FileId)
+			if err != nil {
+				return fmt.Errorf("could not retrieve file #%v: %v", imageFingerprint.FileId, err), warnings
+			}
+			if file != nil {
+				files = append(files, file)
 			}
 		}
+
+		if err := printMatches(path, files, len(paths) > 1, &first, index+1, &records); err != nil {
+			return err, warnings
+		}
+	}
+
+	if format != nil {
+		return format.print(records), warnings
 	}
 
 	return nil, warnings
 }
+
+func loadImageFingerprints(store *storage.Storage, tx *storage.Tx) (entities.ImageFingerprints, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := settings.ImageFingerprintAlgorithm()
+	if algorithm == fingerprint.NoImageAlgorithm || algorithm == "" {
+		return nil, fmt.Errorf("image fingerprints are not enabled: set 'imageFingerprintAlgorithm' to 'aHash', 'dHash' or 'pHash' and then retag or repair the files")
+	}
+
+	imageFingerprints, err := store.ImageFingerprints(tx, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve image fingerprints: %v", err)
+	}
+
+	return imageFingerprints, nil
+}
+
+// Decodes the image fingerprints up front so that each comparison is a simple
+// bit count.
+func decodeImageFingerprints(imageFingerprints entities.ImageFingerprints) ([]uint64, error) {
+	imageBits := make([]uint64, len(imageFingerprints))
+	for index, imageFingerprint := range imageFingerprints {
+		fpBits, err := fingerprint.ImageBits(imageFingerprint.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		imageBits[index] = fpBits
+	}
+
+	return imageBits, nil
+}
+
+// Prints the files that match the file at path, other than the file itself. If
+// records is not nil then the matches are added to it as the set numbered set
+// instead.
+func printMatches(path string, files entities.Files, multiple bool, first *bool, set int, records *[]dupeRecord) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not determine absolute path: %v", path, err)
+	}
+
+	// filter out the file we're searching on
+	dupes := files.Where(func(file *entities.File) bool { return file.Path() != absPath })
+
+	if *records != nil {
+		for _, dupe := range dupes {
+			*records = append(*records, dupeRecord{set, path, _path.Rel(dupe.Path())})
+		}
+
+		return nil
+	}
+
+	if multiple && len(dupes) > 0 {
+		if *first {
+			*first = false
+		} else {
+			fmt.Println()
+		}
+
+		fmt.Printf("%v:\n", path)
+
+		for _, dupe := range dupes {
+			relPath := _path.Rel(dupe.Path())
+			fmt.Printf("  %v\n", relPath)
+		}
+	} else {
+		for _, dupe := range dupes {
+			relPath := _path.Rel(dupe.Path())
+			fmt.Println(relPath)
+		}
+	}
+
+	return nil
+}
+
+// Identifies the paths to check, warning of those that cannot be accessed
+func existingPaths(paths []string, recursive bool) ([]string, warnings, error) {
+	warnings := make(warnings, 0, 10)
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+				continue
+			case os.IsPermission(err):
+				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+				continue
+			default:
+				return nil, warnings, err
+			}
+		}
+	}
+
+	if recursive {
+		p, err := filesystem.Enumerate(paths...)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("could not enumerate paths: %v", err)
+		}
+
+		paths = make([]string, len(p))
+		for index, path := range p {
+			paths[index] = path.Path
+		}
+	}
+
+	return paths, warnings, nil
+}
@@ -36,3 +36,9 @@ type NoSuchValueError struct {
 func (err NoSuchValueError) Error() string {
 	return fmt.Sprintf("no such value '%v'", err.Name)
 }
+
+type InterruptedError struct{}
+
+func (err InterruptedError) Error() string {
+	return "interrupted"
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/oniony/TMSU/storage"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 var FilesCommand = Command{
@@ -48,20 +49,32 @@ Note: If your tag or value name contains whitespace, operators (e.g. '<') or par
 		`$ tmsu files year`,
 		`$ tmsu files --path=/home/bob music`,
 		`$ tmsu files 'contains\=equals'`,
-		`$ tmsu files '\<tag\>'`},
-	Options: Options{{"--directory", "-d", "list only items that are directories", false, ""},
-		{"--file", "-f", "list only items that are files", false, ""},
-		{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""},
-		{"--count", "-c", "lists the number of files rather than their names", false, ""},
-		{"--path", "-p", "list only items under PATH", true, ""},
-		{"--explicit", "-e", "list only explicitly tagged files", false, ""},
-		{"--sort", "-s", "sort output: id, none, name, size, time", true, ""},
-		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""}},
+		`$ tmsu files '\<tag\>'`,
+		`$ tmsu --format='{{.Path}}\t{{.Size}}\t{{join .Tags ","}}' files music`},
+	Options: Options{{"--directory", "-d", "list only items that are directories", false, false, ""},
+		{"--file", "-f", "list only items that are files", false, false, ""},
+		{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, false, ""},
+		{"--count", "-c", "lists the number of files rather than their names", false, false, ""},
+		{"--path", "-p", "list only items under PATH", true, false, ""},
+		{"--explicit", "-e", "list only explicitly tagged files", false, false, ""},
+		{"--sort", "-s", "sort output: id, none, name, size, time", true, false, ""},
+		{"--ignore-case", "-i", "ignore the case of tag and value names", false, false, ""}},
 	Exec: filesExec,
 }
 
 // unexported
 
+type fileRecord struct {
+	Path        string    `json:"path"`
+	Directory   string    `json:"directory"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	IsDir       bool      `json:"isDir"`
+	Fingerprint string    `json:"fingerprint"`
+	Tags        []string  `json:"tags"`
+}
+
 func filesExec(options Options, args []string, databasePath string) (error, warnings) {
 	dirOnly := options.HasOption("--directory")
 	fileOnly := options.HasOption("--file")
@@ -71,6 +84,11 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 	explicitOnly := options.HasOption("--explicit")
 	ignoreCase := options.HasOption("--ignore-case")
 
+	format, err := outputFormatFor(options)
+	if err != nil {
+		return err, nil
+	}
+
 	sort := "name"
 	if options.HasOption("--sort") {
 		sort = options.Get("--sort").Argument
@@ -80,7 +98,6 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 	if hasPath {
 		relPath := options.Get("--path").Argument
 
-		var err error
 		absPath, err = filepath.Abs(relPath)
 		if err != nil {
 			return fmt.Errorf("could not get absolute path of '%v': %v'", relPath, err), nil
@@ -100,12 +117,12 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 	defer tx.Commit()
 
 	queryText := strings.Join(args, " ")
-	return listFilesForQuery(store, tx, queryText, absPath, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, sort)
+	return listFilesForQuery(store, tx, queryText, absPath, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, sort, format)
 }
 
 // unexported
 
-func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase bool, sort string) (error, warnings) {
+func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase bool, sort string, format *outputFormat) (error, warnings) {
 	log.Info(2, "parsing query")
 
 	expression, err := query.Parse(queryText)
@@ -164,15 +181,16 @@ func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path s
 		return fmt.Errorf("could not query files: %v", err), warnings
 	}
 
-	if err = listFiles(tx, files, dirOnly, fileOnly, print0, showCount); err != nil {
+	if err = listFiles(store, tx, files, dirOnly, fileOnly, print0, showCount, format); err != nil {
 		return err, warnings
 	}
 
 	return nil, warnings
 }
 
-func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool) error {
+func listFiles(store *storage.Storage, tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool, format *outputFormat) error {
 	relPaths := make([]string, 0, len(files))
+	listed := make(entities.Files, 0, len(files))
 	for _, file := range files {
 		if fileOnly && file.IsDir {
 			continue
@@ -185,6 +203,25 @@ func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0,
 		relPath := path.Rel(absPath)
 
 		relPaths = append(relPaths, relPath)
+		listed = append(listed, file)
+	}
+
+	if format != nil {
+		if showCount {
+			return format.print(countRecord{uint(len(relPaths))})
+		}
+
+		records := make([]fileRecord, len(listed))
+		for index, file := range listed {
+			tagNames, err := tagNamesForFile(store, tx, file.Id, false, false)
+			if err != nil {
+				return err
+			}
+
+			records[index] = fileRecord{relPaths[index], file.Directory, file.Name, file.Size, file.ModTime, file.IsDir, string(file.Fingerprint), tagNames}
+		}
+
+		return format.print(records)
 	}
 
 	if showCount {
@@ -0,0 +1,145 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/terminal"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"os/signal"
+)
+
+// Creates fingerprints using the configured algorithms, making use of any that
+// have been calculated up-front or that are held in the fingerprint cache.
+type fingerprinter struct {
+	fileAlgorithm      string
+	directoryAlgorithm string
+	symlinkAlgorithm   string
+	imageAlgorithm     string
+	cache              *storage.FingerprintCache
+	calculated         map[string]fingerprint.Result
+}
+
+func newFingerprinter(store *storage.Storage, tx *storage.Tx, settings entities.Settings) *fingerprinter {
+	return &fingerprinter{settings.FileFingerprintAlgorithm(),
+		settings.DirectoryFingerprintAlgorithm(),
+		settings.SymlinkFingerprintAlgorithm(),
+		settings.ImageFingerprintAlgorithm(),
+		store.NewFingerprintCache(tx, settings.FileFingerprintAlgorithm()),
+		make(map[string]fingerprint.Result)}
+}
+
+// Reuses the fingerprints stored in the database for unmodified tagged files.
+func (fingerprinter *fingerprinter) useStored() {
+	fingerprinter.cache.ReuseStored = true
+}
+
+// Leaves the fingerprint cache unchanged, such as when pretending.
+func (fingerprinter *fingerprinter) readOnly() {
+	fingerprinter.cache.ReadOnly = true
+}
+
+// Creates the fingerprint for the specified path.
+func (fingerprinter *fingerprinter) create(path string) (fingerprint.Fingerprint, error) {
+	if result, ok := fingerprinter.calculated[path]; ok {
+		return result.Fingerprint, result.Err
+	}
+
+	return fingerprint.CreateWithCache(path, fingerprinter.fileAlgorithm, fingerprinter.directoryAlgorithm, fingerprinter.symlinkAlgorithm, fingerprinter.cache)
+}
+
+// Creates the perceptual image fingerprint for the specified path.
+func (fingerprinter *fingerprinter) createImage(path string) (fingerprint.Fingerprint, error) {
+	if result, ok := fingerprinter.calculated[path]; ok && result.Err == nil {
+		return result.ImageFingerprint, result.ImageErr
+	}
+
+	return fingerprint.CreateImage(path, fingerprinter.imageAlgorithm)
+}
+
+// Records the perceptual image fingerprint of the file, if image fingerprinting is enabled.
+func (fingerprinter *fingerprinter) updateImage(store *storage.Storage, tx *storage.Tx, file *entities.File) error {
+	if fingerprinter.imageAlgorithm == "none" || fingerprinter.imageAlgorithm == "" {
+		return nil
+	}
+
+	fp, err := fingerprinter.createImage(file.Path())
+	if err != nil {
+		log.Warnf("%v: could not create image fingerprint: %v", file.Path(), err)
+		return nil
+	}
+
+	if err := store.UpdateImageFingerprint(tx, file.Id, fingerprinter.imageAlgorithm, fp); err != nil {
+		return fmt.Errorf("%v: could not update image fingerprint: %v", file.Path(), err)
+	}
+
+	return nil
+}
+
+// Calculates the fingerprints of the specified paths concurrently,
+// showing progress on the terminal. If the user interrupts the calculation then
+// an InterruptedError is returned.
+func (fingerprinter *fingerprinter) calculate(paths []string) error {
+	if len(paths) < 2 {
+		return nil
+	}
+
+	log.Infof(2, "calculating %v fingerprints", len(paths))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	cancel := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+
+	go func() {
+		select {
+		case <-interrupt:
+			close(cancel)
+		case <-finished:
+		}
+	}()
+
+	bar := terminal.NewProgressBar("fingerprinting")
+
+	pool := fingerprint.NewPool(fingerprinter.fileAlgorithm, fingerprinter.directoryAlgorithm, fingerprinter.symlinkAlgorithm)
+	pool.ImageAlgorithm = fingerprinter.imageAlgorithm
+	pool.Cache = fingerprinter.cache
+	pool.Progress = func(progress fingerprint.Progress) {
+		bar.Update(progress.FilesDone, progress.FilesTotal, progress.BytesDone, progress.BytesTotal)
+	}
+
+	results, err := pool.CreateAll(paths, cancel)
+	bar.Clear()
+	if err == fingerprint.ErrCancelled {
+		return InterruptedError{}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		fingerprinter.calculated[result.Path] = result
+	}
+
+	return nil
+}
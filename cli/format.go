@@ -0,0 +1,181 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// unexported
+
+// The format in which a subcommand writes its results, as chosen with the
+// global --format option.
+type outputFormat struct {
+	name     string
+	template *template.Template
+}
+
+type countRecord struct {
+	Count uint `json:"count"`
+}
+
+var templateFuncs = template.FuncMap{
+	"join": func(items []string, separator string) string { return strings.Join(items, separator) },
+	"json": func(value interface{}) (string, error) {
+		bytes, err := json.Marshal(value)
+		return string(bytes), err
+	},
+}
+
+// Determines the output format from the --format option, returning nil if the
+// subcommand's usual text output is to be used.
+func outputFormatFor(options Options) (*outputFormat, error) {
+	if !options.HasOption("--format") {
+		return nil, nil
+	}
+
+	name := options.Get("--format").Argument
+	switch name {
+	case "", "text":
+		return nil, nil
+	case "json", "csv", "tsv":
+		return &outputFormat{name, nil}, nil
+	}
+
+	if !strings.Contains(name, "{{") {
+		return nil, fmt.Errorf("invalid argument '%v' for '--format': expected text, json, csv, tsv or a template", name)
+	}
+
+	text := strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\0`, "\000").Replace(name)
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse format template: %v", err)
+	}
+
+	return &outputFormat{"template", tmpl}, nil
+}
+
+// Writes the records, either a single struct or a slice of them, to standard
+// output in the format. CSV and TSV columns are named as the JSON fields.
+func (format *outputFormat) print(records interface{}) error {
+	value := reflect.ValueOf(records)
+
+	switch format.name {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "template":
+		for _, record := range recordValues(value) {
+			if err := format.template.Execute(os.Stdout, record.Interface()); err != nil {
+				return fmt.Errorf("could not format output: %v", err)
+			}
+
+			fmt.Println()
+		}
+
+		return nil
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	if format.name == "tsv" {
+		writer.Comma = '\t'
+	}
+
+	recordType := value.Type()
+	if recordType.Kind() == reflect.Slice {
+		recordType = recordType.Elem()
+	}
+
+	header := make([]string, recordType.NumField())
+	for index := range header {
+		header[index] = fieldName(recordType.Field(index))
+	}
+	writer.Write(header)
+
+	for _, record := range recordValues(value) {
+		row := make([]string, record.NumField())
+		for index := range row {
+			row[index] = formatField(record.Field(index))
+		}
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func recordValues(value reflect.Value) []reflect.Value {
+	if value.Kind() != reflect.Slice {
+		return []reflect.Value{value}
+	}
+
+	values := make([]reflect.Value, value.Len())
+	for index := range values {
+		values[index] = value.Index(index)
+	}
+
+	return values
+}
+
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// Formats a field as a CSV or TSV cell: lists are comma separated.
+func formatField(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+
+		value = value.Elem()
+	}
+
+	switch typed := value.Interface().(type) {
+	case time.Time:
+		return typed.Format(time.RFC3339)
+	case fmt.Stringer:
+		return typed.String()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		items := make([]string, value.Len())
+		for index := range items {
+			items[index] = formatField(value.Index(index))
+		}
+
+		return strings.Join(items, ",")
+	case reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("%1.2f", value.Float())
+	}
+
+	return fmt.Sprint(value.Interface())
+}
@@ -31,7 +31,7 @@ var HelpCommand = Command{
 	Synopsis:    "List subcommands or show help for a particular subcommand",
 	Usages:      []string{"tmsu help [OPTION]... [SUBCOMMAND]"},
 	Description: `Shows help summary or, where SUBCOMMAND is specified, help for SUBCOMMAND.`,
-	Options:     Options{{"--list", "-l", "list commands", false, ""}},
+	Options:     Options{{"--list", "-l", "list commands", false, false, ""}},
 	Exec:        helpExec,
 }
 
@@ -117,6 +117,8 @@ func summary(colour bool) {
 
 	printOptions(globalOptions)
 
+	fmt.Println()
+	terminal.PrintWrapped("The --format option applies to the listing subcommands: dupes, files, imply, info, tags, untagged and values. The 'json' format writes the results as JSON whilst 'csv' and 'tsv' write a header row followed by a row per result, with lists comma separated. Any other argument is a Go template, such as '{{.Path}}\\t{{join .Tags \",\"}}', that is written for each result: the fields are named as the JSON keys but capitalized and '\\t' and '\\n' stand for tab and newline. Tags are given in the TAG=VALUE form used by the 'tag' subcommand.")
 	fmt.Println()
 	terminal.PrintWrapped("Specify subcommand name for detailed help on a particular subcommand, e.g. tmsu help files")
 }
@@ -42,12 +42,19 @@ The 'tags' subcommand can be used to identify which tags applied to a file are i
 mp3 -> music`,
 		`$ tmsu imply aubergine aka=eggplant`,
 		`$ tmsu imply --delete mp3 music`},
-	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, ""}},
+	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, false, ""}},
 	Exec:    implyExec,
 }
 
 // unexported
 
+type implicationRecord struct {
+	ImplyingTag   string `json:"implyingTag"`
+	ImplyingValue string `json:"implyingValue"`
+	ImpliedTag    string `json:"impliedTag"`
+	ImpliedValue  string `json:"impliedValue"`
+}
+
 func implyExec(options Options, args []string, databasePath string) (error, warnings) {
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -76,6 +83,14 @@ func implyExec(options Options, args []string, databasePath string) (error, warn
 
 	switch len(args) {
 	case 0:
+		format, err := outputFormatFor(options)
+		if err != nil {
+			return err, nil
+		}
+		if format != nil {
+			return formatImplications(store, tx, format), nil
+		}
+
 		return listImplications(store, tx, colour), nil
 	case 1:
 		return fmt.Errorf("tag(s) to be implied must be specified"), nil
@@ -122,6 +137,20 @@ func listImplications(store *storage.Storage, tx *storage.Tx, colour bool) error
 	return nil
 }
 
+func formatImplications(store *storage.Storage, tx *storage.Tx, format *outputFormat) error {
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	records := make([]implicationRecord, len(implications))
+	for index, implication := range implications {
+		records[index] = implicationRecord{implication.ImplyingTag.Name, implication.ImplyingValue.Name, implication.ImpliedTag.Name, implication.ImpliedValue.Name}
+	}
+
+	return format.print(records)
+}
+
 func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
 	log.Infof(2, "loading settings")
 
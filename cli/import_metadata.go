@@ -0,0 +1,221 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/autotag"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/metadata"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"strings"
+)
+
+var ImportMetadataCommand = Command{
+	Name:     "import-metadata",
+	Synopsis: "Apply tags from embedded file metadata",
+	Usages: []string{"tmsu import-metadata [OPTION]... [PATH]...",
+		"tmsu import-metadata --fields FILE..."},
+	Description: `Applies tags to files from the metadata embedded within them: EXIF for JPEG and TIFF images, ID3 tags for MP3 audio, Vorbis comments for FLAC and Ogg audio and the document information of PDF documents.
+
+The files under each PATH are tagged, recursively, or every file in the database if no PATH is specified. Hidden files and directories are skipped unless specified explicitly. The 'tag' subcommand's --from-metadata option tags individual files in the same way.
+
+The metadataTags setting (see the 'config' subcommand) lists the fields to apply, each either as FIELD, to apply a tag of the same name, or as FIELD=TAG. The field's content becomes the tag's value, except for 'gps' which is applied without a value when a photograph has a location. The fields are:
+
+  album, artist, genre, title, track   audio
+  camera, gps                          images
+  author, creator, keywords,
+  producer, subject, title             documents
+  date, year                           all
+
+Use --fields to see the metadata fields of particular files.`,
+	Examples: []string{`$ tmsu config metadataTags="artist album=record year camera gps=geotagged"`,
+		`$ tmsu import-metadata --pretend music
+music/kind-of-blue/so-what.flac: artist=Miles\ Davis record=Kind\ of\ Blue year=1959`,
+		"$ tmsu import-metadata",
+		`$ tmsu import-metadata --fields IMG_0001.JPG
+IMG_0001.JPG: camera=Canon\ EOS\ 5D date=2017-06-01 gps year=2017`},
+	Options: Options{Option{"--fields", "-f", "lists the metadata fields of the files", false, false, ""},
+		Option{"--pretend", "-P", "lists the tags that would be applied without applying them", false, false, ""}},
+	Exec: importMetadataExec,
+}
+
+// unexported
+
+type metadataMapping struct {
+	field string
+	tag   string
+}
+
+func importMetadataExec(options Options, args []string, databasePath string) (error, warnings) {
+	if options.HasOption("--fields") {
+		if len(args) == 0 {
+			return fmt.Errorf("too few arguments"), nil
+		}
+
+		return listMetadataFields(args)
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	err, warnings := importMetadata(store, tx, args, true, false, false, options.HasOption("--pretend"))
+	completeTransaction(tx, err)
+
+	return err, warnings
+}
+
+func listMetadataFields(paths []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, path := range paths {
+		fields, err := metadata.Read(path)
+		if err != nil {
+			switch {
+			case os.IsPermission(err):
+				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+			case os.IsNotExist(err):
+				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+			default:
+				warnings = append(warnings, fmt.Sprintf("%v: could not read metadata: %v", path, err))
+			}
+			continue
+		}
+
+		tagArgs := make([]string, 0, len(fields))
+		for _, name := range fields.Names() {
+			if value := fields[name]; value != "" {
+				tagArgs = append(tagArgs, name+"="+value)
+			} else {
+				tagArgs = append(tagArgs, name)
+			}
+		}
+
+		if len(tagArgs) == 0 {
+			fmt.Printf("%v:\n", path)
+		} else {
+			fmt.Printf("%v: %v\n", path, autotag.FormatTags(tagArgs))
+		}
+	}
+
+	return nil, warnings
+}
+
+// Applies the tags from the embedded metadata of the files under the paths.
+func importMetadata(store *storage.Storage, tx *storage.Tx, paths []string, recursive, includeHidden, explicit, pretend bool) (error, warnings) {
+	log.Infof(2, "loading settings")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	mappings, err := parseMetadataMappings(settings.MetadataTags())
+	if err != nil {
+		return fmt.Errorf("invalid metadataTags setting: %v", err), nil
+	}
+	if len(mappings) == 0 {
+		return fmt.Errorf("no metadata fields are configured: see the metadataTags setting"), nil
+	}
+
+	autoTagger, err := newAutoTagger(store, tx, settings)
+	if err != nil {
+		return err, nil
+	}
+
+	tagsFor := func(path string, stat os.FileInfo) ([]string, error) {
+		if !stat.Mode().IsRegular() {
+			return nil, nil
+		}
+
+		fields, err := metadata.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read metadata: %v", err)
+		}
+
+		return metadataTagArgs(_path.Rel(path), fields, mappings), nil
+	}
+
+	return sweep(store, tx, settings, paths, recursive, includeHidden, explicit, pretend, tagsFor, autoTagger)
+}
+
+// Parses the metadataTags setting: a list of FIELD or FIELD=TAG.
+func parseMetadataMappings(text string) ([]metadataMapping, error) {
+	mappings := make([]metadataMapping, 0, 10)
+
+	for _, entry := range strings.Fields(text) {
+		field, tag := parseTagEqValueName(entry)
+		if tag == "" {
+			tag = field
+		}
+
+		if !metadata.IsField(field) {
+			return nil, fmt.Errorf("unknown metadata field '%v': must be one of %v", field, strings.Join(metadata.FieldNames, ", "))
+		}
+		if err := entities.ValidateTagName(tag); err != nil {
+			return nil, err
+		}
+
+		mappings = append(mappings, metadataMapping{field, tag})
+	}
+
+	return mappings, nil
+}
+
+// The tags for the fields of interest, skipping those whose content cannot be
+// a tag value.
+func metadataTagArgs(path string, fields metadata.Fields, mappings []metadataMapping) []string {
+	tagArgs := make([]string, 0, len(mappings))
+
+	for _, mapping := range mappings {
+		value, ok := fields[mapping.field]
+		if !ok {
+			continue
+		}
+
+		if !metadata.IsFlag(mapping.field) {
+			if err := entities.ValidateValueName(value); err != nil {
+				log.Warnf("%v: skipping %v '%v': %v", path, mapping.field, value, err)
+				continue
+			}
+		}
+
+		tagArgs = append(tagArgs, metadataTagArg(mapping.tag, value))
+	}
+
+	return tagArgs
+}
+
+func metadataTagArg(tagName, valueName string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, "=", `\=`)
+
+	if valueName == "" {
+		return escaper.Replace(tagName)
+	}
+
+	return escaper.Replace(tagName) + "=" + escaper.Replace(valueName)
+}
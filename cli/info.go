@@ -30,14 +30,36 @@ var InfoCommand = Command{
 	Usages:      []string{"tmsu info"},
 	Description: "Shows the database information.",
 	Options: Options{
-		Option{"--stats", "-s", "show statistics", false, ""},
-		Option{"--usage", "-u", "show tag usage breakdown", false, ""}},
+		Option{"--stats", "-s", "show statistics", false, false, ""},
+		Option{"--usage", "-u", "show tag usage breakdown", false, false, ""}},
 	Exec:    infoExec,
 	Aliases: []string{"stats"},
 }
 
 // unexported
 
+type infoRecord struct {
+	Database        string           `json:"database"`
+	RootPath        string           `json:"rootPath"`
+	Size            int64            `json:"size"`
+	Tags            *uint            `json:"tags,omitempty"`
+	Values          *uint            `json:"values,omitempty"`
+	Files           *uint            `json:"files,omitempty"`
+	Taggings        *uint            `json:"taggings,omitempty"`
+	MeanTagsPerFile *float32         `json:"meanTagsPerFile,omitempty"`
+	MeanFilesPerTag *float32         `json:"meanFilesPerTag,omitempty"`
+	Usage           []tagUsageRecord `json:"usage,omitempty"`
+}
+
+type tagUsageRecord struct {
+	Name      string `json:"name"`
+	FileCount uint   `json:"fileCount"`
+}
+
+func (record tagUsageRecord) String() string {
+	return fmt.Sprintf("%v=%v", escape(record.Name, '=', ','), record.FileCount)
+}
+
 func infoExec(options Options, args []string, databasePath string) (error, warnings) {
 	stats := options.HasOption("--stats")
 	usage := options.HasOption("--usage")
@@ -46,6 +68,11 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 		return err, nil
 	}
 
+	format, err := outputFormatFor(options)
+	if err != nil {
+		return err, nil
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -58,6 +85,10 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 	}
 	defer tx.Commit()
 
+	if format != nil {
+		return formatInfo(store, tx, stats, usage, format), nil
+	}
+
 	showBasic(store, tx, colour)
 
 	if stats {
@@ -84,44 +115,63 @@ func showBasic(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	return nil
 }
 
-func showStatistics(store *storage.Storage, tx *storage.Tx, colour bool) error {
-	tagCount, err := store.TagCount(tx)
+type databaseStatistics struct {
+	tagCount           uint
+	valueCount         uint
+	fileCount          uint
+	fileTagCount       uint
+	averageTagsPerFile float32
+	averageFilesPerTag float32
+}
+
+func statistics(store *storage.Storage, tx *storage.Tx) (databaseStatistics, error) {
+	var stats databaseStatistics
+	var err error
+
+	stats.tagCount, err = store.TagCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag count: %v", err)
+		return stats, fmt.Errorf("could not retrieve tag count: %v", err)
 	}
 
-	valueCount, err := store.ValueCount(tx)
+	stats.valueCount, err = store.ValueCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve value count: %v", err)
+		return stats, fmt.Errorf("could not retrieve value count: %v", err)
 	}
 
-	fileCount, err := store.FileCount(tx)
+	stats.fileCount, err = store.FileCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve file count: %v", err)
+		return stats, fmt.Errorf("could not retrieve file count: %v", err)
 	}
 
-	fileTagCount, err := store.FileTagCount(tx)
+	stats.fileTagCount, err = store.FileTagCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve taggings count: %v", err)
+		return stats, fmt.Errorf("could not retrieve taggings count: %v", err)
 	}
 
-	var averageTagsPerFile float32
-	if fileCount > 0 {
-		averageTagsPerFile = float32(fileTagCount) / float32(fileCount)
+	if stats.fileCount > 0 {
+		stats.averageTagsPerFile = float32(stats.fileTagCount) / float32(stats.fileCount)
 	}
 
-	var averageFilesPerTag float32
-	if tagCount > 0 {
-		averageFilesPerTag = float32(fileTagCount) / float32(tagCount)
+	if stats.tagCount > 0 {
+		stats.averageFilesPerTag = float32(stats.fileTagCount) / float32(stats.tagCount)
+	}
+
+	return stats, nil
+}
+
+func showStatistics(store *storage.Storage, tx *storage.Tx, colour bool) error {
+	stats, err := statistics(store, tx)
+	if err != nil {
+		return err
 	}
 
 	fmt.Println()
-	printInfo("Tags", tagCount, colour)
-	printInfo("Values", valueCount, colour)
-	printInfo("Files", fileCount, colour)
-	printInfo("Taggings", fileTagCount, colour)
-	printInfof("Mean tags per file", "%1.2f", averageTagsPerFile, colour)
-	printInfof("Mean files per tag", "%1.2f", averageFilesPerTag, colour)
+	printInfo("Tags", stats.tagCount, colour)
+	printInfo("Values", stats.valueCount, colour)
+	printInfo("Files", stats.fileCount, colour)
+	printInfo("Taggings", stats.fileTagCount, colour)
+	printInfof("Mean tags per file", "%1.2f", stats.averageTagsPerFile, colour)
+	printInfof("Mean files per tag", "%1.2f", stats.averageFilesPerTag, colour)
 
 	return nil
 }
@@ -158,6 +208,43 @@ func showUsage(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	return nil
 }
 
+func formatInfo(store *storage.Storage, tx *storage.Tx, stats, usage bool, format *outputFormat) error {
+	stat, err := os.Stat(store.DbPath)
+	if err != nil {
+		return err
+	}
+
+	record := infoRecord{Database: store.DbPath, RootPath: store.RootPath, Size: stat.Size()}
+
+	if stats {
+		databaseStats, err := statistics(store, tx)
+		if err != nil {
+			return err
+		}
+
+		record.Tags = &databaseStats.tagCount
+		record.Values = &databaseStats.valueCount
+		record.Files = &databaseStats.fileCount
+		record.Taggings = &databaseStats.fileTagCount
+		record.MeanTagsPerFile = &databaseStats.averageTagsPerFile
+		record.MeanFilesPerTag = &databaseStats.averageFilesPerTag
+	}
+
+	if usage {
+		tagUsages, err := store.TagUsage(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag usage: %v", err)
+		}
+
+		record.Usage = make([]tagUsageRecord, len(tagUsages))
+		for index, tagUsage := range tagUsages {
+			record.Usage[index] = tagUsageRecord{tagUsage.Name, tagUsage.FileCount}
+		}
+	}
+
+	return format.print(record)
+}
+
 func printInfo(name string, value interface{}, colour bool) {
 	printInfof(name, "%v", value, colour)
 }
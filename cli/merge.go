@@ -28,7 +28,7 @@ var MergeCommand = Command{
 	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.`,
 	Examples: []string{`$ tmsu merge cehese cheese`,
 		`$ tmsu merge outdoors outdoor outside`},
-	Options: Options{Option{"--value", "", "merge values", false, ""}},
+	Options: Options{Option{"--value", "", "merge values", false, false, ""}},
 	Exec:    mergeExec,
 }
 
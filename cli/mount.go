@@ -20,6 +20,7 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/vfs"
 	"io/ioutil"
 	"os"
@@ -42,12 +43,21 @@ Where neither --database is specified nor TMSU_DB defined then the default datab
 
 To allow other users access to the mounted filesystem, pass the 'allow_other' FUSE option, e.g. 'tmsu mount --options=allow_other mp'. (FUSE only allows the root user to use this option unless 'user_allow_other' is present in '/etc/fuse.conf'.)
 
+The --read-only option prevents the database from being changed through the virtual filesystem. The --where option restricts the virtual filesystem to the files matching QUERY: other files, and the tags and values not applied to the matching files, are hidden and tags can neither be created, renamed nor deleted.
+
+Operations that fail, for example because the database is locked by another process for too long, report an error to the program using the virtual filesystem rather than stopping it. The most recent failures can be read from the '.errors' file at the root of the mount.
+
+The root of the mount also holds the read-only files '.stats', showing the statistics reported by 'tmsu info --stats', and '.missing', listing the tagged files that no longer exist.
+
 For further documentation on the usage of the --database option, refer to 'tmsu help', without specifying a subcommand`,
 	Examples: []string{"$ tmsu mount mp",
 		"$ tmsu mount --database=/tmp/db mp",
-		"$ tmsu mount --options=allow_other mp"},
-	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""}},
-	Exec:    mountExec,
+		"$ tmsu mount --options=allow_other mp",
+		"$ tmsu mount --read-only --where='public and not confidential' --options=allow_other mp"},
+	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, false, ""},
+		Option{"--read-only", "-r", "mount the virtual filesystem read-only", false, false, ""},
+		Option{"--where", "-w", "show only the files matching QUERY", true, false, ""}},
+	Exec: mountExec,
 }
 
 // unexported
@@ -58,6 +68,17 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 		mountOptions = options.Get("--options").Argument
 	}
 
+	readOnly := options.HasOption("--read-only")
+
+	var where string
+	if options.HasOption("--where") {
+		where = options.Get("--where").Argument
+
+		if _, err := query.Parse(where); err != nil {
+			return fmt.Errorf("could not parse query: %v", err), nil
+		}
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -78,14 +99,14 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 	case 1:
 		mountPath := args[0]
 
-		if err := mountExplicit(store.DbPath, mountPath, mountOptions); err != nil {
+		if err := mountExplicit(store.DbPath, mountPath, mountOptions, readOnly, where); err != nil {
 			return err, nil
 		}
 	case 2:
 		databasePath := args[0]
 		mountPath := args[1]
 
-		if err := mountExplicit(databasePath, mountPath, mountOptions); err != nil {
+		if err := mountExplicit(databasePath, mountPath, mountOptions, readOnly, where); err != nil {
 			return err, nil
 		}
 	default:
@@ -121,7 +142,7 @@ func listMounts() error {
 	return nil
 }
 
-func mountExplicit(databasePath string, mountPath string, mountOptions string) error {
+func mountExplicit(databasePath string, mountPath string, mountOptions string, readOnly bool, where string) error {
 	if alreadyMounted(mountPath) {
 		return fmt.Errorf("%v: mount path already in use", mountPath)
 	}
@@ -148,6 +169,12 @@ func mountExplicit(databasePath string, mountPath string, mountOptions string) e
 	log.Infof(2, "spawning daemon to mount VFS for database '%v' at '%v'", databasePath, mountPath)
 
 	args := []string{"vfs", "--database=" + databasePath, mountPath, "--options=" + mountOptions}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	if where != "" {
+		args = append(args, "--where="+where)
+	}
 	daemon := exec.Command(os.Args[0], args...)
 
 	tempFile, err := ioutil.TempFile("", "tmsu-vfs-")
@@ -21,11 +21,12 @@ import (
 )
 
 type Option struct {
-	LongName    string
-	ShortName   string
-	Description string
-	HasArgument bool
-	Argument    string
+	LongName         string
+	ShortName        string
+	Description      string
+	HasArgument      bool
+	OptionalArgument bool
+	Argument         string
 }
 
 type Options []Option
@@ -116,6 +117,13 @@ func (parser *OptionParser) Parse(args ...string) (command *Command, options Opt
 						option.Argument = args[index+1]
 						index++
 					}
+				} else if len(parts) == 2 {
+					if !option.OptionalArgument {
+						err = fmt.Errorf("option '%v' does not take an argument", optionName)
+						return
+					}
+
+					option.Argument = parts[1]
 				}
 
 				options = append(options, *option)
@@ -159,7 +167,7 @@ func buildCommandByNameMap(commands []*Command) map[string]*Command {
 func lookupOption(options Options, name string) *Option {
 	for _, option := range options {
 		if option.ShortName == name || option.LongName == name {
-			return &Option{option.LongName, option.ShortName, option.Description, option.HasArgument, ""}
+			return &Option{option.LongName, option.ShortName, option.Description, option.HasArgument, option.OptionalArgument, ""}
 		}
 	}
 
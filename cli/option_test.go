@@ -41,7 +41,7 @@ func TestParseVanillaArguments(test *testing.T) {
 }
 
 func TestParseGlobalOptions(test *testing.T) {
-	parser := NewOptionParser(Options{Option{"--verbose", "-v", "verbose", false, ""}}, []*Command{{Name: "a"}})
+	parser := NewOptionParser(Options{Option{"--verbose", "-v", "verbose", false, false, ""}}, []*Command{{Name: "a"}})
 
 	command, options, arguments, err := parser.Parse("--verbose", "a", "b")
 	if err != nil {
@@ -76,3 +76,41 @@ func TestInvalidGlobalOption(test *testing.T) {
 		test.Fatal("Invalid option not identified.")
 	}
 }
+
+func TestParseOptionalArgument(test *testing.T) {
+	parser := NewOptionParser(Options{}, []*Command{{Name: "a", Options: Options{Option{"--similar", "-s", "similar", false, true, ""}}}})
+
+	_, options, arguments, err := parser.Parse("a", "--similar=5", "b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !options.HasOption("--similar") {
+		test.Fatal("Expected option '--similar' to be present.")
+	}
+	if options.Get("--similar").Argument != "5" {
+		test.Fatalf("Expected option argument of '5' but was '%v'.", options.Get("--similar").Argument)
+	}
+	if len(arguments) != 1 || arguments[0] != "b" {
+		test.Fatalf("Expected argument of 'b' but were '%v'.", arguments)
+	}
+
+	_, options, arguments, err = parser.Parse("a", "--similar", "b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if options.Get("--similar").Argument != "" {
+		test.Fatalf("Expected no option argument but was '%v'.", options.Get("--similar").Argument)
+	}
+	if len(arguments) != 1 || arguments[0] != "b" {
+		test.Fatalf("Expected argument of 'b' but were '%v'.", arguments)
+	}
+}
+
+func TestUnexpectedOptionArgument(test *testing.T) {
+	parser := NewOptionParser(Options{}, []*Command{{Name: "a", Options: Options{Option{"--recursive", "-r", "recursive", false, false, ""}}}})
+
+	_, _, _, err := parser.Parse("a", "--recursive=false", "b")
+	if err == nil {
+		test.Fatal("Unexpected option argument not identified.")
+	}
+}
@@ -31,7 +31,7 @@ var RenameCommand = Command{
 Attempting to rename a tag or value with a name that already exists will result in an error. To merge tags or values use the 'merge' subcommand instead.`,
 	Examples: []string{"$ tmsu rename montain mountain",
 		"$ tmsu rename --value MMXVII 2017"},
-	Options: Options{{"--value", "", "rename a value", false, ""}},
+	Options: Options{{"--value", "", "rename a value", false, false, ""}},
 	Exec:    renameExec,
 }
 
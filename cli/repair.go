@@ -42,17 +42,19 @@ An attempt is made to find missing files under PATHs specified. If a file with t
 
 Files that have been both moved and modified cannot be repaired and must be manually relocated.
 
+The fingerprints of unmodified files are recalculated when the --unmodified option is specified. This can be used to migrate the database to a different fingerprint algorithm after changing the 'fileFingerprintAlgorithm' setting. (Missing files cannot be located by fingerprint until this has been done.)
+
 When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. Any affected files' fingerprints are updated providing the file exists at the new location. No further repairs are attempted in this mode.`,
 	Examples: []string{"$ tmsu repair",
 		"$ tmsu repair /new/path  # look for missing files here",
 		"$ tmsu repair --path=/home/sally  # repair subset of database",
 		"$ tmsu repair --manual /home/bob /home/fred  # manually repair paths"},
-	Options: Options{{"--path", "-p", "limit repair to files in database under path", true, ""},
-		{"--pretend", "-P", "do not make any changes", false, ""},
-		{"--remove", "-R", "remove missing files from the database", false, ""},
-		{"--manual", "-m", "manually relocate files", false, ""},
-		{"--unmodified", "-u", "recalculate fingerprints for unmodified files", false, ""},
-		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""}},
+	Options: Options{{"--path", "-p", "limit repair to files in database under path", true, false, ""},
+		{"--pretend", "-P", "do not make any changes", false, false, ""},
+		{"--remove", "-R", "remove missing files from the database", false, false, ""},
+		{"--manual", "-m", "manually relocate files", false, false, ""},
+		{"--unmodified", "-u", "recalculate fingerprints for unmodified files", false, false, ""},
+		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, false, ""}},
 	Exec: repairExec,
 }
 
@@ -71,19 +73,23 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 	if err != nil {
 		return err, nil
 	}
-	defer tx.Commit()
 
+	err = repairWithOptions(store, tx, options, args, pretend)
+	completeTransaction(tx, err)
+
+	return err, nil
+}
+
+func repairWithOptions(store *storage.Storage, tx *storage.Tx, options Options, args []string, pretend bool) error {
 	if options.HasOption("--manual") {
 		if len(args) < 2 {
-			return errors.New("too few arguments"), nil
+			return errors.New("too few arguments")
 		}
 
 		fromPath := args[0]
 		toPath := args[1]
 
-		if err := manualRepair(store, tx, fromPath, toPath, pretend); err != nil {
-			return err, nil
-		}
+		return manualRepair(store, tx, fromPath, toPath, pretend)
 	} else {
 		searchPaths := args
 		removeMissing := options.HasOption("--remove")
@@ -95,12 +101,8 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 			limitPath = options.Get("--path").Argument
 		}
 
-		if err := fullRepair(store, tx, searchPaths, limitPath, removeMissing, recalcUnmodified, rationalize, pretend); err != nil {
-			return err, nil
-		}
+		return fullRepair(store, tx, searchPaths, limitPath, removeMissing, recalcUnmodified, rationalize, pretend)
 	}
-
-	return nil, nil
 }
 
 func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath string, pretend bool) error {
@@ -114,6 +116,16 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 		return fmt.Errorf("%v: could not determine absolute path", err)
 	}
 
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	fingerprinter := newFingerprinter(store, tx, settings)
+	if pretend {
+		fingerprinter.readOnly()
+	}
+
 	log.Infof(2, "retrieving files under '%v' from the database", fromPath)
 
 	dbFile, err := store.FileByPath(tx, absFromPath)
@@ -125,7 +137,7 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 		log.Infof(2, "%v: updating to %v", fromPath, toPath)
 
 		if !pretend {
-			if err := manualRepairFile(store, tx, dbFile, absToPath); err != nil {
+			if err := manualRepairFile(store, tx, dbFile, absToPath, fingerprinter); err != nil {
 				return err
 			}
 		}
@@ -136,6 +148,17 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 		return fmt.Errorf("could not retrieve files from storage: %v", err)
 	}
 
+	if !pretend {
+		toPaths := make([]string, len(dbFiles))
+		for index, dbFile := range dbFiles {
+			toPaths[index] = strings.Replace(dbFile.Path(), absFromPath, absToPath, 1)
+		}
+
+		if err := fingerprinter.calculate(toPaths); err != nil {
+			return err
+		}
+	}
+
 	for _, dbFile = range dbFiles {
 		relFileFromPath := _path.Rel(dbFile.Path())
 		absFileToPath := strings.Replace(dbFile.Path(), absFromPath, absToPath, 1)
@@ -144,7 +167,7 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 		log.Infof(2, "%v: updating to %v", relFileFromPath, relFileToPath)
 
 		if !pretend {
-			if err := manualRepairFile(store, tx, dbFile, absFileToPath); err != nil {
+			if err := manualRepairFile(store, tx, dbFile, absFileToPath, fingerprinter); err != nil {
 				return err
 			}
 		}
@@ -153,7 +176,7 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 	return nil
 }
 
-func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.File, toPath string) error {
+func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.File, toPath string, fingerprinter *fingerprinter) error {
 	stat, err := os.Stat(toPath)
 	if err != nil {
 		switch {
@@ -165,24 +188,24 @@ func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.Fil
 			return err
 		}
 	} else {
-		settings, err := store.Settings(tx)
-		if err != nil {
-			return err
-		}
-
-		fingerprint, err := fingerprint.Create(toPath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		fingerprint, err := fingerprinter.create(toPath)
+		fingerprintAlgorithm := fingerprinter.fileAlgorithm
 		if err != nil {
 			log.Warnf("%v: could not create fingerprint: %v", toPath, err)
 			fingerprint = file.Fingerprint
+			fingerprintAlgorithm = file.FingerprintAlgorithm
 		}
 
 		modTime := stat.ModTime()
 		size := stat.Size()
 		isDir := stat.IsDir()
 
-		_, err = store.UpdateFile(tx, file.Id, toPath, fingerprint, modTime, size, isDir)
+		file, err = store.UpdateFile(tx, file.Id, toPath, fingerprint, fingerprintAlgorithm, modTime, size, isDir)
+		if err != nil {
+			return err
+		}
 
-		return err
+		return fingerprinter.updateImage(store, tx, file)
 	}
 }
 
@@ -221,17 +244,26 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 
 	unmodfied, modified, missing := determineStatuses(dbFiles)
 
+	fingerprinter := newFingerprinter(store, tx, settings)
+	if pretend {
+		fingerprinter.readOnly()
+	}
+	if !recalcUnmodified {
+		// only reuses stored fingerprints created by the current algorithm
+		fingerprinter.useStored()
+	}
+
 	if recalcUnmodified {
-		if err = repairUnmodified(store, tx, unmodfied, pretend, settings); err != nil {
+		if err = repairUnmodified(store, tx, unmodfied, pretend, fingerprinter); err != nil {
 			return err
 		}
 	}
 
-	if err = repairModified(store, tx, modified, pretend, settings); err != nil {
+	if err = repairModified(store, tx, modified, pretend, fingerprinter); err != nil {
 		return err
 	}
 
-	if err = repairMoved(store, tx, missing, searchPaths, pretend, settings); err != nil {
+	if err = repairMoved(store, tx, missing, searchPaths, pretend, fingerprinter); err != nil {
 		return err
 	}
 
@@ -318,29 +350,79 @@ func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing en
 		}
 	}
 
+	unmodified, modified = modifiedDirectories(unmodified, modified, missing)
+
 	return
 }
 
-func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, settings entities.Settings) error {
+// Treats as modified those unmodified directories that contain modified or
+// missing files, as their fingerprints may depend upon their contents.
+func modifiedDirectories(unmodified, modified, missing entities.Files) (entities.Files, entities.Files) {
+	changedPaths := make([]string, 0, len(modified)+len(missing))
+	for _, dbFile := range modified {
+		changedPaths = append(changedPaths, dbFile.Path())
+	}
+	for _, dbFile := range missing {
+		changedPaths = append(changedPaths, dbFile.Path())
+	}
+
+	if len(changedPaths) == 0 {
+		return unmodified, modified
+	}
+
+	stillUnmodified := make(entities.Files, 0, len(unmodified))
+	for _, dbFile := range unmodified {
+		if dbFile.IsDir && containsAny(dbFile.Path(), changedPaths) {
+			log.Infof(2, "%v: contents modified", dbFile.Path())
+			modified = append(modified, dbFile)
+		} else {
+			stillUnmodified = append(stillUnmodified, dbFile)
+		}
+	}
+
+	return stillUnmodified, modified
+}
+
+func containsAny(dirPath string, paths []string) bool {
+	prefix := dirPath + string(filepath.Separator)
+
+	for _, path := range paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, fingerprinter *fingerprinter) error {
 	log.Infof(2, "recalculating fingerprints for unmodified files")
 
+	if err := fingerprinter.calculate(unmodified.Paths()); err != nil {
+		return err
+	}
+
 	for _, dbFile := range unmodified {
 		stat, err := os.Stat(dbFile.Path())
 		if err != nil {
 			return err
 		}
 
-		fingerprint, err := fingerprint.Create(dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		fingerprint, err := fingerprinter.create(dbFile.Path())
 		if err != nil {
 			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
 			continue
 		}
 
 		if !pretend {
-			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, fingerprinter.fileAlgorithm, stat.ModTime(), stat.Size(), stat.IsDir())
 			if err != nil {
 				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
 			}
+
+			if err := fingerprinter.updateImage(store, tx, dbFile); err != nil {
+				return err
+			}
 		}
 
 		fmt.Printf("%v: recalculated fingerprint\n", dbFile.Path())
@@ -349,26 +431,34 @@ func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entitie
 	return nil
 }
 
-func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, pretend bool, settings entities.Settings) error {
+func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, pretend bool, fingerprinter *fingerprinter) error {
 	log.Infof(2, "repairing modified files")
 
+	if err := fingerprinter.calculate(modified.Paths()); err != nil {
+		return err
+	}
+
 	for _, dbFile := range modified {
 		stat, err := os.Stat(dbFile.Path())
 		if err != nil {
 			return err
 		}
 
-		fingerprint, err := fingerprint.Create(dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		fingerprint, err := fingerprinter.create(dbFile.Path())
 		if err != nil {
 			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
 			continue
 		}
 
 		if !pretend {
-			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, fingerprinter.fileAlgorithm, stat.ModTime(), stat.Size(), stat.IsDir())
 			if err != nil {
 				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
 			}
+
+			if err := fingerprinter.updateImage(store, tx, dbFile); err != nil {
+				return err
+			}
 		}
 
 		fmt.Printf("%v: updated fingerprint\n", dbFile.Path())
@@ -377,7 +467,7 @@ func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Fi
 	return nil
 }
 
-func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pretend bool, settings entities.Settings) error {
+func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pretend bool, fingerprinter *fingerprinter) error {
 	log.Infof(2, "repairing moved files")
 
 	if len(missing) == 0 || len(searchPaths) == 0 {
@@ -385,18 +475,26 @@ func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files,
 		return nil
 	}
 
-	pathsBySize, err := buildPathBySizeMap(searchPaths)
+	pathsBySize, dirPaths, err := buildPathBySizeMap(searchPaths)
 	if err != nil {
 		return err
 	}
 
+	if err := calculateCandidateFingerprints(store, tx, missing, pathsBySize, dirPaths, fingerprinter); err != nil {
+		return err
+	}
+
 	for index, dbFile := range missing {
 		log.Infof(2, "%v: searching for new location", dbFile.Path())
 
-		pathsOfSize := pathsBySize[dbFile.Size]
-		log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
+		candidatePaths := movedCandidatePaths(dbFile, pathsBySize, dirPaths)
+		if dbFile.IsDir {
+			log.Infof(2, "%v: directory, identified %v directories", dbFile.Path(), len(candidatePaths))
+		} else {
+			log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(candidatePaths))
+		}
 
-		for _, candidatePath := range pathsOfSize {
+		for _, candidatePath := range candidatePaths {
 			candidateFile, err := store.FileByPath(tx, candidatePath)
 			if err != nil {
 				return err
@@ -410,15 +508,22 @@ func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files,
 			if err != nil {
 				return fmt.Errorf("%v: could not stat file: %v", candidatePath, err)
 			}
+			if stat.IsDir() != dbFile.IsDir {
+				continue
+			}
+			if dbFile.IsDir && dbFile.Fingerprint == fingerprint.Empty {
+				// directory fingerprinting is disabled
+				continue
+			}
 
-			fingerprint, err := fingerprint.Create(candidatePath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+			fingerprint, err := fingerprinter.create(candidatePath)
 			if err != nil {
 				return fmt.Errorf("%v: could not create fingerprint: %v", candidatePath, err)
 			}
 
 			if fingerprint == dbFile.Fingerprint {
 				if !pretend {
-					_, err := store.UpdateFile(tx, dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
+					_, err := store.UpdateFile(tx, dbFile.Id, candidatePath, dbFile.Fingerprint, fingerprinter.fileAlgorithm, stat.ModTime(), dbFile.Size, dbFile.IsDir)
 					if err != nil {
 						return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
 					}
@@ -436,6 +541,46 @@ func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files,
 	return nil
 }
 
+// Calculates, up-front, the fingerprints of the untagged files that could be the missing files
+func calculateCandidateFingerprints(store *storage.Storage, tx *storage.Tx, missing entities.Files, pathsBySize map[int64][]string, dirPaths []string, fingerprinter *fingerprinter) error {
+	candidatePaths := make([]string, 0, len(missing))
+	seen := make(map[string]bool)
+
+	for _, dbFile := range missing {
+		if dbFile.IsDir && dbFile.Fingerprint == fingerprint.Empty {
+			// directory fingerprinting is disabled
+			continue
+		}
+
+		for _, candidatePath := range movedCandidatePaths(dbFile, pathsBySize, dirPaths) {
+			if seen[candidatePath] {
+				continue
+			}
+			seen[candidatePath] = true
+
+			candidateFile, err := store.FileByPath(tx, candidatePath)
+			if err != nil {
+				return err
+			}
+			if candidateFile == nil {
+				candidatePaths = append(candidatePaths, candidatePath)
+			}
+		}
+	}
+
+	return fingerprinter.calculate(candidatePaths)
+}
+
+// The paths that could be the new location of the missing file: directories,
+// whose sizes depend upon the filesystem, are matched by fingerprint alone.
+func movedCandidatePaths(dbFile *entities.File, pathsBySize map[int64][]string, dirPaths []string) []string {
+	if dbFile.IsDir {
+		return dirPaths
+	}
+
+	return pathsBySize[dbFile.Size]
+}
+
 func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.Files, pretend, force bool) error {
 	for _, dbFile := range missing {
 		if dbFile == nil {
@@ -458,23 +603,24 @@ func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.File
 	return nil
 }
 
-func buildPathBySizeMap(paths []string) (map[int64][]string, error) {
+func buildPathBySizeMap(paths []string) (map[int64][]string, []string, error) {
 	log.Infof(2, "building map of paths by size")
 
 	pathsBySize := make(map[int64][]string, 10)
+	dirPaths := make([]string, 0, 10)
 
 	for _, path := range paths {
-		if err := buildPathBySizeMapRecursive(path, pathsBySize); err != nil {
-			return nil, err
+		if err := buildPathBySizeMapRecursive(path, pathsBySize, &dirPaths); err != nil {
+			return nil, nil, err
 		}
 	}
 
 	log.Infof(2, "path by size map has %v sizes", len(pathsBySize))
 
-	return pathsBySize, nil
+	return pathsBySize, dirPaths, nil
 }
 
-func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string) error {
+func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string, dirPaths *[]string) error {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("%v: could not get absolute path", path)
@@ -491,6 +637,8 @@ func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string)
 	}
 
 	if stat.IsDir() {
+		*dirPaths = append(*dirPaths, absPath)
+
 		log.Infof(3, "%v: examining directory contents", absPath)
 
 		dir, err := os.Open(absPath)
@@ -506,7 +654,7 @@ func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string)
 
 		for _, name := range names {
 			childPath := filepath.Join(path, name)
-			if err := buildPathBySizeMapRecursive(childPath, pathBySizeMap); err != nil {
+			if err := buildPathBySizeMapRecursive(childPath, pathBySizeMap, dirPaths); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,177 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/api"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/query"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ServeCommand = Command{
+	Name:     "serve",
+	Synopsis: "Serve the database over the network",
+	Usages: []string{"tmsu serve [OPTION]... --http=ADDR",
+		"tmsu serve [OPTION]... --webdav=ADDR"},
+	Description: `Serves the database as a REST API, with JSON responses, over HTTP (--http) and/or the tags and queries hierarchy of the virtual filesystem over WebDAV (--webdav), each at its own address ADDR. The command runs until interrupted.
+
+ADDR is of the form HOST:PORT. If the host is omitted, such as ':8080' or '8080', the server binds to 'localhost' so that it is only reachable from this machine: specify '0.0.0.0:8080' to listen on all interfaces.
+
+The REST API provides the following resources:
+
+  /files                     GET lists the files, or those matching the query
+                             in the 'query' parameter. POST adds the file
+                             {"path": "/abs/path", "tags": [{"tag": "t",
+                             "value": "v"}]}.
+  /files/ID                  GET retrieves the file and its tags.
+  /files/ID/tags             POST applies {"tags": [...]} to the file.
+  /files/ID/tags/TAG         DELETE removes the tag, with the value in the
+                             'value' parameter, from the file.
+  /tags, /values             GET lists, POST creates {"name": "n"}.
+  /tags/TAG, /values/VALUE   GET retrieves, PUT renames {"name": "n"}, DELETE
+                             deletes.
+  /tags/TAG/values           GET lists the values used with the tag.
+  /implications              GET lists, POST adds and DELETE deletes
+                             {"implying": {"tag": "t"}, "implied": {...}}.
+  /queries                   GET lists, POST saves {"text": "query"}.
+  /queries/TEXT              DELETE deletes the saved query.
+
+Request bodies must be sent with the Content-Type 'application/json'. Lists are paged by the 'page' and 'perPage' (default 100, maximum 1000) parameters and are returned as {"items": [...], "page": 1, "perPage": 100, "total": 250}. Responses carry an ETag and requests with a matching If-None-Match header are answered with 304 Not Modified. Errors are returned as {"error": "message"} with an appropriate status code.
+
+As WebDAV has no symbolic links, the files in the WebDAV hierarchy are served as the tagged files themselves, which cannot be changed. Directories are created, renamed and deleted as with the virtual filesystem whilst moving or deleting a file retags or untags it. To tag a file, upload a file containing the absolute path of the file to tag to the tag directory. The --where option restricts the WebDAV hierarchy in the same way as for the 'mount' subcommand.
+
+Only the files within the database root, or within the directories listed by the --allow option (separated by colons), can be added to the database over either protocol or read over WebDAV. As any client can otherwise tag and then read these files, a token must be specified to serve without --read-only.
+
+If a token is specified, with the --token option or the TMSU_TOKEN environment variable, clients must supply it either as a bearer token or as the password for HTTP basic authentication. The token is sent in the clear: use a reverse proxy to provide HTTPS where the server is reachable by others.`,
+	Examples: []string{"$ tmsu serve --http=8080 --read-only",
+		"$ curl 'http://localhost:8080/files?query=music+and+year>2000'",
+		"$ TMSU_TOKEN=secret tmsu serve --http=0.0.0.0:8080 --read-only",
+		"$ curl -H 'Authorization: Bearer secret' http://myhost:8080/tags",
+		"$ tmsu serve --webdav=localhost:8081 --token=secret --allow=/home/bob/photos",
+		"$ echo /home/bob/photos/beach.jpg | curl -u :secret -T - http://localhost:8081/tags/holiday/beach.jpg"},
+	Options: Options{Option{"--http", "", "serve the REST API at ADDR", true, false, ""},
+		Option{"--webdav", "", "serve the virtual filesystem over WebDAV at ADDR", true, false, ""},
+		Option{"--read-only", "-r", "serve the database read-only", false, false, ""},
+		Option{"--token", "-t", "require clients to supply TOKEN", true, false, ""},
+		Option{"--where", "-w", "serve only the files matching QUERY over WebDAV", true, false, ""},
+		Option{"--allow", "-a", "allow only the files within PATHS", true, false, ""}},
+	Exec: serveExec,
+}
+
+// unexported
+
+func serveExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+
+	if !options.HasOption("--http") && !options.HasOption("--webdav") {
+		return fmt.Errorf("server address not specified"), nil
+	}
+
+	readOnly := options.HasOption("--read-only")
+
+	token := os.Getenv("TMSU_TOKEN")
+	if options.HasOption("--token") {
+		token = options.Get("--token").Argument
+	}
+
+	if !readOnly && token == "" {
+		return fmt.Errorf("a token must be specified to serve without --read-only"), nil
+	}
+
+	var allowedPaths []string
+	if options.HasOption("--allow") {
+		allowedPaths = filepath.SplitList(options.Get("--allow").Argument)
+		for _, allowedPath := range allowedPaths {
+			if _, err := _path.Resolve(allowedPath); err != nil {
+				return fmt.Errorf("%v: could not resolve allowed path: %v", allowedPath, err), nil
+			}
+		}
+	}
+
+	var where query.Expression
+	if options.HasOption("--where") {
+		expression, err := query.Parse(options.Get("--where").Argument)
+		if err != nil {
+			return fmt.Errorf("could not parse query: %v", err), nil
+		}
+
+		where = expression
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	servers := make(map[string]http.Handler, 2)
+
+	if options.HasOption("--http") {
+		servers["HTTP"] = api.NewHandler(store, readOnly, allowedPaths)
+	}
+
+	if options.HasOption("--webdav") {
+		handler, err := webDavHandler(store, readOnly, where, allowedPaths)
+		if err != nil {
+			return err, nil
+		}
+
+		servers["WebDAV"] = handler
+	}
+
+	errors := make(chan error, len(servers))
+	for protocol, handler := range servers {
+		address := listenAddress(options.Get("--" + strings.ToLower(protocol)).Argument)
+
+		if token != "" {
+			handler = api.Authenticate(token, handler)
+		}
+
+		log.Infof(1, "serving %v at %v", protocol, address)
+
+		go func(protocol, address string, handler http.Handler) {
+			if err := http.ListenAndServe(address, handler); err != nil {
+				errors <- fmt.Errorf("could not serve %v at '%v': %v", protocol, address, err)
+			}
+		}(protocol, address, handler)
+	}
+
+	return <-errors, nil
+}
+
+// Binds addresses without a host, such as ':8080' or '8080', to the loopback
+// interface.
+func listenAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return net.JoinHostPort("localhost", address)
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, port)
+}
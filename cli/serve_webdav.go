@@ -0,0 +1,31 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/vfs"
+	"net/http"
+)
+
+// unexported
+
+func webDavHandler(store *storage.Storage, readOnly bool, where query.Expression, allowedPaths []string) (http.Handler, error) {
+	return vfs.NewWebDavHandler(store, readOnly, where, allowedPaths), nil
+}
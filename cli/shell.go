@@ -0,0 +1,270 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+	"github.com/peterh/liner"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ShellCommand = Command{
+	Name:     "shell",
+	Synopsis: "Run subcommands interactively",
+	Usages:   []string{"tmsu shell"},
+	Description: `Starts an interactive session in which subcommands are entered without the 'tmsu' prefix. The database is opened once for the whole session, which makes running many subcommands, such as when tagging files in bulk, quicker.
+
+Commands are quoted and escaped as in the shell. The Tab key completes subcommand names, options, tags, values (after 'TAG=') and paths whilst the Up and Down keys recall previous commands, which are kept in 'shell_history' alongside the database.
+
+Enter 'exit', 'quit' or Ctrl+D to end the session.`,
+	Examples: []string{"$ tmsu shell\ntmsu> tag holiday.jpg beach year=2017\ntmsu> files beach\nholiday.jpg\ntmsu> exit"},
+	Options:  Options{},
+	Exec:     shellExec,
+}
+
+// unexported
+
+const shellPrompt = "tmsu> "
+
+var shellCommands []*Command
+
+func shellExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments"), nil
+	}
+	if sharedStore != nil {
+		return fmt.Errorf("cannot start a shell within a shell or batch"), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	sharedStore = store
+	defer func() { sharedStore = nil }()
+
+	line := liner.NewLiner()
+	defer line.Close()
+
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(func(input string, pos int) (string, []string, string) {
+		return completeShellWord(store, input, pos)
+	})
+
+	historyPath := filepath.Join(filepath.Dir(databasePath), "shell_history")
+	if file, err := os.Open(historyPath); err == nil {
+		line.ReadHistory(file)
+		file.Close()
+	}
+
+	for {
+		input, err := line.Prompt(shellPrompt)
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err == io.EOF {
+			fmt.Println()
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read command: %v", err), nil
+		}
+
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		line.AppendHistory(input)
+
+		tokens := text.Tokenize(input)
+		if len(tokens) == 1 && (tokens[0] == "exit" || tokens[0] == "quit") {
+			break
+		}
+
+		err, warnings := runSubcommand(tokens, databasePath)
+
+		for _, warning := range warnings {
+			log.Warn(warning)
+		}
+
+		if err != nil {
+			log.Warn(err.Error())
+		}
+	}
+
+	if file, err := os.Create(historyPath); err == nil {
+		line.WriteHistory(file)
+		file.Close()
+	} else {
+		log.Warnf("could not save shell history: %v", err)
+	}
+
+	return nil, nil
+}
+
+// Runs a subcommand entered in a shell or batch, returning rather than
+// reporting its failure. The excluded subcommands are refused.
+func runSubcommand(tokens []string, databasePath string, excluded ...string) (error, warnings) {
+	parser := NewOptionParser(globalOptions, shellCommands)
+	command, options, arguments, err := parser.Parse(tokens...)
+	if err != nil {
+		return err, nil
+	}
+
+	switch {
+	case options.HasOption("--version"):
+		command = findCommand(shellCommands, "version")
+	case options.HasOption("--help"), command == nil:
+		command = findCommand(shellCommands, "help")
+	}
+
+	for _, name := range excluded {
+		if command.Name == name {
+			return fmt.Errorf("the '%v' subcommand cannot be run here", name), nil
+		}
+	}
+
+	// the subcommand's --verbose options raise, but never lower, the level the
+	// shell was started with
+	verbosity := log.Verbosity
+	if level := options.Count("--verbose") + 1; level > verbosity {
+		log.Verbosity = level
+	}
+	defer func() { log.Verbosity = verbosity }()
+
+	if options.HasOption("--database") {
+		databasePath = options.Get("--database").Argument
+	}
+
+	return command.Exec(options, arguments, databasePath)
+}
+
+// Completes the word at pos, which is a subcommand name if it is the first word
+// or else an option, tag, value or path.
+func completeShellWord(store *storage.Storage, input string, pos int) (string, []string, string) {
+	start := pos
+	for start > 0 && (input[start-1] != ' ' || (start > 1 && input[start-2] == '\\')) {
+		start--
+	}
+
+	head, word, tail := input[:start], input[start:pos], input[pos:]
+	prefix := strings.Replace(word, `\ `, " ", -1)
+
+	var candidates []string
+	switch {
+	case strings.TrimSpace(head) == "":
+		candidates = append(candidates, "exit", "quit")
+		for _, command := range shellCommands {
+			candidates = append(candidates, command.Name)
+		}
+	case strings.HasPrefix(prefix, "-"):
+		candidates = shellOptionNames(strings.Fields(head)[0])
+	default:
+		candidates = append(shellTagValueNames(store, prefix), shellPaths(prefix)...)
+	}
+
+	completions := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			completions = append(completions, strings.Replace(candidate, " ", `\ `, -1))
+		}
+	}
+	sort.Strings(completions)
+
+	return head, completions, tail
+}
+
+func shellOptionNames(commandName string) []string {
+	options := globalOptions
+	if command := findCommand(shellCommands, commandName); command != nil {
+		options = make(Options, 0, len(command.Options)+len(globalOptions))
+		options = append(options, command.Options...)
+		options = append(options, globalOptions...)
+	}
+
+	names := make([]string, 0, len(options))
+	for _, option := range options {
+		if option.LongName != "" {
+			names = append(names, option.LongName)
+		}
+	}
+
+	return names
+}
+
+// Lists the tag names or, if prefix is of the form TAG=, the TAG=VALUE pairs
+// for the tag's values.
+func shellTagValueNames(store *storage.Storage, prefix string) []string {
+	tx, err := store.Begin()
+	if err != nil {
+		return nil
+	}
+	defer tx.Commit()
+
+	if index := strings.Index(prefix, "="); index > 0 {
+		tag, err := store.TagByName(tx, prefix[:index])
+		if err != nil || tag == nil {
+			return nil
+		}
+
+		values, err := store.ValuesByTag(tx, tag.Id)
+		if err != nil {
+			return nil
+		}
+
+		names := make([]string, len(values))
+		for index, value := range values {
+			names[index] = tag.Name + "=" + value.Name
+		}
+
+		return names
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, len(tags))
+	for index, tag := range tags {
+		names[index] = tag.Name
+	}
+
+	return names
+}
+
+func shellPaths(prefix string) []string {
+	paths, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return nil
+	}
+
+	for index, path := range paths {
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			paths[index] = path + string(filepath.Separator)
+		}
+	}
+
+	return paths
+}
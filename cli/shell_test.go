@@ -0,0 +1,136 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompleteShellWord(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu-shell")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("file"), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	dbPath := filepath.Join(dir, "db")
+	if err := storage.CreateAt(dbPath); err != nil {
+		test.Fatal(err)
+	}
+	store, err := storage.OpenAt(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	store.AddTag(tx, "big band")
+	store.AddTag(tx, "bass")
+	year, _ := store.AddTag(tx, "year")
+	value, _ := store.AddValue(tx, "2017")
+	file, _ := store.AddFile(tx, filepath.Join(dir, "file"), fingerprint.Fingerprint("abc"), "SHA256", time.Now(), 0, false)
+	store.AddFileTag(tx, file.Id, year.Id, value.Id)
+	tx.Commit()
+
+	shellCommands = []*Command{&TagCommand, &TagsCommand}
+
+	assertCompletion(test, store, "ta", "", []string{"tag", "tags"}, "")
+	assertCompletion(test, store, "tag --ta", "tag ", []string{"--tags"}, "")
+	assertCompletion(test, store, "files b", "files ", []string{"bass", `big\ band`}, "")
+	assertCompletion(test, store, "files big\\ b", "files ", []string{`big\ band`}, "")
+	assertCompletion(test, store, "tag file year=", "tag file ", []string{"year=2017"}, "")
+	assertCompletion(test, store, "files f", "files ", []string{"file"}, "")
+	assertCompletion(test, store, "files "+dir+"/f", "files ", []string{dir + "/file"}, "")
+}
+
+func TestRunSubcommandVerbosity(test *testing.T) {
+	var observed uint
+	probe := Command{Name: "probe", Exec: func(options Options, args []string, databasePath string) (error, warnings) {
+		observed = log.Verbosity
+		return nil, nil
+	}}
+	shellCommands = []*Command{&probe}
+
+	verbosity := log.Verbosity
+	defer func() { log.Verbosity = verbosity }()
+	log.Verbosity = 2
+
+	for _, tokens := range [][]string{{"probe"}, {"probe", "-v"}, {"probe", "-v", "-v"}} {
+		if err, _ := runSubcommand(tokens, ""); err != nil {
+			test.Fatal(err)
+		}
+
+		expected := uint(2)
+		if len(tokens) == 3 {
+			expected = 3
+		}
+		if observed != expected {
+			test.Fatalf("Expected verbosity %v for %v but was %v.", expected, tokens, observed)
+		}
+		if log.Verbosity != 2 {
+			test.Fatalf("Expected verbosity to be restored to 2 but was %v.", log.Verbosity)
+		}
+	}
+}
+
+func TestShellOptionNamesLeavesCommandOptions(test *testing.T) {
+	options := make(Options, 1, 10)
+	options[0] = Option{"--probe", "", "probe", false, false, ""}
+	probe := Command{Name: "probe", Options: options}
+	shellCommands = []*Command{&probe}
+
+	names := shellOptionNames("probe")
+	if len(names) == 0 {
+		test.Fatal("Expected option names.")
+	}
+
+	if spare := options[:2][1]; spare.LongName != "" {
+		test.Fatalf("Expected the command's options to be left unchanged but '%v' was appended.", spare.LongName)
+	}
+}
+
+// unexported
+
+func assertCompletion(test *testing.T, store *storage.Storage, input, expectedHead string, expectedCompletions []string, expectedTail string) {
+	head, completions, tail := completeShellWord(store, input, len(input))
+	if head != expectedHead || !reflect.DeepEqual(completions, expectedCompletions) || tail != expectedTail {
+		test.Fatalf("Expected completion of '%v' to be '%v' %v '%v' but was '%v' %v '%v'.", input, expectedHead, expectedCompletions, expectedTail, head, completions, tail)
+	}
+}
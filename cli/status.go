@@ -48,8 +48,8 @@ Note: The 'repair' subcommand can be used to fix problems caused by files that h
 	Examples: []string{"$ tmsu status",
 		"$ tmsu status .",
 		"$ tmsu status --directory *"},
-	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""},
-		Option{"--no-dereference", "-P", "do not follow symbolic links", false, ""}},
+	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, false, ""},
+		Option{"--no-dereference", "-P", "do not follow symbolic links", false, false, ""}},
 	Exec: statusExec,
 }
 
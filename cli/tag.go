@@ -36,6 +36,7 @@ var TagCommand = Command{
 	Usages: []string{"tmsu tag [OPTION]... FILE TAG[=VALUE]...",
 		`tmsu tag [OPTION]... --tags="TAG[=VALUE]..." FILE...`,
 		"tmsu tag [OPTION]... --from=SOURCE FILE...",
+		"tmsu tag [OPTION]... --from-metadata FILE...",
 		"tmsu tag [OPTION]... --where=QUERY TAG[=VALUE]...",
 		"tmsu tag [OPTION]... --create {TAG|=VALUE}...",
 		"tmsu tag [OPTION[... -"},
@@ -47,36 +48,34 @@ Tag and value names may consist of one or more letter, number, punctuation and s
 
 Tags will not be applied if they are already implied by tag implications. This behaviour can be overridden with the --explicit option. See the 'imply' subcommand for more information.
 
+With --from-metadata, the files are tagged from their embedded metadata, such as the artist of a song or the camera that took a photograph. See the 'import-metadata' subcommand for details.
+
 If a single argument of - is passed, TMSU will read lines from standard input in the format 'FILE TAG[=VALUE]...'.
 
 Note: The equals '=' and whitespace characters must be escaped with a backslash '\' when used within a tag or value name. However, your shell may use the backslash for its own purposes: this can normally be avoided by enclosing the argument in single quotation marks or by escaping the backslash with an additional backslash '\\'.`,
 	Examples: []string{"$ tmsu tag mountain1.jpg photo landscape holiday good country=france",
 		"$ tmsu tag --from=mountain1.jpg mountain2.jpg",
+		"$ tmsu tag --from-metadata song.mp3 mountain1.jpg",
 		`$ tmsu tag --tags="landscape" field1.jpg field2.jpg`,
 		"$ tmsu tag --create bad rubbish awful =2017",
 		`$ tmsu tag --where="bad and good" confused`,
 		"$ tmsu tag sheep.jpg '<tag>'"},
-	Options: Options{{"--tags", "-t", "the set of tags to apply", true, ""},
-		{"--recursive", "-r", "recursively apply tags to directory contents", false, ""},
-		{"--include-hidden", "-H", "don't skip hidden files/directories when tagging recursively", false, ""},
-		{"--from", "-f", "copy tags from the SOURCE file", true, ""},
-		{"--where", "-w", "tags files matching QUERY", true, ""},
-		{"--create", "-c", "create tags or values without tagging any files", false, ""},
-		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, ""},
-		{"--force", "-F", "apply tags to non-existent or non-permissioned paths", false, ""},
-		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, ""}},
+	Options: Options{{"--tags", "-t", "the set of tags to apply", true, false, ""},
+		{"--recursive", "-r", "recursively apply tags to directory contents", false, false, ""},
+		{"--include-hidden", "-H", "don't skip hidden files/directories when tagging recursively", false, false, ""},
+		{"--from", "-f", "copy tags from the SOURCE file", true, false, ""},
+		{"--from-metadata", "-m", "apply tags from the files' embedded metadata", false, false, ""},
+		{"--where", "-w", "tags files matching QUERY", true, false, ""},
+		{"--create", "-c", "create tags or values without tagging any files", false, false, ""},
+		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, false, ""},
+		{"--force", "-F", "apply tags to non-existent or non-permissioned paths", false, false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, false, ""}},
 	Exec: tagExec,
 }
 
 // unexported
 
 func tagExec(options Options, args []string, databasePath string) (error, warnings) {
-	recursive := options.HasOption("--recursive")
-	includeHidden := options.HasOption("--include-hidden")
-	explicit := options.HasOption("--explicit")
-	force := options.HasOption("--force")
-	followSymlinks := !options.HasOption("--no-dereference")
-
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -87,7 +86,19 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 	if err != nil {
 		return err, nil
 	}
-	defer tx.Commit()
+
+	err, warnings := tagWithOptions(store, tx, options, args)
+	completeTransaction(tx, err)
+
+	return err, warnings
+}
+
+func tagWithOptions(store *storage.Storage, tx *storage.Tx, options Options, args []string) (error, warnings) {
+	recursive := options.HasOption("--recursive")
+	includeHidden := options.HasOption("--include-hidden")
+	explicit := options.HasOption("--explicit")
+	force := options.HasOption("--force")
+	followSymlinks := !options.HasOption("--no-dereference")
 
 	switch {
 	case options.HasOption("--create"):
@@ -125,6 +136,12 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 		paths := args
 
 		return tagFrom(store, tx, fromPath, paths, explicit, recursive, includeHidden, force, followSymlinks)
+	case options.HasOption("--from-metadata"):
+		if len(args) < 1 {
+			return fmt.Errorf("too few arguments"), nil
+		}
+
+		return importMetadata(store, tx, args, recursive, includeHidden, explicit, false)
 	case options.HasOption("--where"):
 		if len(args) < 1 {
 			return fmt.Errorf("too few arguments"), nil
@@ -203,8 +220,19 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 		return err, warnings
 	}
 
+	fingerprinter := newFingerprinter(store, tx, settings)
+	fingerprinter.useStored()
+	if err := calculateFingerprints(store, tx, fingerprinter, paths, recursive, includeHidden, followSymlinks); err != nil {
+		return err, warnings
+	}
+
+	autoTagger, err := newAutoTagger(store, tx, settings)
+	if err != nil {
+		return err, warnings
+	}
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), settings.ReportDuplicates()); err != nil {
+		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, fingerprinter, settings.ReportDuplicates(), autoTagger); err != nil {
 			switch {
 			case os.IsPermission(err):
 				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
@@ -258,8 +286,19 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 
 	warnings := make(warnings, 0, 10)
 
+	fingerprinter := newFingerprinter(store, tx, settings)
+	fingerprinter.useStored()
+	if err := calculateFingerprints(store, tx, fingerprinter, paths, recursive, includeHidden, followSymlinks); err != nil {
+		return err, warnings
+	}
+
+	autoTagger, err := newAutoTagger(store, tx, settings)
+	if err != nil {
+		return err, warnings
+	}
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), settings.ReportDuplicates()); err != nil {
+		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, fingerprinter, settings.ReportDuplicates(), autoTagger); err != nil {
 			switch {
 			case os.IsPermission(err):
 				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
@@ -316,7 +355,7 @@ func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit
 	return nil, warnings
 }
 
-func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, recursive, includeHidden, force, followSymlinks bool, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg string, reportDuplicates bool) error {
+func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, recursive, includeHidden, force, followSymlinks bool, fingerprinter *fingerprinter, reportDuplicates bool, autoTagger *autoTagger) error {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
@@ -359,7 +398,7 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 	if file == nil {
 		log.Infof(2, "%v: creating fingerprint", path)
 
-		fp, err := fingerprint.Create(absPath, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg)
+		fp, err := fingerprinter.create(absPath)
 		if err != nil {
 			if !force || !(os.IsNotExist(err) || os.IsPermission(err)) {
 				return fmt.Errorf("%v: could not create fingerprint: %v", path, err)
@@ -380,10 +419,33 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 
 		log.Infof(2, "%v: adding file", path)
 
-		file, err = store.AddFile(tx, absPath, fp, stat.ModTime(), int64(stat.Size()), stat.IsDir())
+		file, err = store.AddFile(tx, absPath, fp, fingerprinter.fileAlgorithm, stat.ModTime(), int64(stat.Size()), stat.IsDir())
 		if err != nil {
 			return fmt.Errorf("%v: could not add file to database: %v", path, err)
 		}
+
+		if fp != fingerprint.Empty {
+			if err := fingerprinter.updateImage(store, tx, file); err != nil {
+				return err
+			}
+		}
+
+		if autoTagger != nil {
+			if tagArgs := autoTagger.tagsFor(absPath, stat); len(tagArgs) > 0 {
+				log.Infof(2, "%v: applying automatic tags", path)
+
+				autoPairs, err := parseDerivedTagValuePairs(store, tx, autoTagger.settings, tagArgs)
+				if err != nil {
+					return fmt.Errorf("%v: could not apply automatic tags: %v", path, err)
+				}
+
+				for _, pair := range autoPairs {
+					if _, err = store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+						return fmt.Errorf("%v: could not apply automatic tags: %v", path, err)
+					}
+				}
+			}
+		}
 	}
 
 	if !explicit {
@@ -402,7 +464,7 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 	}
 
 	if recursive && stat.IsDir() {
-		if err = tagRecursively(store, tx, absPath, pairs, explicit, includeHidden, force, followSymlinks, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg, reportDuplicates); err != nil {
+		if err = tagRecursively(store, tx, absPath, pairs, explicit, includeHidden, force, followSymlinks, fingerprinter, reportDuplicates, autoTagger); err != nil {
 			return err
 		}
 	}
@@ -482,6 +544,9 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includ
 		tagArgs := words[1:]
 
 		err, commandWarnings := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, includeHidden, force, followSymlinks)
+		if _, interrupted := err.(InterruptedError); interrupted {
+			return err, warnings
+		}
 		if err != nil {
 			warnings = append(warnings, err.Error())
 		}
@@ -493,7 +558,7 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includ
 	return nil, warnings
 }
 
-func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, includeHidden, force, followSymlinks bool, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg string, reportDuplicates bool) error {
+func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, includeHidden, force, followSymlinks bool, fingerprinter *fingerprinter, reportDuplicates bool, autoTagger *autoTagger) error {
 	osFile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("%v: could not open path: %v", path, err)
@@ -512,7 +577,7 @@ func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs [
 			continue
 		}
 
-		if err = tagPath(store, tx, childPath, pairs, explicit, true, includeHidden, force, followSymlinks, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg, reportDuplicates); err != nil {
+		if err = tagPath(store, tx, childPath, pairs, explicit, true, includeHidden, force, followSymlinks, fingerprinter, reportDuplicates, autoTagger); err != nil {
 			return err
 		}
 	}
@@ -520,6 +585,81 @@ func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs [
 	return nil
 }
 
+// Calculates, up-front, the fingerprints of the files that tagging the paths will add to the database
+func calculateFingerprints(store *storage.Storage, tx *storage.Tx, fingerprinter *fingerprinter, paths []string, recursive, includeHidden, followSymlinks bool) error {
+	log.Infof(2, "identifying files to fingerprint")
+
+	untaggedPaths := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		var err error
+		untaggedPaths, err = findUntaggedPaths(store, tx, path, recursive, includeHidden, followSymlinks, untaggedPaths)
+		if err != nil {
+			return err
+		}
+	}
+
+	return fingerprinter.calculate(untaggedPaths)
+}
+
+func findUntaggedPaths(store *storage.Storage, tx *storage.Tx, path string, recursive, includeHidden, followSymlinks bool, untaggedPaths []string) ([]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		// reported when the path is tagged
+		return untaggedPaths, nil
+	}
+	if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return untaggedPaths, nil
+		}
+
+		stat, err = os.Lstat(absPath)
+		if err != nil {
+			return untaggedPaths, nil
+		}
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		untaggedPaths = append(untaggedPaths, absPath)
+	}
+
+	if recursive && stat.IsDir() {
+		osFile, err := os.Open(absPath)
+		if err != nil {
+			return untaggedPaths, nil
+		}
+
+		childNames, err := osFile.Readdirnames(0)
+		osFile.Close()
+		if err != nil {
+			return untaggedPaths, nil
+		}
+
+		for _, childName := range childNames {
+			if childName[0] == '.' && !includeHidden {
+				continue
+			}
+
+			untaggedPaths, err = findUntaggedPaths(store, tx, filepath.Join(absPath, childName), true, includeHidden, followSymlinks, untaggedPaths)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return untaggedPaths, nil
+}
+
 func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tx *storage.Tx, pairs []entities.TagIdValueIdPair, file *entities.File) ([]entities.TagIdValueIdPair, error) {
 	log.Infof(2, "%v: determining existing file-tags", file.Path())
 
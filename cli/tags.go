@@ -46,17 +46,41 @@ See the 'imply' subcommand for more information on implied tags.`,
 		"$ tmsu tags tralala.mp3 boom.mp3\n./tralala.mp3: mp3 music opera\n./boom.mp3: mp3 music drum-n-bass",
 		"$ tmsu tags --count tralala.mp3",
 		"$ tmsu tags --value 2009 red"},
-	Options: Options{{"--count", "-c", "lists the number of tags rather than their names", false, ""},
-		{"", "-1", "list one tag per line", false, ""},
-		{"--explicit", "-e", "do not show implied tags", false, ""},
-		{"--name", "-n", "when to print the file/value name: auto, always, never", true, ""},
-		{"--no-dereference", "-P", "do not follow symlinks (show tags for symlink itself)", false, ""},
-		{"--value", "-u", "show tags which utilise values", false, ""}},
+	Options: Options{{"--count", "-c", "lists the number of tags rather than their names", false, false, ""},
+		{"", "-1", "list one tag per line", false, false, ""},
+		{"--explicit", "-e", "do not show implied tags", false, false, ""},
+		{"--name", "-n", "when to print the file/value name: auto, always, never", true, false, ""},
+		{"--no-dereference", "-P", "do not follow symlinks (show tags for symlink itself)", false, false, ""},
+		{"--value", "-u", "show tags which utilise values", false, false, ""}},
 	Exec: tagsExec,
 }
 
 // unexported
 
+type tagRecord struct {
+	Name string `json:"name"`
+}
+
+type pathTagsRecord struct {
+	Path string   `json:"path"`
+	Tags []string `json:"tags"`
+}
+
+type pathCountRecord struct {
+	Path  string `json:"path"`
+	Count uint   `json:"count"`
+}
+
+type valueTagsRecord struct {
+	Value string   `json:"value"`
+	Tags  []string `json:"tags"`
+}
+
+type valueCountRecord struct {
+	Value string `json:"value"`
+	Count uint   `json:"count"`
+}
+
 func tagsExec(options Options, args []string, databasePath string) (error, warnings) {
 	showCount := options.HasOption("--count")
 	onePerLine := options.HasOption("-1")
@@ -67,6 +91,14 @@ func tagsExec(options Options, args []string, databasePath string) (error, warni
 		return err, nil
 	}
 
+	format, err := outputFormatFor(options)
+	if err != nil {
+		return err, nil
+	}
+	if format != nil {
+		colour = false
+	}
+
 	printName := "auto"
 	if options.HasOption("--name") {
 		printName = options.Get("--name").Argument
@@ -85,17 +117,17 @@ func tagsExec(options Options, args []string, databasePath string) (error, warni
 	defer tx.Commit()
 
 	if options.HasOption("--value") {
-		return listTagsForValues(store, tx, args, showCount, onePerLine, colour, printName)
+		return listTagsForValues(store, tx, args, showCount, onePerLine, colour, printName, format)
 	}
 
 	if len(args) == 0 {
-		return listAllTags(store, tx, showCount, onePerLine), nil
+		return listAllTags(store, tx, showCount, onePerLine, format), nil
 	}
 
-	return listTagsForPaths(store, tx, args, showCount, onePerLine, explicitOnly, colour, followSymlinks, printName)
+	return listTagsForPaths(store, tx, args, showCount, onePerLine, explicitOnly, colour, followSymlinks, printName, format)
 }
 
-func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool) error {
+func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool, format *outputFormat) error {
 	log.Info(2, "retrieving all tags.")
 
 	if showCount {
@@ -104,6 +136,10 @@ func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine b
 			return fmt.Errorf("could not retrieve tag count: %v", err)
 		}
 
+		if format != nil {
+			return format.print(countRecord{count})
+		}
+
 		fmt.Println(count)
 	} else {
 		tags, err := store.Tags(tx)
@@ -111,11 +147,19 @@ func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine b
 			return fmt.Errorf("could not retrieve tags: %v", err)
 		}
 
-		if onePerLine {
+		switch {
+		case format != nil:
+			records := make([]tagRecord, len(tags))
+			for index, tag := range tags {
+				records[index] = tagRecord{tag.Name}
+			}
+
+			return format.print(records)
+		case onePerLine:
 			for _, tag := range tags {
 				fmt.Println(escape(tag.Name, '=', ' '))
 			}
-		} else {
+		default:
 			tagNames := make([]string, len(tags))
 			for index, tag := range tags {
 				tagNames[index] = escape(tag.Name, '=', ' ')
@@ -128,8 +172,10 @@ func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine b
 	return nil
 }
 
-func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, colour, followSymlinks bool, printPathWhen string) (error, warnings) {
+func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, colour, followSymlinks bool, printPathWhen string, format *outputFormat) (error, warnings) {
 	warnings := make(warnings, 0, 10)
+	tagsRecords := make([]pathTagsRecord, 0, len(paths))
+	countRecords := make([]pathCountRecord, 0, len(paths))
 
 	printPath := printPathWhen != "never" && (printPathWhen == "always" || len(paths) > 1 || !stdoutIsCharDevice())
 
@@ -190,6 +236,10 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 
 		escapedPath := escape(path, '\\', ':')
 		switch {
+		case format != nil && showCount:
+			countRecords = append(countRecords, pathCountRecord{path, uint(len(tagNames))})
+		case format != nil:
+			tagsRecords = append(tagsRecords, pathTagsRecord{path, tagNames})
 		case showCount:
 			if printPath {
 				fmt.Print(escapedPath + ": ")
@@ -223,11 +273,21 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 		}
 	}
 
+	if format != nil {
+		if showCount {
+			return format.print(countRecords), warnings
+		}
+
+		return format.print(tagsRecords), warnings
+	}
+
 	return nil, warnings
 }
 
-func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []string, showCount, onePerLine, colour bool, printTagWhen string) (error, warnings) {
+func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []string, showCount, onePerLine, colour bool, printTagWhen string, format *outputFormat) (error, warnings) {
 	warnings := make(warnings, 0, 10)
+	tagsRecords := make([]valueTagsRecord, 0, len(valueNames))
+	countRecords := make([]valueCountRecord, 0, len(valueNames))
 
 	printTag := printTagWhen != "never" && (printTagWhen == "always" || len(valueNames) > 1 || !stdoutIsCharDevice())
 
@@ -257,6 +317,10 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 		}
 
 		switch {
+		case format != nil && showCount:
+			countRecords = append(countRecords, valueCountRecord{valueName, uint(len(tagNames))})
+		case format != nil:
+			tagsRecords = append(tagsRecords, valueTagsRecord{valueName, tagNames})
 		case showCount:
 			if printTag {
 				fmt.Println(valueName + ":")
@@ -290,6 +354,14 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 		}
 	}
 
+	if format != nil {
+		if showCount {
+			return format.print(countRecords), warnings
+		}
+
+		return format.print(tagsRecords), warnings
+	}
+
 	return nil, warnings
 }
 
@@ -32,7 +32,7 @@ var UnmountCommand = Command{
 	Usages: []string{"tmsu unmount MOUNTPOINT",
 		"tmsu unmount --all"},
 	Description: "Unmounts the virtual file-system at MOUNTPOINT.",
-	Options:     Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""}},
+	Options:     Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, false, ""}},
 	Exec:        unmountExec,
 }
 
@@ -36,10 +36,10 @@ var UntagCommand = Command{
 	Examples: []string{"$ tmsu untag mountain.jpg hill county=germany",
 		"$ tmsu untag --all mountain-copy.jpg",
 		`$ tmsu untag --tags="river underwater year=2017" forest.jpg desert.jpg`},
-	Options: Options{{"--all", "-a", "strip each file of all tags", false, ""},
-		{"--tags", "-t", "the set of tags to remove", true, ""},
-		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""},
-		{"--no-dereference", "-P", "do not follow symbolic links (untag the link itself)", false, ""}},
+	Options: Options{{"--all", "-a", "strip each file of all tags", false, false, ""},
+		{"--tags", "-t", "the set of tags to remove", true, false, ""},
+		{"--recursive", "-r", "recursively remove tags from directory contents", false, false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (untag the link itself)", false, false, ""}},
 	Exec: untagExec,
 }
 
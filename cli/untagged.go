@@ -33,22 +33,30 @@ var UntaggedCommand = Command{
 Where PATHs are not specified, untagged items under the current working directory are shown.`,
 	Examples: []string{"$ tmsu untagged",
 		"$ tmsu untagged /home/fred/drawings"},
-	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""},
-		Option{"--count", "-c", "list the number of files rather than their names", false, ""},
-		Option{"--no-dereference", "-P", "do not dereference symbolic links", false, ""}},
+	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, false, ""},
+		Option{"--count", "-c", "list the number of files rather than their names", false, false, ""},
+		Option{"--no-dereference", "-P", "do not dereference symbolic links", false, false, ""}},
 	Exec: untaggedExec,
 }
 
 // unexported
 
+type untaggedRecord struct {
+	Path string `json:"path"`
+}
+
 func untaggedExec(options Options, args []string, databasePath string) (error, warnings) {
 	recursive := !options.HasOption("--directory")
 	count := options.HasOption("--count")
 	followSymlinks := !options.HasOption("--no-dereference")
 
+	format, err := outputFormatFor(options)
+	if err != nil {
+		return err, nil
+	}
+
 	paths := args
 	if len(paths) == 0 {
-		var err error
 		paths, err = directoryEntries(".")
 		if err != nil {
 			return err, nil
@@ -73,7 +81,22 @@ func untaggedExec(options Options, args []string, databasePath string) (error, w
 			return err, nil
 		}
 
+		if format != nil {
+			return format.print(countRecord{count}), nil
+		}
+
 		fmt.Println(count)
+	} else if format != nil {
+		records := make([]untaggedRecord, 0, 10)
+		action := func(absPath string) {
+			records = append(records, untaggedRecord{_path.Rel(absPath)})
+		}
+
+		if err := findUntaggedFunc(store, tx, paths, recursive, followSymlinks, action); err != nil {
+			return err, nil
+		}
+
+		return format.print(records), nil
 	} else {
 		if err := findUntagged(store, tx, paths, recursive, followSymlinks); err != nil {
 			return err, nil
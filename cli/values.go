@@ -31,17 +31,36 @@ var ValuesCommand = Command{
 	Examples: []string{"$ tmsu values year\n2000\n2001\n2017",
 		"$ tmsu values\n2000\n2001\n2017\ncheese\nopera",
 		"$ tmsu values --count year\n3"},
-	Options: Options{{"--count", "-c", "lists the number of values rather than their names", false, ""},
-		{"", "-1", "list one value per line", false, ""}},
+	Options: Options{{"--count", "-c", "lists the number of values rather than their names", false, false, ""},
+		{"", "-1", "list one value per line", false, false, ""}},
 	Exec: valuesExec,
 }
 
 // unexported
 
+type valueRecord struct {
+	Name string `json:"name"`
+}
+
+type tagValuesRecord struct {
+	Tag    string   `json:"tag"`
+	Values []string `json:"values"`
+}
+
+type tagCountRecord struct {
+	Tag   string `json:"tag"`
+	Count uint   `json:"count"`
+}
+
 func valuesExec(options Options, args []string, databasePath string) (error, warnings) {
 	showCount := options.HasOption("--count")
 	onePerLine := options.HasOption("-1")
 
+	format, err := outputFormatFor(options)
+	if err != nil {
+		return err, nil
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -55,13 +74,13 @@ func valuesExec(options Options, args []string, databasePath string) (error, war
 	defer tx.Commit()
 
 	if len(args) == 0 {
-		return listAllValues(store, tx, showCount, onePerLine), nil
+		return listAllValues(store, tx, showCount, onePerLine, format), nil
 	}
 
-	return listValues(store, tx, args, showCount, onePerLine)
+	return listValues(store, tx, args, showCount, onePerLine, format)
 }
 
-func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool) error {
+func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool, format *outputFormat) error {
 	log.Info(2, "retrieving all values.")
 
 	if showCount {
@@ -70,6 +89,10 @@ func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine
 			return fmt.Errorf("could not retrieve value count: %v", err)
 		}
 
+		if format != nil {
+			return format.print(countRecord{count})
+		}
+
 		fmt.Println(count)
 	} else {
 		values, err := store.Values(tx)
@@ -77,11 +100,19 @@ func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine
 			return fmt.Errorf("could not retrieve values: %v", err)
 		}
 
-		if onePerLine {
+		switch {
+		case format != nil:
+			records := make([]valueRecord, len(values))
+			for index, value := range values {
+				records[index] = valueRecord{value.Name}
+			}
+
+			return format.print(records)
+		case onePerLine:
 			for _, value := range values {
 				fmt.Println(escape(value.Name))
 			}
-		} else {
+		default:
 			valueNames := make([]string, len(values))
 			for index, value := range values {
 				valueNames[index] = escape(value.Name)
@@ -94,19 +125,19 @@ func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine
 	return nil
 }
 
-func listValues(store *storage.Storage, tx *storage.Tx, args []string, showCount, onePerLine bool) (error, warnings) {
+func listValues(store *storage.Storage, tx *storage.Tx, args []string, showCount, onePerLine bool, format *outputFormat) (error, warnings) {
 	tagNames := make([]string, len(args))
 	for index, arg := range args {
 		tagNames[index] = parseTagOrValueName(arg)
 	}
 
-	switch len(tagNames) {
-	case 0:
+	switch {
+	case len(tagNames) == 0:
 		return fmt.Errorf("at least one tag must be specified"), nil
-	case 1:
+	case len(tagNames) == 1 && format == nil:
 		return listValuesForTag(store, tx, tagNames[0], showCount, onePerLine), nil
 	default:
-		return listValuesForTags(store, tx, tagNames, showCount, onePerLine)
+		return listValuesForTags(store, tx, tagNames, showCount, onePerLine, format)
 	}
 }
 
@@ -146,8 +177,10 @@ func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, sh
 	return nil
 }
 
-func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string, showCount, onePerLine bool) (error, warnings) {
+func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string, showCount, onePerLine bool, format *outputFormat) (error, warnings) {
 	warnings := make(warnings, 0, 10)
+	valuesRecords := make([]tagValuesRecord, 0, len(tagNames))
+	countRecords := make([]tagCountRecord, 0, len(tagNames))
 
 	for _, tagName := range tagNames {
 		tag, err := store.TagByName(tx, tagName)
@@ -166,9 +199,19 @@ func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string
 			return fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err), warnings
 		}
 
-		if showCount {
+		switch {
+		case format != nil && showCount:
+			countRecords = append(countRecords, tagCountRecord{tagName, uint(len(values))})
+		case format != nil:
+			valueNames := make([]string, len(values))
+			for index, value := range values {
+				valueNames[index] = value.Name
+			}
+
+			valuesRecords = append(valuesRecords, tagValuesRecord{tagName, valueNames})
+		case showCount:
 			fmt.Printf("%v: %v\n", tagName, len(values))
-		} else {
+		default:
 			if onePerLine {
 				fmt.Println(tagName)
 				for _, value := range values {
@@ -186,5 +229,13 @@ func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string
 		}
 	}
 
+	if format != nil {
+		if showCount {
+			return format.print(countRecords), warnings
+		}
+
+		return format.print(valuesRecords), warnings
+	}
+
 	return nil, warnings
 }
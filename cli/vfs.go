@@ -19,6 +19,7 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/vfs"
 	"strings"
 )
@@ -30,9 +31,11 @@ var VfsCommand = Command{
 	Description: `This subcommand is the foreground process which hosts the virtual filesystem. It is run automatically when a virtual filesystem is mounted using the 'mount' subcommand and terminated when the virtual filesystem is unmounted.
 
 It is not normally necessary to issue this subcommand manually unless debugging the virtual filesystem. For debug output use the --verbose option.`,
-	Options: Options{{"--options", "-o", "mount options", true, ""}},
-	Exec:    vfsExec,
-	Hidden:  true,
+	Options: Options{{"--options", "-o", "mount options", true, false, ""},
+		{"--read-only", "-r", "mount the virtual filesystem read-only", false, false, ""},
+		{"--where", "-w", "show only the files matching QUERY", true, false, ""}},
+	Exec:   vfsExec,
+	Hidden: true,
 }
 
 // unexported
@@ -47,6 +50,16 @@ func vfsExec(options Options, args []string, databasePath string) (error, warnin
 		mountOptions = strings.Split(options.Get("--options").Argument, ",")
 	}
 
+	var where query.Expression
+	if options.HasOption("--where") {
+		expression, err := query.Parse(options.Get("--where").Argument)
+		if err != nil {
+			return fmt.Errorf("could not parse query: %v", err), nil
+		}
+
+		where = expression
+	}
+
 	mountPath := args[0]
 
 	store, err := openDatabase(databasePath)
@@ -55,7 +68,7 @@ func vfsExec(options Options, args []string, databasePath string) (error, warnin
 	}
 	defer store.Close()
 
-	vfs, err := vfs.MountVfs(store, mountPath, mountOptions)
+	vfs, err := vfs.MountVfs(store, mountPath, mountOptions, options.HasOption("--read-only"), where)
 	if err != nil {
 		return fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err), nil
 	}
@@ -0,0 +1,433 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/filesystem"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var XattrCommand = Command{
+	Name:     "xattr",
+	Synopsis: "Synchronize tags with extended attributes",
+	Usages: []string{"tmsu xattr [OPTION]... export [PATH]...",
+		"tmsu xattr [OPTION]... import [PATH]...",
+		"tmsu xattr [OPTION]... {export|import} -"},
+	Description: `Copies the tags of files to or from their extended attributes, so that the tags travel with the files when they are copied with 'cp -a' or 'rsync -X' and can be shared with other applications.
+
+The tags are stored in two attributes: 'user.xdg.tags', the freedesktop.org convention of comma-separated tags understood by other desktop tools, and 'user.tmsu.tags', which records the tags and values exactly in the format of the 'tags' subcommand. Tags containing a comma are omitted from 'user.xdg.tags'. Tags with values are written to 'user.xdg.tags' as TAG=VALUE.
+
+'export' writes the explicit tags of the tagged files under each PATH, or of every tagged file if no PATH is specified, to their attributes. The attributes are only written where they differ from the tags. The attributes of files under PATH that are not in the database are cleared only if they carry 'user.tmsu.tags': the attributes of files that TMSU has never exported to are left alone.
+
+'import' applies the tags in the attributes of the files under each PATH, recursively, or of every tagged file if no PATH is specified. 'user.tmsu.tags' is used in preference to 'user.xdg.tags'. Existing tags are kept. Hidden files and directories are skipped unless specified explicitly.
+
+If PATH is '-' then paths are read from standard input, one per line, and each is synchronized as it is read. This is intended for use with a file system watcher such as 'inotifywait'.`,
+	Examples: []string{"$ tmsu xattr export",
+		"$ getfattr -n user.xdg.tags song.mp3\n# file: song.mp3\nuser.xdg.tags=\"music,mp3,year=2017\"",
+		"$ tmsu xattr import --pretend ~/Downloads",
+		"$ inotifywait -m -r -e attrib --format %w%f ~/Documents | tmsu xattr import -"},
+	Options: Options{Option{"--pretend", "-P", "lists the changes that would be made without making them", false, false, ""}},
+	Exec:    xattrExec,
+}
+
+// unexported
+
+const (
+	xdgTagsAttribute  = "user.xdg.tags"
+	tmsuTagsAttribute = "user.tmsu.tags"
+)
+
+func xattrExec(options Options, args []string, databasePath string) (error, warnings) {
+	pretend := options.HasOption("--pretend")
+
+	if len(args) == 0 {
+		return fmt.Errorf("'export' or 'import' must be specified"), nil
+	}
+
+	var sync func(*storage.Storage, *storage.Tx, []string, bool) (error, warnings)
+	switch args[0] {
+	case "export":
+		sync = exportXattrs
+	case "import":
+		sync = importXattrs
+	default:
+		return fmt.Errorf("invalid argument '%v': 'export' or 'import' must be specified", args[0]), nil
+	}
+	paths := args[1:]
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if len(paths) == 1 && paths[0] == "-" {
+		return syncStandardInput(store, sync, pretend)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	err, warnings := sync(store, tx, paths, pretend)
+	completeTransaction(tx, err)
+
+	return err, warnings
+}
+
+// Synchronizes the paths read from standard input, each in its own
+// transaction so that the changes are visible as they are made.
+func syncStandardInput(store *storage.Storage, sync func(*storage.Storage, *storage.Tx, []string, bool) (error, warnings), pretend bool) (error, warnings) {
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err, nil
+		}
+
+		if path := strings.TrimRight(line, "\r\n"); path != "" {
+			tx, txErr := store.Begin()
+			if txErr != nil {
+				return txErr, nil
+			}
+
+			syncErr, warnings := sync(store, tx, []string{path}, pretend)
+			completeTransaction(tx, syncErr)
+
+			if _, interrupted := syncErr.(InterruptedError); interrupted {
+				return syncErr, nil
+			}
+
+			// reported immediately as the input may never end
+			for _, warning := range warnings {
+				log.Warn(warning)
+			}
+			if syncErr != nil {
+				log.Warn(syncErr.Error())
+			}
+		}
+
+		if err == io.EOF {
+			return nil, nil
+		}
+	}
+}
+
+func exportXattrs(store *storage.Storage, tx *storage.Tx, paths []string, pretend bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	export := func(path string, fileId entities.FileId) error {
+		tmsuTags, xdgTags, err := xattrTags(store, tx, fileId)
+		if err != nil {
+			return err
+		}
+
+		changed, err := xattrsChanged(path, tmsuTags, xdgTags)
+		if err != nil {
+			warnings = append(warnings, xattrWarning(path, err))
+			return nil
+		}
+		if !changed {
+			return nil
+		}
+
+		if pretend {
+			fmt.Printf("%v: %v\n", _path.Rel(path), tmsuTags)
+			return nil
+		}
+
+		log.Infof(2, "%v: writing extended attributes", path)
+
+		if err := writeXattrs(path, tmsuTags, xdgTags); err != nil {
+			warnings = append(warnings, xattrWarning(path, err))
+		}
+
+		return nil
+	}
+
+	if len(paths) == 0 {
+		log.Infof(2, "retrieving all files from the database")
+
+		files, err := store.Files(tx, "name")
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err), warnings
+		}
+
+		for _, file := range files {
+			if err := export(file.Path(), file.Id); err != nil {
+				return err, warnings
+			}
+		}
+
+		return nil, warnings
+	}
+
+	// walk the file system so that the attributes of files no longer tagged are also cleared
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err), warnings
+		}
+
+		err = filepath.Walk(absPath, func(walkPath string, stat os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if walkPath != absPath && strings.HasPrefix(stat.Name(), ".") {
+				log.Infof(2, "%v: skipping hidden file/directory", walkPath)
+
+				if stat.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if stat.Mode()&os.ModeSymlink != 0 {
+				// attributes would be those of the target
+				return nil
+			}
+
+			file, err := store.FileByPath(tx, walkPath)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", walkPath, err)
+			}
+
+			if file != nil {
+				return export(walkPath, file.Id)
+			}
+
+			// only clear the attributes of files that TMSU exported to: those
+			// of other files may have been set by other applications
+			_, exported, err := filesystem.Xattr(walkPath, tmsuTagsAttribute)
+			if err != nil {
+				warnings = append(warnings, xattrWarning(walkPath, err))
+				return nil
+			}
+			if !exported {
+				return nil
+			}
+
+			return export(walkPath, 0)
+		})
+		if err != nil {
+			switch {
+			case os.IsPermission(err):
+				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+			case os.IsNotExist(err):
+				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+			default:
+				return err, warnings
+			}
+		}
+	}
+
+	return nil, warnings
+}
+
+func importXattrs(store *storage.Storage, tx *storage.Tx, paths []string, pretend bool) (error, warnings) {
+	log.Infof(2, "loading settings")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	autoTagger, err := newAutoTagger(store, tx, settings)
+	if err != nil {
+		return err, nil
+	}
+
+	tagsFor := func(path string, stat os.FileInfo) ([]string, error) {
+		if stat.Mode()&os.ModeSymlink != 0 {
+			return nil, nil
+		}
+
+		tagArgs, err := xattrTagArgs(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read extended attributes: %v", unwrapPathError(err))
+		}
+
+		return tagArgs, nil
+	}
+
+	return sweep(store, tx, settings, paths, true, false, false, pretend, tagsFor, autoTagger)
+}
+
+// The explicit tags of the file in the formats of the TMSU and freedesktop.org
+// attributes. A file that is not in the database has no tags.
+func xattrTags(store *storage.Storage, tx *storage.Tx, fileId entities.FileId) (string, string, error) {
+	if fileId == 0 {
+		return "", "", nil
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, fileId, true)
+	if err != nil {
+		return "", "", fmt.Errorf("could not retrieve file-tags for file '%v': %v", fileId, err)
+	}
+
+	tmsuTags := make([]string, 0, len(fileTags))
+
+	for _, fileTag := range fileTags {
+		tag, err := store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			return "", "", fmt.Errorf("could not lookup tag: %v", err)
+		}
+		if tag == nil {
+			return "", "", fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
+		}
+
+		valueName := ""
+		if fileTag.ValueId != 0 {
+			value, err := store.Value(tx, fileTag.ValueId)
+			if err != nil {
+				return "", "", fmt.Errorf("could not lookup value: %v", err)
+			}
+			if value == nil {
+				return "", "", fmt.Errorf("value '%v' does not exist", fileTag.ValueId)
+			}
+
+			valueName = value.Name
+		}
+
+		tmsuTags = append(tmsuTags, formatTagValueName(tag.Name, valueName, false, false, true))
+	}
+
+	sort.Strings(tmsuTags)
+
+	return strings.Join(tmsuTags, " "), xdgTagsFor(tmsuTags), nil
+}
+
+func xattrsChanged(path, tmsuTags, xdgTags string) (bool, error) {
+	for _, attribute := range []struct{ name, value string }{{tmsuTagsAttribute, tmsuTags}, {xdgTagsAttribute, xdgTags}} {
+		value, _, err := filesystem.Xattr(path, attribute.name)
+		if err != nil {
+			return false, err
+		}
+		if value != attribute.value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func writeXattrs(path, tmsuTags, xdgTags string) error {
+	for _, attribute := range []struct{ name, value string }{{tmsuTagsAttribute, tmsuTags}, {xdgTagsAttribute, xdgTags}} {
+		var err error
+		if attribute.value == "" {
+			err = filesystem.RemoveXattr(path, attribute.name)
+		} else {
+			err = filesystem.SetXattr(path, attribute.name, attribute.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The tag arguments for the tags in the attributes of the file at the
+// specified path. The exact 'user.tmsu.tags' is used unless 'user.xdg.tags'
+// has since been changed by another application.
+func xattrTagArgs(path string) ([]string, error) {
+	tmsuTags, hasTmsuTags, err := filesystem.Xattr(path, tmsuTagsAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	xdgTags, _, err := filesystem.Xattr(path, xdgTagsAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasTmsuTags {
+		tagArgs := text.Tokenize(tmsuTags)
+		if xdgTagsFor(tagArgs) == xdgTags {
+			return tagArgs, nil
+		}
+	}
+
+	tagArgs := make([]string, 0, 10)
+	for _, xdgTag := range strings.Split(xdgTags, ",") {
+		xdgTag = strings.TrimSpace(xdgTag)
+		if xdgTag == "" {
+			continue
+		}
+
+		parts := strings.SplitN(xdgTag, "=", 2)
+		tagArg := escape(parts[0], '=')
+		if len(parts) == 2 && parts[1] != "" {
+			tagArg += "=" + escape(parts[1], '=')
+		}
+
+		tagArgs = append(tagArgs, tagArg)
+	}
+
+	return tagArgs, nil
+}
+
+// The 'user.xdg.tags' value corresponding to the tag arguments.
+func xdgTagsFor(tagArgs []string) string {
+	xdgTags := make([]string, 0, len(tagArgs))
+
+	for _, tagArg := range tagArgs {
+		tagName, valueName := parseTagEqValueName(tagArg)
+
+		xdgTag := tagName
+		if valueName != "" {
+			xdgTag += "=" + valueName
+		}
+		if !strings.Contains(xdgTag, ",") {
+			xdgTags = append(xdgTags, xdgTag)
+		}
+	}
+
+	sort.Strings(xdgTags)
+
+	return strings.Join(xdgTags, ",")
+}
+
+func xattrWarning(path string, err error) string {
+	switch {
+	case os.IsPermission(err):
+		return fmt.Sprintf("%v: permission denied", _path.Rel(path))
+	case os.IsNotExist(err):
+		return fmt.Sprintf("%v: no such file", _path.Rel(path))
+	default:
+		return fmt.Sprintf("%v: could not write extended attributes: %v", _path.Rel(path), unwrapPathError(err))
+	}
+}
+
+func unwrapPathError(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// Retrieves the value of the extended attribute of the file at the specified
+// path, if it is set.
+func Xattr(path, name string) (string, bool, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			if err == syscall.ENODATA {
+				return "", false, nil
+			}
+
+			return "", false, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+
+		buffer := make([]byte, size)
+		size, err = syscall.Getxattr(path, name, buffer)
+		if err != nil {
+			if err == syscall.ERANGE {
+				// grown since its size was retrieved
+				continue
+			}
+			if err == syscall.ENODATA {
+				return "", false, nil
+			}
+
+			return "", false, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+
+		return string(buffer[:size]), true, nil
+	}
+}
+
+// Sets the extended attribute of the file at the specified path.
+func SetXattr(path, name, value string) error {
+	if err := syscall.Setxattr(path, name, []byte(value), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+
+	return nil
+}
+
+// Removes the extended attribute of the file at the specified path, if it is
+// set.
+func RemoveXattr(path, name string) error {
+	if err := syscall.Removexattr(path, name); err != nil && err != syscall.ENODATA {
+		return &os.PathError{Op: "removexattr", Path: path, Err: err}
+	}
+
+	return nil
+}
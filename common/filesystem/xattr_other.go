@@ -0,0 +1,47 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux
+
+package filesystem
+
+import (
+	"errors"
+)
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// Retrieves the value of the extended attribute of the file at the specified
+// path, if it is set.
+//
+// Not supported on this platform.
+func Xattr(path, name string) (string, bool, error) {
+	return "", false, errXattrUnsupported
+}
+
+// Sets the extended attribute of the file at the specified path.
+//
+// Not supported on this platform.
+func SetXattr(path, name, value string) error {
+	return errXattrUnsupported
+}
+
+// Removes the extended attribute of the file at the specified path, if it is
+// set.
+//
+// Not supported on this platform.
+func RemoveXattr(path, name string) error {
+	return errXattrUnsupported
+}
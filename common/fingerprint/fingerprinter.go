@@ -24,103 +24,148 @@ import (
 	"hash"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/xxh3"
 	"golang.org/x/crypto/blake2b"
+	"lukechampine.com/blake3"
 )
 
 const sparseFingerprintThreshold = 5 * 1024 * 1024
 const sparseFingerprintSize = 512 * 1024
 
+// A store of previously calculated file fingerprints.
+type Cache interface {
+	// Retrieves the fingerprint for the file at path, if one is known that is
+	// still current for the file described by stat.
+	Get(path string, stat os.FileInfo) (Fingerprint, bool)
+
+	// Records the fingerprint calculated for the file at path.
+	Put(path string, stat os.FileInfo, fingerprint Fingerprint)
+}
+
 func Create(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string) (Fingerprint, error) {
+	return CreateWithCache(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm, nil)
+}
+
+// Creates a fingerprint, reusing the file fingerprints held by the cache, if
+// specified, both for the file itself and for the files within a directory.
+func CreateWithCache(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string, cache Cache) (Fingerprint, error) {
 	stat, err := os.Lstat(path)
 	if err != nil {
 		return Empty, err
 	}
 
 	if stat.Mode()&os.ModeSymlink != 0 {
-		if symlinkAlgorithm == "follow" {
+		if symlinkAlgorithm == FollowSymlinks {
 			stat, err = os.Stat(path)
 			if err != nil {
 				return Empty, err
 			}
 		} else {
-			return createSymlinkFingerprint(path, symlinkAlgorithm)
+			algorithm, err := LookupSymlinkAlgorithm(symlinkAlgorithm)
+			if err != nil {
+				return Empty, err
+			}
+
+			return algorithm.Create(path)
 		}
 	}
 
 	switch {
 	case stat.Mode().IsDir():
-		return createDirectoryFingerprint(path, directoryAlgorithm)
+		algorithm, err := LookupDirectoryAlgorithm(directoryAlgorithm)
+		if err != nil {
+			return Empty, err
+		}
+
+		fileAlgorithm, err := LookupFileAlgorithm(fileAlgorithm)
+		if err != nil {
+			return Empty, err
+		}
+
+		return algorithm.Create(path, stat, DirectoryContext{fileAlgorithm, cache})
 	case stat.Mode().IsRegular():
-		return createFileFingerprint(path, fileAlgorithm, stat)
+		algorithm, err := LookupFileAlgorithm(fileAlgorithm)
+		if err != nil {
+			return Empty, err
+		}
+
+		return createFileFingerprint(path, stat, algorithm, cache)
 	default:
 		return Empty, fmt.Errorf("unsupported file mode '%v'", stat.Mode())
 	}
 }
 
+// Creates the fingerprint for the regular file at path using the algorithm,
+// unless the cache already holds it.
+func createFileFingerprint(path string, stat os.FileInfo, algorithm FileAlgorithm, cache Cache) (Fingerprint, error) {
+	if cache == nil {
+		return algorithm.Create(path, stat)
+	}
+
+	if fingerprint, found := cache.Get(path, stat); found {
+		return fingerprint, nil
+	}
+
+	fingerprint, err := algorithm.Create(path, stat)
+	if err != nil {
+		return Empty, err
+	}
+
+	cache.Put(path, stat, fingerprint)
+
+	return fingerprint, nil
+}
+
 // unexported
 
-func createFileFingerprint(path, algorithm string, stat os.FileInfo) (Fingerprint, error) {
-	switch algorithm {
-	case "dynamic:SHA256", "":
-		return dynamicFingerprint(path, sha256.New(), stat.Size())
-	case "dynamic:SHA1":
-		return dynamicFingerprint(path, sha1.New(), stat.Size())
-	case "dynamic:MD5":
-		return dynamicFingerprint(path, md5.New(), stat.Size())
-	case "dynamic:BLAKE2b":
-		hash, err := blake2b.New256(nil)
-		if err != nil {
-			// Should never happen actually.
-			return "", err
-		}
-		return dynamicFingerprint(path, hash, stat.Size())
-	case "SHA256":
-		return regularFingerprint(path, sha256.New())
-	case "SHA1":
-		return regularFingerprint(path, sha1.New())
-	case "MD5":
-		return regularFingerprint(path, md5.New())
-	case "BLAKE2b":
+func init() {
+	none := func(path string) (Fingerprint, error) {
+		return Empty, nil
+	}
+
+	RegisterHashAlgorithm("SHA256", sha256.New)
+	RegisterHashAlgorithm("SHA1", sha1.New)
+	RegisterHashAlgorithm("MD5", md5.New)
+	RegisterHashAlgorithm("BLAKE2b", func() hash.Hash {
 		hash, err := blake2b.New256(nil)
 		if err != nil {
 			// Should never happen actually.
-			return "", err
+			panic(err)
 		}
-		return regularFingerprint(path, hash)
-	case "none":
-		return Empty, nil
-	default:
-		return "", fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
-	}
-}
-
-func createDirectoryFingerprint(path, algorithm string) (Fingerprint, error) {
-	switch algorithm {
-	case "sumSizes":
+		return hash
+	})
+	RegisterHashAlgorithm("BLAKE3", func() hash.Hash { return blake3.New(32, nil) })
+	RegisterHashAlgorithm("xxHash64", func() hash.Hash { return xxhash.New() })
+	RegisterHashAlgorithm("XXH3", func() hash.Hash { return xxh3.New() })
+	RegisterFileAlgorithm("none", FileAlgorithmFunc(func(path string, stat os.FileInfo) (Fingerprint, error) {
+		return none(path)
+	}))
+
+	RegisterDirectoryAlgorithm("merkle", DirectoryAlgorithmFunc(func(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error) {
+		return merkleFingerprint(path, context)
+	}))
+	RegisterDirectoryAlgorithm("sumSizes", DirectoryAlgorithmFunc(func(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error) {
 		return sumSizesFingerprint(path, 0)
-	case "dynamic:sumSizes", "":
+	}))
+	RegisterDirectoryAlgorithm("dynamic:sumSizes", DirectoryAlgorithmFunc(func(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error) {
 		return sumSizesFingerprint(path, 500)
-	case "none":
-		return Empty, nil
-	default:
-		return "", fmt.Errorf("unsupported directory fingerprint algorithm '%v'", algorithm)
-	}
-}
+	}))
+	RegisterDirectoryAlgorithm("none", DirectoryAlgorithmFunc(func(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error) {
+		return none(path)
+	}))
 
-func createSymlinkFingerprint(path, algorithm string) (Fingerprint, error) {
-	switch algorithm {
-	case "targetName":
+	RegisterSymlinkAlgorithm("targetName", SymlinkAlgorithmFunc(func(path string) (Fingerprint, error) {
 		return symlinkTargetNameFingerprint(path, true)
-	case "targetNameNoExt":
+	}))
+	RegisterSymlinkAlgorithm("targetNameNoExt", SymlinkAlgorithmFunc(func(path string) (Fingerprint, error) {
 		return symlinkTargetNameFingerprint(path, false)
-	case "none":
-		return Empty, nil
-	default:
-		return Empty, fmt.Errorf("unsupported symbolic link fingerprint algorithm '%v'", algorithm)
-	}
+	}))
+	RegisterSymlinkAlgorithm("none", SymlinkAlgorithmFunc(none))
 }
 
 func regularFingerprint(path string, h hash.Hash) (Fingerprint, error) {
@@ -186,6 +231,63 @@ out:
 	return Fingerprint(strconv.FormatInt(totalSize, 16)), nil
 }
 
+// Creates a directory fingerprint from the names, types and fingerprints of
+// its entries, recursively, so that it changes if anything within the
+// directory is added, removed, renamed or modified. Files are fingerprinted
+// using the context's file algorithm and symbolic links by their target paths (which
+// are not followed).
+func merkleFingerprint(path string, context DirectoryContext) (Fingerprint, error) {
+	h := sha256.New()
+
+	entries := FileInfoSlice(stats(path))
+	sort.Sort(entries)
+
+	for _, entry := range entries {
+		childPath := filepath.Join(path, entry.Name())
+
+		var kind byte
+		var childFingerprint Fingerprint
+		var err error
+
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			kind = 'l'
+
+			var target string
+			target, err = os.Readlink(childPath)
+			childFingerprint = Fingerprint(target)
+		case entry.IsDir():
+			kind = 'd'
+			childFingerprint, err = merkleFingerprint(childPath, context)
+		case entry.Mode().IsRegular():
+			kind = 'f'
+			childFingerprint, err = createFileFingerprint(childPath, entry, context.FileAlgorithm, context.Cache)
+		default:
+			// devices, pipes and sockets have no content
+			kind = 'o'
+		}
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed whilst being fingerprinted
+				continue
+			}
+
+			return Empty, fmt.Errorf("'%v': could not fingerprint directory entry: %v", childPath, err)
+		}
+
+		if kind == 'd' {
+			// directory sizes depend upon the filesystem so are left out
+			fmt.Fprintf(h, "%c %v %v:%v\n", kind, len(entry.Name()), entry.Name(), childFingerprint)
+		} else {
+			fmt.Fprintf(h, "%c %v %v %v:%v\n", kind, entry.Size(), len(entry.Name()), entry.Name(), childFingerprint)
+		}
+	}
+
+	sum := h.Sum(make([]byte, 0, 64))
+	return Fingerprint(hex.EncodeToString(sum)), nil
+}
+
 func stats(path string) []os.FileInfo {
 	file, err := os.Open(path)
 	if err != nil {
@@ -16,6 +16,7 @@
 package fingerprint
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -46,6 +47,21 @@ func TestBLAKE2bGeneration(test *testing.T) {
 	testCreateForLargeFile(test, "BLAKE2b", "fdc4dc9cebbd6f162b3dad4d196646df430dbae8c547df01447285da55247087")
 }
 
+func TestBLAKE3Generation(test *testing.T) {
+	testCreateForSmallFile(test, "BLAKE3", "4adbd3632f65df346a2fe94332da172c70023e57de55a7582387dc1931055497")
+	testCreateForLargeFile(test, "BLAKE3", "a58cf067dcd469f8f0252b1564efaa1fae3eb6c15214e435fa6e2cb4b625c4c9")
+}
+
+func TestXxHash64Generation(test *testing.T) {
+	testCreateForSmallFile(test, "xxHash64", "1ae423e22e18ed7f")
+	testCreateForLargeFile(test, "xxHash64", "6383f4810c3006eb")
+}
+
+func TestXXH3Generation(test *testing.T) {
+	testCreateForSmallFile(test, "XXH3", "6f6bce614c84aa32")
+	testCreateForLargeFile(test, "XXH3", "d95b39c13e69045c")
+}
+
 func TestDynamicMD5Generation(test *testing.T) {
 	testCreateForSmallFile(test, "dynamic:MD5", "a758071b3c2fe43c9a9b91db5077cd12")
 	testCreateForLargeFile(test, "dynamic:MD5", "668a4b622482b9fd30b1ad0eac4ab8f1")
@@ -66,13 +82,121 @@ func TestDynamicBLAKE2bGeneration(test *testing.T) {
 	testCreateForLargeFile(test, "dynamic:BLAKE2b", "137c5b1e9e8107c176de7fb7a38f7670bb31364fadb2b5b883737c8732c78327")
 }
 
+func TestDynamicBLAKE3Generation(test *testing.T) {
+	testCreateForSmallFile(test, "dynamic:BLAKE3", "4adbd3632f65df346a2fe94332da172c70023e57de55a7582387dc1931055497")
+	testCreateForLargeFile(test, "dynamic:BLAKE3", "f04e34e4045c56fcd8f913984288e5ebbeb2ef47623c4da3398babfab7fc94d1")
+}
+
+func TestDynamicXxHash64Generation(test *testing.T) {
+	testCreateForSmallFile(test, "dynamic:xxHash64", "1ae423e22e18ed7f")
+	testCreateForLargeFile(test, "dynamic:xxHash64", "fa75e4588fc7771e")
+}
+
+func TestDynamicXXH3Generation(test *testing.T) {
+	testCreateForSmallFile(test, "dynamic:XXH3", "6f6bce614c84aa32")
+	testCreateForLargeFile(test, "dynamic:XXH3", "a0b51b9d65545653")
+}
+
 func TestNoneGeneration(test *testing.T) {
 	testCreateForSmallFile(test, "none", "")
 	testCreateForLargeFile(test, "none", "")
 }
 
+func TestMerkleDirectoryGeneration(test *testing.T) {
+	first := createTestTree(test, "tmsu-merkle-first")
+	defer os.RemoveAll(first)
+	second := createTestTree(test, "tmsu-merkle-second")
+	defer os.RemoveAll(second)
+
+	firstFingerprint := createMerkle(test, first, nil)
+	if firstFingerprint != createMerkle(test, second, nil) {
+		test.Fatalf("Fingerprints of identical directories differ")
+	}
+
+	// grow then shrink the subdirectory, which changes its size on some filesystems
+	temporaryPaths := make([]string, 200)
+	for index := range temporaryPaths {
+		temporaryPaths[index] = filepath.Join(second, "sub", fmt.Sprintf("temporary-file-with-a-long-name-%v", index))
+		if err := os.WriteFile(temporaryPaths[index], nil, 0600); err != nil {
+			test.Fatal(err.Error())
+		}
+	}
+	for _, path := range temporaryPaths {
+		if err := os.Remove(path); err != nil {
+			test.Fatal(err.Error())
+		}
+	}
+	if createMerkle(test, second, nil) != firstFingerprint {
+		test.Fatalf("Fingerprint changed with the size of a nested directory")
+	}
+
+	if err := os.Rename(filepath.Join(second, "sub", "b"), filepath.Join(second, "sub", "c")); err != nil {
+		test.Fatal(err.Error())
+	}
+	if createMerkle(test, second, nil) == firstFingerprint {
+		test.Fatalf("Fingerprint did not change when a nested file was renamed")
+	}
+
+	if err := os.Rename(filepath.Join(second, "sub", "c"), filepath.Join(second, "sub", "b")); err != nil {
+		test.Fatal(err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(second, "sub", "b"), []byte("brinjal"), 0600); err != nil {
+		test.Fatal(err.Error())
+	}
+	if createMerkle(test, second, nil) == firstFingerprint {
+		test.Fatalf("Fingerprint did not change when a nested file was modified")
+	}
+}
+
+func TestMerkleDirectoryGenerationWithCache(test *testing.T) {
+	path := createTestTree(test, "tmsu-merkle-cache")
+	defer os.RemoveAll(path)
+
+	expected := createMerkle(test, path, nil)
+
+	cache := &mapCache{make(map[string]Fingerprint), 0}
+	if fingerprint := createMerkle(test, path, cache); fingerprint != expected {
+		test.Fatalf("Fingerprint incorrect: expected '%v' but was '%v'", expected, fingerprint)
+	}
+	if len(cache.fingerprints) != 2 || cache.hits != 0 {
+		test.Fatalf("Expected 2 cached fingerprints and no hits but there were %v and %v", len(cache.fingerprints), cache.hits)
+	}
+
+	cache.fingerprints[filepath.Join(path, "a")] = "cached"
+	if fingerprint := createMerkle(test, path, cache); fingerprint == expected {
+		test.Fatalf("Cached fingerprint was not used")
+	}
+	if cache.hits != 2 {
+		test.Fatalf("Expected 2 cache hits but there were %v", cache.hits)
+	}
+}
+
 // unexported
 
+func createTestTree(test *testing.T, name string) string {
+	path := filepath.Join(os.TempDir(), name)
+	if err := os.MkdirAll(filepath.Join(path, "sub"), 0700); err != nil {
+		test.Fatal(err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(path, "a"), []byte("aubergine"), 0600); err != nil {
+		test.Fatal(err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(path, "sub", "b"), []byte("eggplant"), 0600); err != nil {
+		test.Fatal(err.Error())
+	}
+
+	return path
+}
+
+func createMerkle(test *testing.T, path string, cache Cache) Fingerprint {
+	fingerprint, err := CreateWithCache(path, "SHA256", "merkle", "none", cache)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+
+	return fingerprint
+}
+
 func testCreateForSmallFile(test *testing.T, algorithm string, expectedFingerprint Fingerprint) {
 	testCreateForFile(test, algorithm, 2*1024*1024, expectedFingerprint)
 }
@@ -103,3 +227,21 @@ func testCreateForFile(test *testing.T, algorithm string, size uint, expectedFin
 		test.Fatalf("Fingerprint incorrect: expected '%v' but was '%v'", expectedFingerprint, fingerprint)
 	}
 }
+
+type mapCache struct {
+	fingerprints map[string]Fingerprint
+	hits         int
+}
+
+func (cache *mapCache) Get(path string, stat os.FileInfo) (Fingerprint, bool) {
+	fingerprint, found := cache.fingerprints[path]
+	if found {
+		cache.hits++
+	}
+
+	return fingerprint, found
+}
+
+func (cache *mapCache) Put(path string, stat os.FileInfo, fingerprint Fingerprint) {
+	cache.fingerprints[path] = fingerprint
+}
@@ -0,0 +1,234 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Creates a perceptual fingerprint for the image at the specified path.
+//
+// Unlike a content fingerprint, a perceptual fingerprint of a visually similar
+// image differs in only a few bits, so the number of differing bits (see
+// Distance) indicates how alike two images look. An empty fingerprint is
+// returned if the file is not a JPEG, PNG or GIF image.
+func CreateImage(path, algorithm string) (Fingerprint, error) {
+	if algorithm == NoImageAlgorithm || algorithm == "" {
+		return Empty, nil
+	}
+
+	imageAlgorithm, err := LookupImageAlgorithm(algorithm)
+	if err != nil {
+		return Empty, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Empty, err
+	}
+	if !stat.Mode().IsRegular() {
+		return Empty, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		if err == image.ErrFormat {
+			return Empty, nil
+		}
+
+		return Empty, fmt.Errorf("could not decode image: %v", err)
+	}
+
+	return Fingerprint(fmt.Sprintf("%016x", imageAlgorithm.Hash(img))), nil
+}
+
+// Calculates the number of bits that differ between two perceptual fingerprints.
+func Distance(a, b Fingerprint) (int, error) {
+	aBits, err := ImageBits(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bBits, err := ImageBits(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return BitDistance(aBits, bBits), nil
+}
+
+// Decodes a perceptual fingerprint into its 64 bits, so that it may be compared
+// repeatedly using BitDistance.
+func ImageBits(fp Fingerprint) (uint64, error) {
+	fpBits, err := strconv.ParseUint(string(fp), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image fingerprint '%v'", fp)
+	}
+
+	return fpBits, nil
+}
+
+// Calculates the number of bits that differ between two decoded perceptual
+// fingerprints.
+func BitDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// unexported
+
+func init() {
+	RegisterImageAlgorithm("aHash", ImageAlgorithmFunc(averageHash))
+	RegisterImageAlgorithm("dHash", ImageAlgorithmFunc(differenceHash))
+	RegisterImageAlgorithm("pHash", ImageAlgorithmFunc(perceptualHash))
+}
+
+// Sets a bit for each pixel of an 8x8 thumbnail that is brighter than the mean.
+func averageHash(img image.Image) uint64 {
+	pixels := shrink(img, 8, 8)
+
+	var mean float64
+	for _, pixel := range pixels {
+		mean += pixel
+	}
+	mean /= float64(len(pixels))
+
+	var hash uint64
+	for _, pixel := range pixels {
+		hash <<= 1
+		if pixel > mean {
+			hash |= 1
+		}
+	}
+
+	return hash
+}
+
+// Sets a bit for each pixel of a 9x8 thumbnail that is brighter than its right-hand neighbour.
+func differenceHash(img image.Image) uint64 {
+	pixels := shrink(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// Sets a bit for each of the lowest 8x8 frequencies of the discrete cosine
+// transform of a 32x32 thumbnail that exceeds the median.
+func perceptualHash(img image.Image) uint64 {
+	const size = 32
+	pixels := shrink(img, size, size)
+
+	// separable 2D DCT-II, retaining only the lowest 8x8 frequencies
+	var rows [size][8]float64
+	for y := 0; y < size; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += pixels[y*size+x] * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*size))
+			}
+			rows[y][u] = sum
+		}
+	}
+
+	coefficients := make([]float64, 0, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*size))
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// the first coefficient is the average brightness so excluded from the median
+	median := median(coefficients[1:])
+
+	var hash uint64
+	for _, coefficient := range coefficients {
+		hash <<= 1
+		if coefficient > median {
+			hash |= 1
+		}
+	}
+
+	return hash
+}
+
+// Reduces the image to a greyscale thumbnail by averaging the pixels that fall within each cell.
+func shrink(img image.Image, width, height int) []float64 {
+	bounds := img.Bounds()
+	sums := make([]float64, width*height)
+	counts := make([]int, width*height)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * height / bounds.Dy()
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * width / bounds.Dx()
+
+			r, g, b, _ := img.At(x, y).RGBA()
+			luminance := 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+
+			sums[cellY*width+cellX] += luminance
+			counts[cellY*width+cellX]++
+		}
+	}
+
+	for index := range sums {
+		if counts[index] > 0 {
+			sums[index] /= float64(counts[index])
+		}
+	}
+
+	return sums
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
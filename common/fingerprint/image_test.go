@@ -0,0 +1,165 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAverageHashSimilarity(test *testing.T) {
+	testImageSimilarity(test, "aHash")
+}
+
+func TestDifferenceHashSimilarity(test *testing.T) {
+	testImageSimilarity(test, "dHash")
+}
+
+func TestPerceptualHashSimilarity(test *testing.T) {
+	testImageSimilarity(test, "pHash")
+}
+
+func TestImageFingerprintOfNonImage(test *testing.T) {
+	// set-up
+
+	tempFilePath := filepath.Join(os.TempDir(), "tmsu-image-fingerprint")
+	if err := ioutil.WriteFile(tempFilePath, []byte("not an image"), 0600); err != nil {
+		test.Fatal(err.Error())
+	}
+	defer os.Remove(tempFilePath)
+
+	// test
+
+	fingerprint, err := CreateImage(tempFilePath, "dHash")
+
+	// validate
+
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	if fingerprint != Empty {
+		test.Fatalf("Expected empty fingerprint but was '%v'.", fingerprint)
+	}
+}
+
+func TestDistance(test *testing.T) {
+	distance, err := Distance("00000000000000ff", "000000000000000f")
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	if distance != 4 {
+		test.Fatalf("Expected distance of 4 but was %v.", distance)
+	}
+}
+
+// unexported
+
+func testImageSimilarity(test *testing.T, algorithm string) {
+	// set-up
+
+	tempDir, err := ioutil.TempDir("", "tmsu-image")
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+
+	original := filepath.Join(tempDir, "original.png")
+	writeImage(test, original, testPattern(64, 48, false), false)
+
+	resized := filepath.Join(tempDir, "resized.jpg")
+	writeImage(test, resized, testPattern(128, 96, false), true)
+
+	different := filepath.Join(tempDir, "different.png")
+	writeImage(test, different, testPattern(64, 48, true), false)
+
+	// test
+
+	originalFingerprint := createImage(test, original, algorithm)
+	resizedFingerprint := createImage(test, resized, algorithm)
+	differentFingerprint := createImage(test, different, algorithm)
+
+	// validate
+
+	similar, err := Distance(originalFingerprint, resizedFingerprint)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	if similar > 6 {
+		test.Fatalf("Expected resized image to be similar but distance was %v.", similar)
+	}
+
+	dissimilar, err := Distance(originalFingerprint, differentFingerprint)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	if dissimilar < 20 {
+		test.Fatalf("Expected different image to be dissimilar but distance was %v.", dissimilar)
+	}
+}
+
+// Draws a pattern of diagonal bands, optionally mirrored.
+func testPattern(width, height int, mirrored bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u := x * 64 / width
+			v := y * 48 / height
+			if mirrored {
+				u = 63 - u
+			}
+
+			img.SetGray(x, y, color.Gray{uint8((u*u + v*3) % 256)})
+		}
+	}
+
+	return img
+}
+
+func writeImage(test *testing.T, path string, img image.Image, asJpeg bool) {
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	defer file.Close()
+
+	if asJpeg {
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(file, img)
+	}
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+}
+
+func createImage(test *testing.T, path, algorithm string) Fingerprint {
+	fingerprint, err := CreateImage(path, algorithm)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	if fingerprint == Empty {
+		test.Fatalf("Expected a fingerprint for '%v'.", path)
+	}
+
+	return fingerprint
+}
@@ -0,0 +1,225 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sort"
+
+	"github.com/oniony/TMSU/common/filesystem"
+)
+
+// The number of files read concurrently from any one device.
+const defaultPerDevice = 2
+
+// ErrCancelled is returned when fingerprinting is cancelled before it completes.
+var ErrCancelled = errors.New("fingerprinting cancelled")
+
+// Result is the outcome of fingerprinting a single path.
+type Result struct {
+	Path             string
+	Fingerprint      Fingerprint
+	Err              error
+	ImageFingerprint Fingerprint
+	ImageErr         error
+}
+
+// Progress describes how far through its work a pool has got.
+type Progress struct {
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// Pool fingerprints files concurrently using a bounded number of workers.
+//
+// So as not to thrash the disks, at most PerDevice files are read from any one
+// device at a time and the work is interleaved across devices so that files on
+// separate devices are read in parallel. Within a device the files are read in
+// path order so that the files of a directory are read together.
+type Pool struct {
+	FileAlgorithm      string
+	DirectoryAlgorithm string
+	SymlinkAlgorithm   string
+	ImageAlgorithm     string
+	Cache              Cache
+	Workers            int
+	PerDevice          int
+	Progress           func(Progress)
+}
+
+// Creates a pool with a worker per CPU. Perceptual image fingerprints are
+// calculated too if an ImageAlgorithm is set. The Cache, if set, may be
+// called concurrently.
+func NewPool(fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string) *Pool {
+	return &Pool{
+		FileAlgorithm:      fileAlgorithm,
+		DirectoryAlgorithm: directoryAlgorithm,
+		SymlinkAlgorithm:   symlinkAlgorithm,
+		Workers:            runtime.NumCPU(),
+		PerDevice:          defaultPerDevice,
+	}
+}
+
+// Fingerprints the specified paths, returning the results in the same order as
+// the paths. Closing the cancel channel abandons the outstanding work, in which
+// case ErrCancelled is returned.
+func (pool *Pool) CreateAll(paths []string, cancel <-chan struct{}) ([]Result, error) {
+	jobs, bytesTotal := pool.schedule(paths)
+	results := make([]Result, len(paths))
+
+	workers := pool.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	perDevice := pool.PerDevice
+	if perDevice < 1 {
+		perDevice = 1
+	}
+
+	semaphores := make(map[uint64]chan struct{})
+	for _, job := range jobs {
+		if _, ok := semaphores[job.device]; !ok {
+			semaphores[job.device] = make(chan struct{}, perDevice)
+		}
+	}
+
+	queue := make(chan poolJob)
+	done := make(chan poolJob)
+
+	go func() {
+		for _, job := range jobs {
+			queue <- job
+		}
+		close(queue)
+	}()
+
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			for job := range queue {
+				if !cancelled(cancel) {
+					semaphore := semaphores[job.device]
+					semaphore <- struct{}{}
+					results[job.index] = pool.create(job.path)
+					<-semaphore
+				}
+
+				done <- job
+			}
+		}()
+	}
+
+	progress := Progress{0, len(jobs), 0, bytesTotal}
+	for range jobs {
+		job := <-done
+
+		progress.FilesDone++
+		progress.BytesDone += job.size
+
+		if pool.Progress != nil {
+			pool.Progress(progress)
+		}
+	}
+
+	if cancelled(cancel) {
+		return nil, ErrCancelled
+	}
+
+	return results, nil
+}
+
+// unexported
+
+type poolJob struct {
+	index  int
+	path   string
+	device uint64
+	size   int64
+}
+
+func (pool *Pool) create(path string) Result {
+	fingerprint, err := CreateWithCache(path, pool.FileAlgorithm, pool.DirectoryAlgorithm, pool.SymlinkAlgorithm, pool.Cache)
+	result := Result{Path: path, Fingerprint: fingerprint, Err: err}
+
+	if err == nil {
+		result.ImageFingerprint, result.ImageErr = CreateImage(path, pool.ImageAlgorithm)
+	}
+
+	return result
+}
+
+// Orders the work so that consecutive jobs are for different devices.
+func (pool *Pool) schedule(paths []string) ([]poolJob, int64) {
+	byDevice := make(map[uint64][]poolJob)
+	devices := make([]uint64, 0, 1)
+	var bytesTotal int64
+
+	for index, path := range paths {
+		job := poolJob{index, path, 0, 0}
+
+		stat, err := os.Lstat(path)
+		if err == nil && stat.Mode()&os.ModeSymlink != 0 && pool.SymlinkAlgorithm == "follow" {
+			stat, err = os.Stat(path)
+		}
+		if err == nil {
+			if device, _, ok := filesystem.Identity(stat); ok {
+				job.device = device
+			}
+			if stat.Mode().IsRegular() {
+				job.size = stat.Size()
+				bytesTotal += job.size
+			}
+		}
+
+		if _, ok := byDevice[job.device]; !ok {
+			devices = append(devices, job.device)
+		}
+		byDevice[job.device] = append(byDevice[job.device], job)
+	}
+
+	for _, deviceJobs := range byDevice {
+		sort.Slice(deviceJobs, func(i, j int) bool { return deviceJobs[i].path < deviceJobs[j].path })
+	}
+
+	jobs := make([]poolJob, 0, len(paths))
+	for len(jobs) < len(paths) {
+		for _, device := range devices {
+			deviceJobs := byDevice[device]
+			if len(deviceJobs) > 0 {
+				jobs = append(jobs, deviceJobs[0])
+				byDevice[device] = deviceJobs[1:]
+			}
+		}
+	}
+
+	return jobs, bytesTotal
+}
+
+func cancelled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
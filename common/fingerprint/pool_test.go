@@ -0,0 +1,103 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPoolCreateAll(test *testing.T) {
+	// set-up
+
+	tempDir, err := ioutil.TempDir("", "tmsu-pool")
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+
+	paths := make([]string, 20)
+	for index := range paths {
+		paths[index] = filepath.Join(tempDir, "file"+strconv.Itoa(index))
+		if err := ioutil.WriteFile(paths[index], []byte(strconv.Itoa(index)), 0600); err != nil {
+			test.Fatal(err.Error())
+		}
+	}
+
+	pool := NewPool("SHA256", "none", "none")
+	var last Progress
+	pool.Progress = func(progress Progress) {
+		last = progress
+	}
+
+	// test
+
+	results, err := pool.CreateAll(paths, nil)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+
+	// validate
+
+	if len(results) != len(paths) {
+		test.Fatalf("Expected %v results but were %v.", len(paths), len(results))
+	}
+	for index, result := range results {
+		if result.Path != paths[index] {
+			test.Fatalf("Expected result %v to be for '%v' but was for '%v'.", index, paths[index], result.Path)
+		}
+
+		expected, err := Create(paths[index], "SHA256", "none", "none")
+		if err != nil {
+			test.Fatal(err.Error())
+		}
+		if result.Fingerprint != expected {
+			test.Fatalf("Fingerprint incorrect: expected '%v' but was '%v'", expected, result.Fingerprint)
+		}
+	}
+	if last.FilesDone != len(paths) || last.FilesTotal != len(paths) {
+		test.Fatalf("Expected progress of %v/%v files but was %v/%v.", len(paths), len(paths), last.FilesDone, last.FilesTotal)
+	}
+	if last.BytesDone != last.BytesTotal {
+		test.Fatalf("Expected progress of %v/%v bytes but was %v/%v.", last.BytesTotal, last.BytesTotal, last.BytesDone, last.BytesTotal)
+	}
+}
+
+func TestPoolCreateAllCancelled(test *testing.T) {
+	// set-up
+
+	tempFilePath := filepath.Join(os.TempDir(), "tmsu-pool-cancelled")
+	if err := ioutil.WriteFile(tempFilePath, []byte("!"), 0600); err != nil {
+		test.Fatal(err.Error())
+	}
+	defer os.Remove(tempFilePath)
+
+	cancel := make(chan struct{})
+	close(cancel)
+
+	// test
+
+	_, err := NewPool("SHA256", "none", "none").CreateAll([]string{tempFilePath, tempFilePath}, cancel)
+
+	// validate
+
+	if err != ErrCancelled {
+		test.Fatalf("Expected cancellation error but was '%v'.", err)
+	}
+}
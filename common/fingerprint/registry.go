@@ -0,0 +1,273 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"fmt"
+	"hash"
+	"image"
+	"os"
+	"sort"
+	"sync"
+)
+
+// The symbolic link algorithm that fingerprints the target of the link instead.
+const FollowSymlinks = "follow"
+
+// The image algorithm that disables perceptual image fingerprints.
+const NoImageAlgorithm = "none"
+
+// A file fingerprint algorithm.
+type FileAlgorithm interface {
+	// Creates the fingerprint of the regular file at path.
+	Create(path string, stat os.FileInfo) (Fingerprint, error)
+}
+
+// A directory fingerprint algorithm.
+type DirectoryAlgorithm interface {
+	// Creates the fingerprint of the directory at path. The context's file
+	// algorithm and cache may be used to fingerprint the directory contents.
+	Create(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error)
+}
+
+// A symbolic link fingerprint algorithm.
+type SymlinkAlgorithm interface {
+	// Creates the fingerprint of the symbolic link at path.
+	Create(path string) (Fingerprint, error)
+}
+
+// A perceptual image fingerprint algorithm.
+type ImageAlgorithm interface {
+	// Creates the 64-bit perceptual hash of the decoded image.
+	Hash(img image.Image) uint64
+}
+
+// The means available to a directory algorithm for fingerprinting the files
+// within the directory.
+type DirectoryContext struct {
+	FileAlgorithm FileAlgorithm
+	Cache         Cache
+}
+
+// Adapts a function to a FileAlgorithm.
+type FileAlgorithmFunc func(path string, stat os.FileInfo) (Fingerprint, error)
+
+func (f FileAlgorithmFunc) Create(path string, stat os.FileInfo) (Fingerprint, error) {
+	return f(path, stat)
+}
+
+// Adapts a function to a DirectoryAlgorithm.
+type DirectoryAlgorithmFunc func(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error)
+
+func (f DirectoryAlgorithmFunc) Create(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error) {
+	return f(path, stat, context)
+}
+
+// Adapts a function to a SymlinkAlgorithm.
+type SymlinkAlgorithmFunc func(path string) (Fingerprint, error)
+
+func (f SymlinkAlgorithmFunc) Create(path string) (Fingerprint, error) {
+	return f(path)
+}
+
+// Adapts a function to an ImageAlgorithm.
+type ImageAlgorithmFunc func(img image.Image) uint64
+
+func (f ImageAlgorithmFunc) Hash(img image.Image) uint64 {
+	return f(img)
+}
+
+// Registers a file fingerprint algorithm under the specified name, which may
+// then be used for the 'fileFingerprintAlgorithm' setting. Panics if an
+// algorithm is already registered with the name.
+func RegisterFileAlgorithm(name string, algorithm FileAlgorithm) {
+	register(registry.file, name, algorithm)
+}
+
+// Registers a directory fingerprint algorithm under the specified name, which
+// may then be used for the 'directoryFingerprintAlgorithm' setting. Panics if
+// an algorithm is already registered with the name.
+func RegisterDirectoryAlgorithm(name string, algorithm DirectoryAlgorithm) {
+	register(registry.directory, name, algorithm)
+}
+
+// Registers a symbolic link fingerprint algorithm under the specified name,
+// which may then be used for the 'symlinkFingerprintAlgorithm' setting. Panics
+// if an algorithm is already registered with the name.
+func RegisterSymlinkAlgorithm(name string, algorithm SymlinkAlgorithm) {
+	if name == FollowSymlinks {
+		panic("fingerprint: symbolic link algorithm name '" + name + "' is reserved")
+	}
+
+	register(registry.symlink, name, algorithm)
+}
+
+// Registers a perceptual image fingerprint algorithm under the specified name,
+// which may then be used for the 'imageFingerprintAlgorithm' setting. Panics
+// if an algorithm is already registered with the name.
+func RegisterImageAlgorithm(name string, algorithm ImageAlgorithm) {
+	if name == NoImageAlgorithm {
+		panic("fingerprint: image algorithm name '" + name + "' is reserved")
+	}
+
+	register(registry.image, name, algorithm)
+}
+
+// Registers a file fingerprint algorithm for the hash function, both as name,
+// which hashes the entire file, and as 'dynamic:name', which hashes only
+// samples of larger files.
+func RegisterHashAlgorithm(name string, newHash func() hash.Hash) {
+	RegisterFileAlgorithm(name, FileAlgorithmFunc(func(path string, stat os.FileInfo) (Fingerprint, error) {
+		return regularFingerprint(path, newHash())
+	}))
+
+	RegisterFileAlgorithm("dynamic:"+name, FileAlgorithmFunc(func(path string, stat os.FileInfo) (Fingerprint, error) {
+		return dynamicFingerprint(path, newHash(), stat.Size())
+	}))
+}
+
+// The names of the registered file fingerprint algorithms.
+func FileAlgorithms() []string {
+	return names(registry.file)
+}
+
+// The names of the registered directory fingerprint algorithms.
+func DirectoryAlgorithms() []string {
+	return names(registry.directory)
+}
+
+// The names of the registered symbolic link fingerprint algorithms, including
+// 'follow'.
+func SymlinkAlgorithms() []string {
+	names := append(names(registry.symlink), FollowSymlinks)
+	sort.Strings(names)
+
+	return names
+}
+
+// The names of the registered perceptual image fingerprint algorithms,
+// including 'none'.
+func ImageAlgorithms() []string {
+	names := append(names(registry.image), NoImageAlgorithm)
+	sort.Strings(names)
+
+	return names
+}
+
+// Retrieves the file fingerprint algorithm with the specified name.
+func LookupFileAlgorithm(name string) (FileAlgorithm, error) {
+	if name == "" {
+		name = defaultFileAlgorithm
+	}
+
+	algorithm, ok := lookupAlgorithm(registry.file, name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file fingerprint algorithm '%v'", name)
+	}
+
+	return algorithm.(FileAlgorithm), nil
+}
+
+// Retrieves the directory fingerprint algorithm with the specified name.
+func LookupDirectoryAlgorithm(name string) (DirectoryAlgorithm, error) {
+	if name == "" {
+		name = defaultDirectoryAlgorithm
+	}
+
+	algorithm, ok := lookupAlgorithm(registry.directory, name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported directory fingerprint algorithm '%v'", name)
+	}
+
+	return algorithm.(DirectoryAlgorithm), nil
+}
+
+// Retrieves the symbolic link fingerprint algorithm with the specified name.
+func LookupSymlinkAlgorithm(name string) (SymlinkAlgorithm, error) {
+	algorithm, ok := lookupAlgorithm(registry.symlink, name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported symbolic link fingerprint algorithm '%v'", name)
+	}
+
+	return algorithm.(SymlinkAlgorithm), nil
+}
+
+// Retrieves the perceptual image fingerprint algorithm with the specified name.
+func LookupImageAlgorithm(name string) (ImageAlgorithm, error) {
+	algorithm, ok := lookupAlgorithm(registry.image, name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported image fingerprint algorithm '%v'", name)
+	}
+
+	return algorithm.(ImageAlgorithm), nil
+}
+
+// unexported
+
+const defaultFileAlgorithm = "dynamic:SHA256"
+const defaultDirectoryAlgorithm = "dynamic:sumSizes"
+
+var registry = struct {
+	sync.RWMutex
+	file      map[string]interface{}
+	directory map[string]interface{}
+	symlink   map[string]interface{}
+	image     map[string]interface{}
+}{
+	file:      make(map[string]interface{}),
+	directory: make(map[string]interface{}),
+	symlink:   make(map[string]interface{}),
+	image:     make(map[string]interface{}),
+}
+
+func register(algorithms map[string]interface{}, name string, algorithm interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if name == "" {
+		panic("fingerprint: algorithm name must be specified")
+	}
+	if algorithm == nil {
+		panic("fingerprint: algorithm '" + name + "' is nil")
+	}
+	if _, exists := algorithms[name]; exists {
+		panic("fingerprint: algorithm '" + name + "' is already registered")
+	}
+
+	algorithms[name] = algorithm
+}
+
+func lookupAlgorithm(algorithms map[string]interface{}, name string) (interface{}, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	algorithm, ok := algorithms[name]
+	return algorithm, ok
+}
+
+func names(algorithms map[string]interface{}) []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,107 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegisterFileAlgorithm(test *testing.T) {
+	RegisterFileAlgorithm("test:name", FileAlgorithmFunc(func(path string, stat os.FileInfo) (Fingerprint, error) {
+		return Fingerprint(stat.Name()), nil
+	}))
+
+	if !contains(FileAlgorithms(), "test:name") {
+		test.Fatalf("Registered algorithm is not listed: %v", FileAlgorithms())
+	}
+
+	tempFilePath := filepath.Join(os.TempDir(), "tmsu-registry")
+	if err := os.WriteFile(tempFilePath, []byte("aubergine"), 0600); err != nil {
+		test.Fatal(err.Error())
+	}
+	defer os.Remove(tempFilePath)
+
+	fingerprint, err := Create(tempFilePath, "test:name", "none", "none")
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	if fingerprint != "tmsu-registry" {
+		test.Fatalf("Fingerprint incorrect: expected 'tmsu-registry' but was '%v'", fingerprint)
+	}
+}
+
+func TestRegisterDuplicateAlgorithm(test *testing.T) {
+	defer func() {
+		if recover() == nil {
+			test.Fatalf("Expected registration of duplicate algorithm to panic")
+		}
+	}()
+
+	RegisterDirectoryAlgorithm("merkle", DirectoryAlgorithmFunc(func(path string, stat os.FileInfo, context DirectoryContext) (Fingerprint, error) {
+		return Empty, nil
+	}))
+}
+
+func TestBuiltInAlgorithms(test *testing.T) {
+	for _, name := range []string{"SHA256", "dynamic:SHA256", "XXH3", "dynamic:XXH3", "none"} {
+		if !contains(FileAlgorithms(), name) {
+			test.Fatalf("File algorithm '%v' is not listed", name)
+		}
+	}
+
+	for _, name := range []string{"merkle", "sumSizes", "dynamic:sumSizes", "none"} {
+		if !contains(DirectoryAlgorithms(), name) {
+			test.Fatalf("Directory algorithm '%v' is not listed", name)
+		}
+	}
+
+	for _, name := range []string{"follow", "targetName", "targetNameNoExt", "none"} {
+		if !contains(SymlinkAlgorithms(), name) {
+			test.Fatalf("Symbolic link algorithm '%v' is not listed", name)
+		}
+	}
+
+	if _, err := LookupFileAlgorithm("CRC32"); err == nil {
+		test.Fatalf("Expected unknown algorithm to be rejected")
+	}
+}
+
+// unexported
+
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestImageAlgorithms(test *testing.T) {
+	algorithms := ImageAlgorithms()
+	for _, name := range []string{"aHash", "dHash", "none", "pHash"} {
+		if !contains(algorithms, name) {
+			test.Fatalf("Image algorithm '%v' is not listed: %v", name, algorithms)
+		}
+	}
+
+	if _, err := CreateImage("/nonexistent", "bogus"); err == nil {
+		test.Fatal("Unsupported image algorithm was not rejected.")
+	}
+}
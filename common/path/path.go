@@ -88,6 +88,39 @@ func UnescapeOctal(path string) string {
 	return octalEscapePattern.ReplaceAllStringFunc(path, decodeChar)
 }
 
+// Converts the path to an absolute path with its symbolic links resolved.
+func Resolve(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(absPath)
+}
+
+// Determines whether the path, once symbolic links are resolved, is within one
+// of the directories. A path that cannot be resolved is within none of them.
+func Within(path string, directories []string) bool {
+	resolved, err := Resolve(path)
+	if err != nil {
+		return false
+	}
+
+	for _, directory := range directories {
+		resolvedDirectory, err := Resolve(directory)
+		if err != nil {
+			continue
+		}
+
+		relPath, err := filepath.Rel(resolvedDirectory, resolved)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func Dereference(path string) (string, error) {
 	stat, err := os.Lstat(path)
 	if err != nil {
@@ -16,6 +16,9 @@
 package path
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -43,3 +46,43 @@ func TestRelTo(test *testing.T) {
 		}
 	}
 }
+
+func TestWithin(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu-path")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	allowed := filepath.Join(dir, "allowed")
+	allowedSibling := filepath.Join(dir, "allowed-sibling")
+	for _, path := range []string{allowed, allowedSibling} {
+		if err := os.Mkdir(path, 0700); err != nil {
+			test.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(allowed, "file"), filepath.Join(allowedSibling, "file")} {
+		if err := ioutil.WriteFile(path, []byte("file"), 0600); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(allowedSibling, "file"), filepath.Join(allowed, "escape")); err != nil {
+		test.Fatal(err)
+	}
+
+	paths := map[string]bool{
+		allowed:                                                 true,
+		filepath.Join(allowed, "file"):                          true,
+		filepath.Join(allowed, "..", "allowed"):                 true,
+		filepath.Join(allowed, "missing"):                       false,
+		filepath.Join(allowed, "escape"):                        false,
+		filepath.Join(allowedSibling, "file"):                   false,
+		filepath.Join(allowed, "..", "allowed-sibling", "file"): false,
+		dir: false}
+
+	for path, expected := range paths {
+		if actual := Within(path, []string{allowed}); actual != expected {
+			test.Fatalf("Expected '%v' within '%v' to be %v but was %v", path, allowed, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// The minimum interval between redraws of a progress bar.
+const progressRedrawInterval = 100 * time.Millisecond
+
+// ProgressBar reports the progress of a long running operation on standard
+// error, showing the number of files and bytes processed and an estimate of
+// the time remaining.
+//
+// The methods may be called on a nil progress bar, in which case nothing is
+// shown.
+type ProgressBar struct {
+	label   string
+	started time.Time
+	drawn   time.Time
+	width   int
+}
+
+// Creates a progress bar with the specified label, or nil if standard error
+// is not a terminal.
+func NewProgressBar(label string) *ProgressBar {
+	width := ErrorWidth()
+	if width <= 0 {
+		return nil
+	}
+
+	return &ProgressBar{label, time.Now(), time.Time{}, width}
+}
+
+// Updates the progress bar.
+func (bar *ProgressBar) Update(filesDone, filesTotal int, bytesDone, bytesTotal int64) {
+	if bar == nil {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(bar.drawn) < progressRedrawInterval && filesDone < filesTotal {
+		return
+	}
+	bar.drawn = now
+
+	done, total := float64(filesDone), float64(filesTotal)
+	if bytesTotal > 0 {
+		done, total = float64(bytesDone), float64(bytesTotal)
+	}
+
+	fraction := 1.0
+	if total > 0 {
+		fraction = done / total
+	}
+
+	eta := "--"
+	elapsed := now.Sub(bar.started)
+	if fraction > 0 && elapsed > time.Second {
+		remaining := time.Duration(float64(elapsed)/fraction) - elapsed
+		eta = remaining.Round(time.Second).String()
+	}
+
+	status := fmt.Sprintf(" %v/%v files  %v/%v  ETA %v", filesDone, filesTotal, formatSize(bytesDone), formatSize(bytesTotal), eta)
+
+	barWidth := bar.width - len(bar.label) - len(status) - 4
+	if barWidth > 40 {
+		barWidth = 40
+	}
+
+	line := bar.label + status
+	if barWidth >= 10 {
+		filled := int(fraction * float64(barWidth))
+		line = bar.label + " [" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "]" + status
+	}
+
+	if len(line) > bar.width-1 {
+		line = line[:bar.width-1]
+	}
+
+	fmt.Fprintf(os.Stderr, "\r%-*v", bar.width-1, line)
+}
+
+// Removes the progress bar from the terminal.
+func (bar *ProgressBar) Clear() {
+	if bar == nil || bar.drawn.IsZero() {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\r%v\r", strings.Repeat(" ", bar.width-1))
+}
+
+// unexported
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%vB", bytes)
+	}
+
+	size := float64(bytes)
+	suffixes := "KMGTPE"
+	index := -1
+	for size >= unit && index < len(suffixes)-1 {
+		size /= unit
+		index++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", size, suffixes[index])
+}
@@ -28,9 +28,20 @@ func Colour() bool {
 }
 
 func Width() int {
+	return width(os.Stdout)
+}
+
+// The width of the terminal attached to standard error, or zero if it is not a terminal.
+func ErrorWidth() int {
+	return width(os.Stderr)
+}
+
+// unexported
+
+func width(file *os.File) int {
 	var s winsize
 
-	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&s)))
+	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&s)))
 
 	return int(s.cols)
 }
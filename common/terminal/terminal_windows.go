@@ -28,7 +28,18 @@ func Colour() bool {
 }
 
 func Width() int {
-	outHandle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
+	return width(syscall.STD_OUTPUT_HANDLE)
+}
+
+// The width of the console attached to standard error, or zero if it is not a console.
+func ErrorWidth() int {
+	return width(syscall.STD_ERROR_HANDLE)
+}
+
+// unexported
+
+func width(stdHandle int) int {
+	outHandle, err := syscall.GetStdHandle(stdHandle)
 	if err != nil {
 		return 0
 	}
@@ -58,13 +58,14 @@ func (fileIds FileIds) Uniq() FileIds {
 }
 
 type File struct {
-	Id          FileId
-	Directory   string
-	Name        string
-	Fingerprint fingerprint.Fingerprint
-	ModTime     time.Time
-	Size        int64
-	IsDir       bool
+	Id                   FileId
+	Directory            string
+	Name                 string
+	Fingerprint          fingerprint.Fingerprint
+	FingerprintAlgorithm string
+	ModTime              time.Time
+	Size                 int64
+	IsDir                bool
 }
 
 func (file File) Path() string {
@@ -85,6 +86,16 @@ func (files Files) Where(predicate func(*File) bool) Files {
 	return result
 }
 
+func (files Files) Paths() []string {
+	paths := make([]string, len(files))
+
+	for index, file := range files {
+		paths[index] = file.Path()
+	}
+
+	return paths
+}
+
 type FileTagCount struct {
 	FileId    FileId
 	Directory string
@@ -54,6 +54,14 @@ func (settings Settings) SymlinkFingerprintAlgorithm() string {
 	return settings.Value("symlinkFingerprintAlgorithm")
 }
 
+func (settings Settings) ImageFingerprintAlgorithm() string {
+	return settings.Value("imageFingerprintAlgorithm")
+}
+
+func (settings Settings) MetadataTags() string {
+	return settings.Value("metadataTags")
+}
+
 func (settings Settings) ReportDuplicates() bool {
 	return settings.BoolValue("reportDuplicates")
 }
@@ -3,7 +3,12 @@ module github.com/oniony/TMSU
 go 1.16
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0
 	github.com/hanwen/go-fuse v1.0.0
 	github.com/mattn/go-sqlite3 v1.14.7
+	github.com/peterh/liner v1.2.2
+	github.com/zeebo/xxh3 v1.0.2
 	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	golang.org/x/net v0.0.0-20210525063256-abc453219eb5
+	lukechampine.com/blake3 v1.1.7
 )
@@ -0,0 +1,196 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// unexported
+
+const (
+	tiffMake             = 0x010F
+	tiffModel            = 0x0110
+	tiffDateTime         = 0x0132
+	tiffExifPointer      = 0x8769
+	tiffGpsPointer       = 0x8825
+	exifDateTimeOriginal = 0x9003
+	gpsLatitude          = 0x0002
+)
+
+type ifdEntry struct {
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+type ifd map[uint16]ifdEntry
+
+// Finds the EXIF data amongst the segments of a JPEG image.
+func readJpeg(reader io.ReaderAt, size int64, fields Fields) error {
+	offset := int64(2)
+	marker := make([]byte, 4)
+
+	for offset+4 <= size {
+		if _, err := reader.ReadAt(marker, offset); err != nil {
+			return err
+		}
+		if marker[0] != 0xFF {
+			return fmt.Errorf("invalid JPEG segment marker at offset %v", offset)
+		}
+
+		switch {
+		case marker[1] == 0xFF:
+			// padding
+			offset++
+			continue
+		case marker[1] == 0x01, marker[1] >= 0xD0 && marker[1] <= 0xD8:
+			// markers without a payload
+			offset += 2
+			continue
+		case marker[1] == 0xDA, marker[1] == 0xD9:
+			// start of scan or end of image: no more metadata
+			return nil
+		}
+
+		length := int64(binary.BigEndian.Uint16(marker[2:]))
+
+		if marker[1] == 0xE1 && length > 8 {
+			signature := make([]byte, 6)
+			if _, err := reader.ReadAt(signature, offset+4); err != nil {
+				return err
+			}
+
+			if bytes.Equal(signature, []byte("Exif\x00\x00")) {
+				return readTiff(io.NewSectionReader(reader, offset+10, length-8), fields)
+			}
+		}
+
+		offset += 2 + length
+	}
+
+	return nil
+}
+
+// Reads the camera, date taken and GPS presence from TIFF structured data, as
+// used both by TIFF images and the EXIF segment of JPEG images.
+func readTiff(reader *io.SectionReader, fields Fields) error {
+	header := make([]byte, 8)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		return err
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("invalid TIFF byte order")
+	}
+
+	ifd0, err := readIfd(reader, order, int64(order.Uint32(header[4:])))
+	if err != nil {
+		return err
+	}
+
+	makeName := ifd0.text(reader, order, tiffMake)
+	model := ifd0.text(reader, order, tiffModel)
+	switch {
+	case model == "":
+		fields.set("camera", makeName)
+	case makeName == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(makeName)):
+		fields.set("camera", model)
+	default:
+		fields.set("camera", makeName+" "+model)
+	}
+
+	if offset, ok := ifd0.long(order, tiffExifPointer); ok {
+		exif, err := readIfd(reader, order, int64(offset))
+		if err == nil {
+			fields.setDate(exif.text(reader, order, exifDateTimeOriginal))
+		}
+	}
+	fields.setDate(ifd0.text(reader, order, tiffDateTime))
+
+	if offset, ok := ifd0.long(order, tiffGpsPointer); ok {
+		gps, err := readIfd(reader, order, int64(offset))
+		if err == nil {
+			if _, ok := gps[gpsLatitude]; ok {
+				fields.set("gps", "")
+			}
+		}
+	}
+
+	return nil
+}
+
+func readIfd(reader *io.SectionReader, order binary.ByteOrder, offset int64) (ifd, error) {
+	countBytes := make([]byte, 2)
+	if _, err := reader.ReadAt(countBytes, offset); err != nil {
+		return nil, err
+	}
+
+	count := int64(order.Uint16(countBytes))
+	data := make([]byte, count*12)
+	if _, err := reader.ReadAt(data, offset+2); err != nil {
+		return nil, err
+	}
+
+	entries := make(ifd, count)
+	for index := int64(0); index < count; index++ {
+		entry := data[index*12 : (index+1)*12]
+		entries[order.Uint16(entry)] = ifdEntry{order.Uint16(entry[2:]), order.Uint32(entry[4:]), entry[8:]}
+	}
+
+	return entries, nil
+}
+
+// The value of an ASCII entry.
+func (entries ifd) text(reader *io.SectionReader, order binary.ByteOrder, tag uint16) string {
+	entry, ok := entries[tag]
+	if !ok || entry.kind != 2 || entry.count > 1<<16 {
+		return ""
+	}
+
+	data := entry.value
+	if entry.count > 4 {
+		data = make([]byte, entry.count)
+		if _, err := reader.ReadAt(data, int64(order.Uint32(entry.value))); err != nil {
+			return ""
+		}
+	}
+	if int(entry.count) < len(data) {
+		data = data[:entry.count]
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
+
+// The value of a LONG (or IFD pointer) entry.
+func (entries ifd) long(order binary.ByteOrder, tag uint16) (uint32, bool) {
+	entry, ok := entries[tag]
+	if !ok || (entry.kind != 4 && entry.kind != 13) {
+		return 0, false
+	}
+
+	return order.Uint32(entry.value), true
+}
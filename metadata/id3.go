@@ -0,0 +1,296 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// unexported
+
+// The genres that ID3 tags may refer to by number.
+var id3Genres = []string{"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno",
+	"Industrial", "Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical", "Instrumental", "Acid", "House",
+	"Game", "Sound Clip", "Gospel", "Noise", "AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave", "Techno-Industrial",
+	"Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40",
+	"Christian Rap", "Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave", "Psychadelic", "Rave",
+	"Showtunes", "Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical",
+	"Rock & Roll", "Hard Rock"}
+
+// The ID3v2 text frames of interest, by the field they map to, in both the
+// four character identifiers of ID3v2.3 and later and the three character
+// identifiers of ID3v2.2.
+var id3Frames = map[string]string{
+	"TPE1": "artist", "TP1": "artist",
+	"TALB": "album", "TAL": "album",
+	"TIT2": "title", "TT2": "title",
+	"TCON": "genre", "TCO": "genre",
+	"TRCK": "track", "TRK": "track",
+	"TDRC": "year", "TYER": "year", "TYE": "year",
+}
+
+const maximumId3Size = 64 << 20
+
+// Reads the ID3v2 tag at the start of the file, returning the offset of the
+// end of the tag.
+func readId3v2(reader io.ReaderAt, fields Fields) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+
+	major := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+
+	end := int64(10 + size)
+	if major >= 4 && flags&0x10 != 0 {
+		end += 10 // footer
+	}
+	if major < 2 || major > 4 || size > maximumId3Size {
+		return end, nil
+	}
+
+	data := make([]byte, size)
+	if _, err := reader.ReadAt(data, 10); err != nil {
+		return end, err
+	}
+
+	if major < 4 && flags&0x80 != 0 {
+		data = unsynchronise(data)
+	}
+
+	if flags&0x40 != 0 && len(data) >= 4 {
+		// skip extended header
+		if major == 3 {
+			data = data[min(4+int(binary.BigEndian.Uint32(data)), len(data)):]
+		} else {
+			data = data[min(int(syncsafe(data)), len(data)):]
+		}
+	}
+
+	idLength, headerLength := 4, 10
+	if major == 2 {
+		idLength, headerLength = 3, 6
+	}
+
+	for len(data) >= headerLength && data[0] != 0 {
+		id := string(data[:idLength])
+
+		var frameSize int
+		var frameFlags byte
+		switch major {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(data[4:]))
+			frameFlags = data[9]
+		default:
+			frameSize = int(syncsafe(data[4:]))
+			frameFlags = data[9]
+		}
+
+		if frameSize > len(data)-headerLength {
+			break
+		}
+		frame := data[headerLength : headerLength+frameSize]
+		data = data[headerLength+frameSize:]
+
+		name, ok := id3Frames[id]
+		if !ok {
+			continue
+		}
+
+		if major == 3 && frameFlags&0xC0 != 0 || major == 4 && frameFlags&0x0C != 0 {
+			// compressed or encrypted
+			continue
+		}
+		if major == 4 && frameFlags&0x01 != 0 && len(frame) >= 4 {
+			frame = frame[4:] // data length indicator
+		}
+		if major == 4 && frameFlags&0x02 != 0 {
+			frame = unsynchronise(frame)
+		}
+
+		setId3Field(fields, name, decodeId3Text(frame))
+	}
+
+	return end, nil
+}
+
+// Reads the ID3v1 tag at the end of the file.
+func readId3v1(reader io.ReaderAt, size int64, fields Fields) error {
+	if size < 128 {
+		return nil
+	}
+
+	tag := make([]byte, 128)
+	if _, err := reader.ReadAt(tag, size-128); err != nil {
+		return err
+	}
+	if string(tag[:3]) != "TAG" {
+		return nil
+	}
+
+	fields.set("title", latin1(trimNulls(tag[3:33])))
+	fields.set("artist", latin1(trimNulls(tag[33:63])))
+	fields.set("album", latin1(trimNulls(tag[63:93])))
+	fields.setDate(latin1(trimNulls(tag[93:97])))
+	if tag[125] == 0 && tag[126] != 0 {
+		fields.set("track", strconv.Itoa(int(tag[126])))
+	}
+	if int(tag[127]) < len(id3Genres) {
+		fields.set("genre", id3Genres[tag[127]])
+	}
+
+	return nil
+}
+
+func setId3Field(fields Fields, name, value string) {
+	switch name {
+	case "year":
+		fields.setDate(value)
+	case "track":
+		fields.set(name, strings.SplitN(value, "/", 2)[0])
+	case "genre":
+		fields.set(name, id3Genre(value))
+	default:
+		fields.set(name, value)
+	}
+}
+
+// Resolves genres given as '(17)', '17' or '(17)Rock' to the genre name.
+func id3Genre(value string) string {
+	reference := ""
+	for strings.HasPrefix(value, "(") && !strings.HasPrefix(value, "((") {
+		end := strings.IndexByte(value, ')')
+		if end == -1 {
+			break
+		}
+		if reference == "" {
+			reference = value[1:end]
+		}
+		value = value[end+1:]
+	}
+	if value == "" {
+		value = reference
+	}
+
+	if number, err := strconv.Atoi(value); err == nil {
+		if number >= 0 && number < len(id3Genres) {
+			return id3Genres[number]
+		}
+		return ""
+	}
+
+	switch value {
+	case "RX":
+		return "Remix"
+	case "CR":
+		return "Cover"
+	}
+
+	return strings.TrimPrefix(value, "(")
+}
+
+// Decodes the value of a text frame, which starts with the text encoding.
+func decodeId3Text(frame []byte) string {
+	if len(frame) == 0 {
+		return ""
+	}
+
+	encoding, text := frame[0], frame[1:]
+
+	switch encoding {
+	case 1, 2:
+		return firstValue(decodeUtf16(text, encoding == 2))
+	case 3:
+		return firstValue(string(text))
+	default:
+		return firstValue(latin1(text))
+	}
+}
+
+// The first of a list of null separated values.
+func firstValue(text string) string {
+	return strings.SplitN(strings.TrimLeft(text, "\x00"), "\x00", 2)[0]
+}
+
+// Decodes UTF-16, using the byte order mark if there is one.
+func decodeUtf16(data []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+
+	if len(data) >= 2 {
+		switch {
+		case data[0] == 0xFE && data[1] == 0xFF:
+			order, data = binary.BigEndian, data[2:]
+		case data[0] == 0xFF && data[1] == 0xFE:
+			order, data = binary.LittleEndian, data[2:]
+		}
+	}
+
+	units := make([]uint16, len(data)/2)
+	for index := range units {
+		units[index] = order.Uint16(data[index*2:])
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for index, char := range data {
+		runes[index] = rune(char)
+	}
+
+	return string(runes)
+}
+
+func trimNulls(data []byte) []byte {
+	if end := bytes.IndexByte(data, 0); end != -1 {
+		return data[:end]
+	}
+
+	return data
+}
+
+// Reverses the unsynchronisation scheme, which inserts a zero byte after each 0xFF.
+func unsynchronise(data []byte) []byte {
+	return bytes.Replace(data, []byte{0xFF, 0x00}, []byte{0xFF}, -1)
+}
+
+func syncsafe(data []byte) uint32 {
+	return uint32(data[0]&0x7F)<<21 | uint32(data[1]&0x7F)<<14 | uint32(data[2]&0x7F)<<7 | uint32(data[3]&0x7F)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,184 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The metadata fields that can be read from files.
+var FieldNames = []string{"album", "artist", "author", "camera", "creator", "date", "genre", "gps", "keywords", "producer", "subject", "title", "track", "year"}
+
+// Fields that merely indicate the presence of a piece of metadata and so have
+// no value.
+var FlagNames = []string{"gps"}
+
+// The metadata read from a file, by field name.
+type Fields map[string]string
+
+// The names of the fields, in order.
+func (fields Fields) Names() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Determines whether the specified name is that of a supported field.
+func IsField(name string) bool {
+	for _, fieldName := range FieldNames {
+		if fieldName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determines whether the specified field is a flag field.
+func IsFlag(name string) bool {
+	for _, flagName := range FlagNames {
+		if flagName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads the embedded metadata of the file at the specified path: EXIF for
+// JPEG and TIFF images, ID3 tags for MP3, Vorbis comments for FLAC and Ogg
+// and the document information dictionary for PDF. Files of other types have
+// no fields.
+func Read(path string) (Fields, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return Fields{}, nil
+	}
+
+	return ReadFrom(file, stat.Size())
+}
+
+// Reads the embedded metadata from the specified reader.
+func ReadFrom(reader io.ReaderAt, size int64) (Fields, error) {
+	fields := Fields{}
+
+	header := make([]byte, 16)
+	count, err := reader.ReadAt(header, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	header = header[:count]
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8}):
+		err = readJpeg(reader, size, fields)
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		err = readTiff(io.NewSectionReader(reader, 0, size), fields)
+	case bytes.HasPrefix(header, []byte("ID3")):
+		var end int64
+		end, err = readId3v2(reader, fields)
+		if err == nil && len(fields) == 0 {
+			err = readFlac(io.NewSectionReader(reader, end, size-end), fields)
+		}
+		if err == nil && len(fields) == 0 {
+			err = readId3v1(reader, size, fields)
+		}
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		err = readFlac(io.NewSectionReader(reader, 0, size), fields)
+	case bytes.HasPrefix(header, []byte("OggS")):
+		err = readOgg(io.NewSectionReader(reader, 0, size), fields)
+	case bytes.HasPrefix(header, []byte("%PDF")):
+		err = readPdf(reader, size, fields)
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		// MPEG audio without an ID3v2 tag
+		err = readId3v1(reader, size, fields)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// unexported
+
+// Sets a field, tidying the value. Empty values are ignored except for flags.
+func (fields Fields) set(name, value string) {
+	value = strings.Map(func(char rune) rune {
+		if unicode.IsSpace(char) || unicode.IsControl(char) {
+			return ' '
+		}
+		return char
+	}, value)
+	value = strings.Join(strings.Fields(value), " ")
+
+	if value == "" && !IsFlag(name) {
+		return
+	}
+	if _, exists := fields[name]; exists {
+		return
+	}
+
+	fields[name] = value
+}
+
+// Sets the date and year fields from a date of the form YYYY-MM-DD, YYYY:MM:DD
+// or YYYYMMDD, or just the year if that is all there is.
+func (fields Fields) setDate(text string) {
+	digits := make([]byte, 0, 8)
+
+scan:
+	for index := 0; index < len(text) && len(digits) < 8; index++ {
+		switch char := text[index]; {
+		case char >= '0' && char <= '9':
+			digits = append(digits, char)
+		case char == '-', char == ':', char == '/', char == '.':
+		default:
+			break scan
+		}
+	}
+
+	if len(digits) < 4 || string(digits[:4]) == "0000" {
+		return
+	}
+
+	fields.set("year", string(digits[:4]))
+	if len(digits) == 8 {
+		fields.set("date", string(digits[:4])+"-"+string(digits[4:6])+"-"+string(digits[6:8]))
+	}
+}
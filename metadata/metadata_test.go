@@ -0,0 +1,221 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestJpegExif(test *testing.T) {
+	tiff := buildTiff(binary.LittleEndian)
+
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00, 0xFF, 0xE1}
+	jpeg = append(jpeg, byte((len(tiff)+8)>>8), byte(len(tiff)+8))
+	jpeg = append(jpeg, []byte("Exif\x00\x00")...)
+	jpeg = append(jpeg, tiff...)
+	jpeg = append(jpeg, 0xFF, 0xDA)
+
+	validateFields(jpeg, Fields{"camera": "Canon EOS 5D", "date": "2017-06-01", "year": "2017", "gps": ""}, test)
+}
+
+func TestTiffExif(test *testing.T) {
+	validateFields(buildTiff(binary.BigEndian), Fields{"camera": "Canon EOS 5D", "date": "2017-06-01", "year": "2017", "gps": ""}, test)
+}
+
+func TestId3v23(test *testing.T) {
+	frames := id3Frame("TPE1", "\x00Ella Fitzgerald\x00")
+	frames = append(frames, id3Frame("TALB", "\x03Ella & Louis")...)
+	frames = append(frames, id3Frame("TYER", "\x001956")...)
+	frames = append(frames, id3Frame("TCON", "\x00(8)")...)
+	frames = append(frames, id3Frame("TRCK", "\x003/11")...)
+	frames = append(frames, id3Frame("TIT2", "\x01\xFF\xFEC\x00a\x00n\x00")...)
+	frames = append(frames, make([]byte, 20)...) // padding
+
+	size := len(frames)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, byte(size >> 7), byte(size & 0x7F)}, frames...)
+	tag = append(tag, 0xFF, 0xFB, 0x90, 0x00)
+
+	validateFields(tag, Fields{"artist": "Ella Fitzgerald", "album": "Ella & Louis", "year": "1956",
+		"genre": "Jazz", "track": "3", "title": "Can"}, test)
+}
+
+func TestId3v1(test *testing.T) {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], "Song")
+	copy(tag[33:], "Artist")
+	copy(tag[63:], "Album")
+	copy(tag[93:], "1999")
+	tag[126] = 7
+	tag[127] = 17
+
+	mp3 := append([]byte{0xFF, 0xFB, 0x90, 0x00, 0, 0, 0, 0}, tag...)
+
+	validateFields(mp3, Fields{"title": "Song", "artist": "Artist", "album": "Album", "year": "1999",
+		"track": "7", "genre": "Rock"}, test)
+}
+
+func TestFlac(test *testing.T) {
+	comment := vorbisComment("ARTIST=Miles Davis", "album=Kind of Blue", "DATE=1959-08-17", "GENRE=Jazz")
+
+	flac := []byte("fLaC")
+	flac = append(flac, 0x00, 0x00, 0x00, 0x02, 0xAA, 0xBB) // STREAMINFO (truncated)
+	flac = append(flac, 0x84, byte(len(comment)>>16), byte(len(comment)>>8), byte(len(comment)))
+	flac = append(flac, comment...)
+
+	validateFields(flac, Fields{"artist": "Miles Davis", "album": "Kind of Blue", "date": "1959-08-17",
+		"year": "1959", "genre": "Jazz"}, test)
+}
+
+func TestOgg(test *testing.T) {
+	identification := append([]byte("\x01vorbis"), make([]byte, 23)...)
+	comment := append([]byte("\x03vorbis"), vorbisComment("TITLE=So What", "TRACKNUMBER=1")...)
+
+	ogg := oggPage(identification)
+	ogg = append(ogg, oggPage(comment)...)
+
+	validateFields(ogg, Fields{"title": "So What", "track": "1"}, test)
+}
+
+func TestPdf(test *testing.T) {
+	pdf := []byte(`%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+4 0 obj
+<< /Title (An \(Old\) Report)
+   /Author <FEFF004A006F00EB>
+   /Keywords [/Ignored] /Subject (Line \
+continued\041)
+   /CreationDate (D:20170601120000Z)
+   /Producer 5 0 R
+>>
+endobj
+trailer
+<< /Size 5 /Root 1 0 R /Info 4 0 R >>
+%%EOF
+`)
+
+	validateFields(pdf, Fields{"title": "An (Old) Report", "author": "Joë", "subject": "Line continued!",
+		"date": "2017-06-01", "year": "2017"}, test)
+}
+
+func TestUnrecognised(test *testing.T) {
+	validateFields([]byte("plain text"), Fields{}, test)
+}
+
+// unexported
+
+func validateFields(data []byte, expected Fields, test *testing.T) {
+	fields, err := ReadFrom(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fields, expected) {
+		test.Fatalf("expected fields %v but were %v", expected, fields)
+	}
+}
+
+func buildTiff(order binary.ByteOrder) []byte {
+	var buffer bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, value := range values {
+			binary.Write(&buffer, order, value)
+		}
+	}
+
+	if order == binary.LittleEndian {
+		buffer.WriteString("II")
+	} else {
+		buffer.WriteString("MM")
+	}
+	write(uint16(42))
+	write(uint32(8))
+
+	// IFD0 at 8: make, model, exif pointer, GPS pointer
+	const ifd0Size = 2 + 4*12 + 4
+	makeOffset := uint32(8 + ifd0Size)
+	modelOffset := makeOffset + 6
+	exifOffset := modelOffset + 12
+	const exifSize = 2 + 12 + 4
+	dateOffset := exifOffset + exifSize
+	gpsOffset := dateOffset + 20
+
+	write(uint16(4))
+	write(uint16(0x010F), uint16(2), uint32(6), makeOffset)
+	write(uint16(0x0110), uint16(2), uint32(12), modelOffset)
+	write(uint16(0x8769), uint16(4), uint32(1), exifOffset)
+	write(uint16(0x8825), uint16(4), uint32(1), gpsOffset)
+	write(uint32(0))
+
+	buffer.WriteString("Canon\x00")
+	buffer.WriteString("Canon EOS 5D")
+
+	write(uint16(1))
+	write(uint16(0x9003), uint16(2), uint32(20), dateOffset)
+	write(uint32(0))
+
+	buffer.WriteString("2017:06:01 12:00:00\x00")
+
+	write(uint16(1))
+	write(uint16(0x0002), uint16(5), uint32(3), uint32(0))
+	write(uint32(0))
+
+	return buffer.Bytes()
+}
+
+func id3Frame(id, text string) []byte {
+	frame := []byte(id)
+	frame = append(frame, 0, 0, 0, byte(len(text)), 0, 0)
+
+	return append(frame, text...)
+}
+
+func vorbisComment(comments ...string) []byte {
+	var buffer bytes.Buffer
+	write := func(value interface{}) { binary.Write(&buffer, binary.LittleEndian, value) }
+
+	write(uint32(6))
+	buffer.WriteString("vendor")
+	write(uint32(len(comments)))
+	for _, comment := range comments {
+		write(uint32(len(comment)))
+		buffer.WriteString(comment)
+	}
+
+	return buffer.Bytes()
+}
+
+func oggPage(packet []byte) []byte {
+	page := []byte("OggS")
+	page = append(page, make([]byte, 22)...)
+
+	segments := make([]byte, 0, 4)
+	for remaining := len(packet); ; remaining -= 255 {
+		if remaining < 255 {
+			segments = append(segments, byte(remaining))
+			break
+		}
+		segments = append(segments, 255)
+	}
+
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+
+	return append(page, packet...)
+}
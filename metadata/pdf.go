@@ -0,0 +1,311 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// unexported
+
+const (
+	maximumPdfSize = 64 << 20
+	pdfTailSize    = 1 << 20
+)
+
+var pdfInfoPattern = regexp.MustCompile(`/Info\s*(\d+)\s+(\d+)\s+R`)
+
+// Reads the document information dictionary of a PDF file. The dictionary
+// must be a plain object: one held within a compressed object stream is not
+// found.
+func readPdf(reader io.ReaderAt, size int64, fields Fields) error {
+	offset := int64(0)
+	if size > maximumPdfSize {
+		offset = size - pdfTailSize
+	}
+
+	data := make([]byte, size-offset)
+	if _, err := reader.ReadAt(data, offset); err != nil && err != io.EOF {
+		return err
+	}
+
+	// the last reference wins as later revisions are appended to the file
+	references := pdfInfoPattern.FindAllSubmatch(data, -1)
+	if references == nil {
+		return nil
+	}
+	reference := references[len(references)-1]
+
+	objectPattern, err := regexp.Compile(`(?:^|[^\d])` + string(reference[1]) + `\s+` + string(reference[2]) + `\s+obj\s*<<`)
+	if err != nil {
+		return err
+	}
+	objects := objectPattern.FindAllIndex(data, -1)
+	if objects == nil {
+		return nil
+	}
+
+	object := objects[len(objects)-1]
+	parser := pdfParser{data, object[1] - 2}
+	dictionary := parser.dictionary()
+
+	for key, name := range map[string]string{"Title": "title", "Author": "author", "Subject": "subject",
+		"Keywords": "keywords", "Creator": "creator", "Producer": "producer"} {
+		fields.set(name, dictionary[key])
+	}
+	fields.setDate(strings.TrimPrefix(dictionary["CreationDate"], "D:"))
+
+	return nil
+}
+
+type pdfParser struct {
+	data     []byte
+	position int
+}
+
+// Parses a dictionary, returning its string values.
+func (parser *pdfParser) dictionary() map[string]string {
+	values := make(map[string]string)
+
+	if !parser.consume("<<") {
+		return values
+	}
+
+	for {
+		parser.skipSpace()
+
+		if parser.position >= len(parser.data) || parser.consume(">>") {
+			return values
+		}
+		if parser.data[parser.position] != '/' {
+			// the remainder of an indirect reference
+			parser.value()
+			continue
+		}
+
+		key := parser.name()
+		parser.skipSpace()
+
+		if value, isString := parser.value(); isString {
+			values[key] = value
+		}
+	}
+}
+
+// Parses an object, returning its text if it is a string.
+func (parser *pdfParser) value() (string, bool) {
+	if parser.position >= len(parser.data) {
+		return "", false
+	}
+
+	switch parser.data[parser.position] {
+	case '(':
+		return decodePdfText(parser.literalString()), true
+	case '<':
+		if parser.consume("<<") {
+			parser.position -= 2
+			parser.dictionary()
+			return "", false
+		}
+
+		return decodePdfText(parser.hexString()), true
+	case '[':
+		parser.position++
+		for {
+			parser.skipSpace()
+			if parser.position >= len(parser.data) || parser.consume("]") {
+				return "", false
+			}
+			parser.value()
+		}
+	case '/':
+		parser.name()
+		return "", false
+	default:
+		start := parser.position
+		parser.token()
+		if parser.position == start {
+			// unexpected delimiter
+			parser.position++
+		}
+
+		return "", false
+	}
+}
+
+func (parser *pdfParser) literalString() []byte {
+	parser.position++ // (
+
+	text := make([]byte, 0, 64)
+	depth := 0
+
+	for parser.position < len(parser.data) {
+		char := parser.data[parser.position]
+		parser.position++
+
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return text
+			}
+			depth--
+		case '\\':
+			if parser.position >= len(parser.data) {
+				return text
+			}
+
+			escaped := parser.data[parser.position]
+			parser.position++
+
+			switch escaped {
+			case 'n':
+				char = '\n'
+			case 'r':
+				char = '\r'
+			case 't':
+				char = '\t'
+			case 'b':
+				char = '\b'
+			case 'f':
+				char = '\f'
+			case '\r', '\n':
+				// line continuation
+				if escaped == '\r' && parser.position < len(parser.data) && parser.data[parser.position] == '\n' {
+					parser.position++
+				}
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					char = escaped - '0'
+					for digits := 1; digits < 3 && parser.position < len(parser.data); digits++ {
+						next := parser.data[parser.position]
+						if next < '0' || next > '7' {
+							break
+						}
+						char = char*8 + next - '0'
+						parser.position++
+					}
+				} else {
+					char = escaped
+				}
+			}
+		}
+
+		text = append(text, char)
+	}
+
+	return text
+}
+
+func (parser *pdfParser) hexString() []byte {
+	parser.position++ // <
+
+	end := bytes.IndexByte(parser.data[parser.position:], '>')
+	if end == -1 {
+		parser.position = len(parser.data)
+		return nil
+	}
+
+	digits := make([]byte, 0, end)
+	for _, char := range parser.data[parser.position : parser.position+end] {
+		if !isPdfSpace(char) {
+			digits = append(digits, char)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	parser.position += end + 1
+
+	text, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return nil
+	}
+
+	return text
+}
+
+func (parser *pdfParser) name() string {
+	parser.position++ // /
+
+	return parser.token()
+}
+
+func (parser *pdfParser) token() string {
+	start := parser.position
+	for parser.position < len(parser.data) && !isPdfSpace(parser.data[parser.position]) && !isPdfDelimiter(parser.data[parser.position]) {
+		parser.position++
+	}
+
+	return string(parser.data[start:parser.position])
+}
+
+func (parser *pdfParser) consume(text string) bool {
+	if bytes.HasPrefix(parser.data[parser.position:], []byte(text)) {
+		parser.position += len(text)
+		return true
+	}
+
+	return false
+}
+
+func (parser *pdfParser) skipSpace() {
+	for parser.position < len(parser.data) {
+		switch char := parser.data[parser.position]; {
+		case isPdfSpace(char):
+			parser.position++
+		case char == '%':
+			// comment
+			for parser.position < len(parser.data) && parser.data[parser.position] != '\n' && parser.data[parser.position] != '\r' {
+				parser.position++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Decodes PDF text strings, which are either UTF-16 with a byte order mark,
+// UTF-8 with a byte order mark or otherwise, approximately, Latin-1.
+func decodePdfText(text []byte) string {
+	switch {
+	case bytes.HasPrefix(text, []byte{0xFE, 0xFF}):
+		return decodeUtf16(text, true)
+	case bytes.HasPrefix(text, []byte{0xEF, 0xBB, 0xBF}):
+		return string(text[3:])
+	default:
+		return latin1(text)
+	}
+}
+
+func isPdfSpace(char byte) bool {
+	switch char {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+
+	return false
+}
+
+func isPdfDelimiter(char byte) bool {
+	return strings.IndexByte("()<>[]{}/%", char) != -1
+}
@@ -0,0 +1,189 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// unexported
+
+const maximumCommentSize = 16 << 20
+
+// Reads the Vorbis comment metadata block of a FLAC file.
+func readFlac(reader *io.SectionReader, fields Fields) error {
+	signature := make([]byte, 4)
+	if _, err := reader.ReadAt(signature, 0); err != nil || string(signature) != "fLaC" {
+		return nil
+	}
+
+	offset := int64(4)
+	header := make([]byte, 4)
+
+	for {
+		if _, err := reader.ReadAt(header, offset); err != nil {
+			return err
+		}
+
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		if blockType == 4 && length <= maximumCommentSize {
+			data := make([]byte, length)
+			if _, err := reader.ReadAt(data, offset+4); err != nil {
+				return err
+			}
+
+			readVorbisComment(data, fields)
+			return nil
+		}
+		if last {
+			return nil
+		}
+
+		offset += 4 + length
+	}
+}
+
+// Reads the comment header packet of the first logical stream of an Ogg
+// Vorbis or Opus file.
+func readOgg(reader *io.SectionReader, fields Fields) error {
+	var serial []byte
+	packets := 0
+	packet := make([]byte, 0, 4096)
+	offset := int64(0)
+	header := make([]byte, 27)
+
+	for packets < 2 {
+		if _, err := reader.ReadAt(header, offset); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if string(header[:4]) != "OggS" {
+			return nil
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := reader.ReadAt(segments, offset+27); err != nil {
+			return err
+		}
+
+		dataSize := 0
+		for _, lacing := range segments {
+			dataSize += int(lacing)
+		}
+		data := make([]byte, dataSize)
+		if _, err := reader.ReadAt(data, offset+27+int64(len(segments))); err != nil {
+			return err
+		}
+		offset += 27 + int64(len(segments)) + int64(dataSize)
+
+		if serial == nil {
+			serial = append(serial, header[14:18]...)
+		} else if !bytes.Equal(serial, header[14:18]) {
+			continue
+		}
+
+		for _, lacing := range segments {
+			if packets == 1 {
+				packet = append(packet, data[:lacing]...)
+				if len(packet) > maximumCommentSize {
+					return nil
+				}
+			}
+			data = data[lacing:]
+
+			if lacing < 255 {
+				packets++
+				if packets == 2 {
+					break
+				}
+			}
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		readVorbisComment(packet[7:], fields)
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		readVorbisComment(packet[8:], fields)
+	}
+
+	return nil
+}
+
+// Reads the fields of interest from a Vorbis comment.
+func readVorbisComment(data []byte, fields Fields) {
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+
+		length := binary.LittleEndian.Uint32(data)
+		if uint64(length) > uint64(len(data)-4) {
+			return nil, false
+		}
+
+		value := data[4 : 4+length]
+		data = data[4+length:]
+
+		return value, true
+	}
+
+	if _, ok := next(); !ok {
+		// vendor
+		return
+	}
+
+	if len(data) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	for index := uint32(0); index < count; index++ {
+		comment, ok := next()
+		if !ok {
+			return
+		}
+
+		parts := strings.SplitN(string(comment), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch value := parts[1]; strings.ToUpper(parts[0]) {
+		case "ARTIST":
+			fields.set("artist", value)
+		case "ALBUM":
+			fields.set("album", value)
+		case "TITLE":
+			fields.set("title", value)
+		case "GENRE":
+			fields.set("genre", value)
+		case "TRACKNUMBER":
+			fields.set("track", strings.SplitN(value, "/", 2)[0])
+		case "DATE", "YEAR":
+			fields.setDate(value)
+		}
+	}
+}
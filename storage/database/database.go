@@ -18,6 +18,7 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3" // initialised Sqlite3
 	"github.com/oniony/TMSU/common/log"
 	"os"
@@ -96,11 +97,27 @@ func (database *Database) Begin() (*Tx, error) {
 		return nil, err
 	}
 
-	return &Tx{tx}, nil
+	return &Tx{tx, "", false}, nil
 }
 
 type Tx struct {
-	tx *sql.Tx
+	tx        *sql.Tx
+	savepoint string
+	done      bool
+}
+
+// Begins a transaction nested within this one, as a savepoint, which may be
+// rolled back without affecting the enclosing transaction. Changes committed
+// by the nested transaction are only stored when the enclosing one commits.
+func (tx *Tx) Nest() (*Tx, error) {
+	savepointCount++
+	savepoint := fmt.Sprintf("nested_%v", savepointCount)
+
+	if _, err := tx.Exec("SAVEPOINT " + savepoint); err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx.tx, savepoint, false}, nil
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
@@ -118,19 +135,49 @@ func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
 }
 
 func (tx *Tx) Commit() error {
-	log.Info(2, "committing transaction")
+	if tx.savepoint == "" {
+		log.Info(2, "committing transaction")
+
+		return tx.tx.Commit()
+	}
+
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
 
-	return tx.tx.Commit()
+	log.Infof(2, "releasing savepoint %v", tx.savepoint)
+
+	_, err := tx.Exec("RELEASE " + tx.savepoint)
+	return err
 }
 
 func (tx *Tx) Rollback() error {
-	log.Info(2, "rolling back transaction")
+	if tx.savepoint == "" {
+		log.Info(2, "rolling back transaction")
+
+		return tx.tx.Rollback()
+	}
+
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
 
-	return tx.tx.Rollback()
+	log.Infof(2, "rolling back to savepoint %v", tx.savepoint)
+
+	if _, err := tx.Exec("ROLLBACK TO " + tx.savepoint); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("RELEASE " + tx.savepoint)
+	return err
 }
 
 // unexported
 
+var savepointCount uint
+
 func readCount(rows *sql.Rows) (uint, error) {
 	if !rows.Next() {
 		return 0, errors.New("could not get count")
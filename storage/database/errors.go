@@ -99,6 +99,14 @@ func (err NoSuchImplicationError) Error() string {
 	return fmt.Sprintf("no such implication where #%v implies #%v", err.TagValuePair, err.ImpliedTagValuePair)
 }
 
+type NoSuchRuleError struct {
+	RuleId entities.RuleId
+}
+
+func (err NoSuchRuleError) Error() string {
+	return fmt.Sprintf("no such rule #%v", err.RuleId)
+}
+
 type NoSuchSettingError struct {
 	Name string
 }
@@ -43,7 +43,7 @@ func FileCount(tx *Tx) (uint, error) {
 func Files(tx *Tx, sort string) (entities.Files, error) {
 	builder := NewBuilder()
 	builder.AppendSql(`
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file `)
 
 	buildSort(sort, builder)
@@ -60,7 +60,7 @@ FROM file `)
 // Retrieves a specific file.
 func File(tx *Tx, id entities.FileId) (*entities.File, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE id = ?`
 
@@ -79,7 +79,7 @@ func FileByPath(tx *Tx, path string) (*entities.File, error) {
 	name := filepath.Base(path)
 
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE directory = ? AND name = ?`
 
@@ -95,7 +95,7 @@ WHERE directory = ? AND name = ?`
 // Retrieves all files that are under the specified directory.
 func FilesByDirectory(tx *Tx, path string, pathContainsRoot bool) (entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE directory = ? OR directory LIKE ?`
 
@@ -136,7 +136,7 @@ WHERE fingerprint = ?`
 // Retrieves the set of files with the specified fingerprint.
 func FilesByFingerprint(tx *Tx, fingerprint fingerprint.Fingerprint) (entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE fingerprint = ?
 ORDER BY directory || '/' || name`
@@ -153,7 +153,7 @@ ORDER BY directory || '/' || name`
 // Retrieves the set of untagged files.
 func UntaggedFiles(tx *Tx) (entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE id NOT IN (SELECT distinct(file_id)
                  FROM file_tag)`
@@ -193,10 +193,37 @@ func FilesForQuery(tx *Tx, expression query.Expression, path string, pathContain
 	return readFiles(rows, make(entities.Files, 0, 10))
 }
 
+// Determines whether the file with the specified ID matches the specified query.
+func FileMatchesQuery(tx *Tx, fileId entities.FileId, expression query.Expression, explicitOnly, ignoreCase bool) (bool, error) {
+	builder := NewBuilder()
+
+	builder.AppendSql(`
+SELECT count(id)
+FROM file
+WHERE id = `)
+	builder.AppendParam(fileId)
+	builder.AppendSql(" AND (")
+	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
+	builder.AppendSql(")")
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	count, err := readCount(rows)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 // Retrieves the sets of duplicate files within the database.
 func DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE fingerprint IN (SELECT fingerprint
                       FROM file
@@ -222,11 +249,11 @@ ORDER BY fingerprint, directory || '/' || name`
 		}
 
 		var fileId entities.FileId
-		var directory, name, fp string
+		var directory, name, fp, fpAlgorithm string
 		var modTime time.Time
 		var size int64
 		var isDir bool
-		err = rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir)
+		err = rows.Scan(&fileId, &directory, &name, &fp, &fpAlgorithm, &modTime, &size, &isDir)
 		if err != nil {
 			return nil, err
 		}
@@ -241,7 +268,7 @@ ORDER BY fingerprint, directory || '/' || name`
 			previousFingerprint = fingerprint
 		}
 
-		fileSet = append(fileSet, &entities.File{fileId, directory, name, fingerprint, modTime, size, isDir})
+		fileSet = append(fileSet, &entities.File{fileId, directory, name, fingerprint, fpAlgorithm, modTime, size, isDir})
 	}
 
 	// ensure last file set is added
@@ -253,15 +280,15 @@ ORDER BY fingerprint, directory || '/' || name`
 }
 
 // Adds a file to the database.
-func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, fingerprintAlgorithm string, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
 	sql := `
-INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir)
-VALUES (?, ?, ?, ?, ?, ?)`
+INSERT INTO file (directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir)
+	result, err := tx.Exec(sql, directory, name, string(fingerprint), fingerprintAlgorithm, modTime, size, isDir)
 	if err != nil {
 		return nil, err
 	}
@@ -279,20 +306,20 @@ VALUES (?, ?, ?, ?, ?, ?)`
 		panic("expected exactly one row to be affected.")
 	}
 
-	return &entities.File{entities.FileId(id), directory, name, fingerprint, modTime, size, isDir}, nil
+	return &entities.File{entities.FileId(id), directory, name, fingerprint, fingerprintAlgorithm, modTime, size, isDir}, nil
 }
 
 // Updates a file in the database.
-func UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+func UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, fingerprintAlgorithm string, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
 	sql := `
 UPDATE file
-SET directory = ?, name = ?, fingerprint = ?, mod_time = ?, size = ?, is_dir = ?
+SET directory = ?, name = ?, fingerprint = ?, fingerprint_algorithm = ?, mod_time = ?, size = ?, is_dir = ?
 WHERE id = ?`
 
-	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, int(fileId))
+	result, err := tx.Exec(sql, directory, name, string(fingerprint), fingerprintAlgorithm, modTime, size, isDir, int(fileId))
 	if err != nil {
 		return nil, err
 	}
@@ -305,7 +332,7 @@ WHERE id = ?`
 		panic("expected exactly one row to be affected.")
 	}
 
-	return &entities.File{entities.FileId(fileId), directory, name, fingerprint, modTime, size, isDir}, nil
+	return &entities.File{entities.FileId(fileId), directory, name, fingerprint, fingerprintAlgorithm, modTime, size, isDir}, nil
 }
 
 // Removes a file from the database.
@@ -330,7 +357,7 @@ WHERE id = ?`
 		panic("expected only one row to be affected.")
 	}
 
-	return nil
+	return DeleteImageFingerprint(tx, fileId)
 }
 
 // Deletes the specified files if they are untagged
@@ -349,7 +376,7 @@ AND (SELECT count(1)
 		}
 	}
 
-	return nil
+	return deleteOrphanedImageFingerprints(tx)
 }
 
 // unexported
@@ -363,16 +390,16 @@ func readFile(rows *sql.Rows) (*entities.File, error) {
 	}
 
 	var fileId entities.FileId
-	var directory, name, fp string
+	var directory, name, fp, fpAlgorithm string
 	var modTime time.Time
 	var size int64
 	var isDir bool
-	err := rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir)
+	err := rows.Scan(&fileId, &directory, &name, &fp, &fpAlgorithm, &modTime, &size, &isDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return &entities.File{fileId, directory, name, fingerprint.Fingerprint(fp), modTime, size, isDir}, nil
+	return &entities.File{fileId, directory, name, fingerprint.Fingerprint(fp), fpAlgorithm, modTime, size, isDir}, nil
 }
 
 func readFiles(rows *sql.Rows, files entities.Files) (entities.Files, error) {
@@ -408,7 +435,7 @@ func buildQuery(expression query.Expression, path string, pathContainsRoot, expl
 	builder := NewBuilder()
 
 	builder.AppendSql(`
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, fingerprint_algorithm, mod_time, size, is_dir
 FROM file
 WHERE`)
 	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
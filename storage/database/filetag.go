@@ -18,6 +18,7 @@ package database
 import (
 	"database/sql"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 )
 
 // Determines whether the specified file has the specified tag applied.
@@ -171,6 +172,30 @@ WHERE file_id = ?1`
 	return readFileTags(rows, make(entities.FileTags, 0, 10))
 }
 
+// Retrieves the set of file tags for the files matching the specified query.
+func FileTagsForQuery(tx *Tx, expression query.Expression, explicitOnly, ignoreCase bool) (entities.FileTags, error) {
+	builder := NewBuilder()
+
+	builder.AppendSql(`
+SELECT file_id, tag_id, value_id
+FROM file_tag
+WHERE file_id IN (SELECT id
+                  FROM file
+                  WHERE`)
+	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
+	builder.AppendSql(`
+                 )
+ORDER BY file_id`)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTags(rows, make(entities.FileTags, 0, 10))
+}
+
 // Adds a file tag.
 func AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
 	sql := `
@@ -0,0 +1,80 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+)
+
+// Retrieves the cached fingerprint for the file with the specified identity,
+// size and modification time (in nanoseconds) that was created using the
+// specified algorithm, if there is one.
+func CachedFingerprint(tx *Tx, device, inode uint64, size, modTimeNs int64, algorithm string) (fingerprint.Fingerprint, bool, error) {
+	sql := `
+SELECT fingerprint
+FROM fingerprint_cache
+WHERE device = ? AND inode = ? AND size = ? AND mod_time_ns = ? AND algorithm = ?`
+
+	rows, err := tx.Query(sql, int64(device), int64(inode), size, modTimeNs, algorithm)
+	if err != nil {
+		return fingerprint.Empty, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fingerprint.Empty, false, rows.Err()
+	}
+
+	var fp string
+	if err := rows.Scan(&fp); err != nil {
+		return fingerprint.Empty, false, err
+	}
+
+	return fingerprint.Fingerprint(fp), true, nil
+}
+
+// Caches the fingerprint for the file with the specified identity, replacing
+// any previously cached for it.
+func UpdateCachedFingerprint(tx *Tx, device, inode uint64, size, modTimeNs int64, algorithm string, fp fingerprint.Fingerprint) error {
+	sql := `
+INSERT OR REPLACE INTO fingerprint_cache (device, inode, size, mod_time_ns, algorithm, fingerprint)
+VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := tx.Exec(sql, int64(device), int64(inode), size, modTimeNs, algorithm, string(fp))
+	return err
+}
+
+// Removes the cached fingerprint for the file with the specified identity.
+func DeleteCachedFingerprint(tx *Tx, device, inode uint64) error {
+	sql := `
+DELETE FROM fingerprint_cache
+WHERE device = ? AND inode = ?`
+
+	_, err := tx.Exec(sql, int64(device), int64(inode))
+	return err
+}
+
+// Removes the cached fingerprint for the file with the specified identity if it
+// no longer matches the file's size and modification time (in nanoseconds) or
+// was created using a different algorithm.
+func DeleteStaleCachedFingerprint(tx *Tx, device, inode uint64, size, modTimeNs int64, algorithm string) error {
+	sql := `
+DELETE FROM fingerprint_cache
+WHERE device = ? AND inode = ? AND (size != ? OR mod_time_ns != ? OR algorithm != ?)`
+
+	_, err := tx.Exec(sql, int64(device), int64(inode), size, modTimeNs, algorithm)
+	return err
+}
@@ -0,0 +1,120 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the image fingerprints calculated using the specified algorithm.
+func ImageFingerprints(tx *Tx, algorithm string) (entities.ImageFingerprints, error) {
+	sql := `
+SELECT file_id, algorithm, fingerprint
+FROM image_fingerprint
+WHERE algorithm = ?
+ORDER BY file_id`
+
+	rows, err := tx.Query(sql, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readImageFingerprints(rows, make(entities.ImageFingerprints, 0, 10))
+}
+
+// Retrieves the image fingerprint for the specified file.
+func ImageFingerprintByFileId(tx *Tx, fileId entities.FileId) (*entities.ImageFingerprint, error) {
+	sql := `
+SELECT file_id, algorithm, fingerprint
+FROM image_fingerprint
+WHERE file_id = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readImageFingerprint(rows)
+}
+
+// Sets the image fingerprint for the specified file.
+func UpdateImageFingerprint(tx *Tx, fileId entities.FileId, algorithm string, fingerprint fingerprint.Fingerprint) error {
+	sql := `
+INSERT OR REPLACE INTO image_fingerprint (file_id, algorithm, fingerprint)
+VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(sql, fileId, algorithm, string(fingerprint))
+	return err
+}
+
+// Removes the image fingerprint for the specified file.
+func DeleteImageFingerprint(tx *Tx, fileId entities.FileId) error {
+	sql := `
+DELETE FROM image_fingerprint
+WHERE file_id = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	return err
+}
+
+// unexported
+
+func deleteOrphanedImageFingerprints(tx *Tx) error {
+	sql := `
+DELETE FROM image_fingerprint
+WHERE file_id NOT IN (SELECT id FROM file)`
+
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func readImageFingerprint(rows *sql.Rows) (*entities.ImageFingerprint, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var fileId entities.FileId
+	var algorithm, fp string
+	err := rows.Scan(&fileId, &algorithm, &fp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.ImageFingerprint{fileId, algorithm, fingerprint.Fingerprint(fp)}, nil
+}
+
+func readImageFingerprints(rows *sql.Rows, imageFingerprints entities.ImageFingerprints) (entities.ImageFingerprints, error) {
+	for {
+		imageFingerprint, err := readImageFingerprint(rows)
+		if err != nil {
+			return nil, err
+		}
+		if imageFingerprint == nil {
+			break
+		}
+
+		imageFingerprints = append(imageFingerprints, imageFingerprint)
+	}
+
+	return imageFingerprints, nil
+}
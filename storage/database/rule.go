@@ -0,0 +1,124 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// The complete set of automatic tagging rules.
+func Rules(tx *Tx) (entities.Rules, error) {
+	sql := `
+SELECT id, condition, tags
+FROM autotag_rule
+ORDER BY id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readRules(rows, make(entities.Rules, 0, 10))
+}
+
+// Adds an automatic tagging rule to the database.
+func InsertRule(tx *Tx, condition, tags string) (*entities.Rule, error) {
+	sql := `
+INSERT INTO autotag_rule (condition, tags)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, condition, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return &entities.Rule{entities.RuleId(id), condition, tags}, nil
+}
+
+// Removes an automatic tagging rule from the database.
+func DeleteRule(tx *Tx, ruleId entities.RuleId) error {
+	sql := `
+DELETE FROM autotag_rule
+WHERE id = ?`
+
+	result, err := tx.Exec(sql, ruleId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchRuleError{ruleId}
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// unexported
+
+func readRule(rows *sql.Rows) (*entities.Rule, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var rule entities.Rule
+	err := rows.Scan(&rule.Id, &rule.Condition, &rule.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func readRules(rows *sql.Rows, rules entities.Rules) (entities.Rules, error) {
+	for {
+		rule, err := readRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			break
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
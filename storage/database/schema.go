@@ -23,7 +23,7 @@ import (
 
 // unexported
 
-var latestSchemaVersion = schemaVersion{common.Version{0, 7, 0}, 1}
+var latestSchemaVersion = schemaVersion{common.Version{0, 7, 0}, 5}
 
 func currentSchemaVersion(tx *sql.Tx) schemaVersion {
 	sql := `
@@ -117,6 +117,18 @@ func createSchema(tx *sql.Tx) error {
 		return err
 	}
 
+	if err := createImageFingerprintTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFingerprintCacheTable(tx); err != nil {
+		return err
+	}
+
+	if err := createRuleTable(tx); err != nil {
+		return err
+	}
+
 	if err := createVersionTable(tx); err != nil {
 		return err
 	}
@@ -280,6 +292,56 @@ CREATE TABLE IF NOT EXISTS setting (
 	return nil
 }
 
+func createImageFingerprintTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS image_fingerprint (
+    file_id INTEGER PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createFingerprintCacheTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS fingerprint_cache (
+    device INTEGER NOT NULL,
+    inode INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    mod_time_ns INTEGER NOT NULL,
+    algorithm TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    PRIMARY KEY (device, inode)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createRuleTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS autotag_rule (
+    id INTEGER PRIMARY KEY,
+    condition TEXT NOT NULL,
+    tags TEXT NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func createVersionTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS version (
@@ -74,6 +74,34 @@ func upgrade(tx *sql.Tx) error {
 			return err
 		}
 	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 2}) {
+		log.Infof(2, "creating image fingerprint table")
+
+		if err := createImageFingerprintTable(tx); err != nil {
+			return err
+		}
+	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 3}) {
+		log.Infof(2, "creating fingerprint cache table")
+
+		if err := createFingerprintCacheTable(tx); err != nil {
+			return err
+		}
+	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 4}) {
+		log.Infof(2, "creating autotag rule table")
+
+		if err := createRuleTable(tx); err != nil {
+			return err
+		}
+	}
+	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 5}) {
+		log.Infof(2, "adding file fingerprint algorithm column")
+
+		if err := addFileFingerprintAlgorithmColumn(tx); err != nil {
+			return err
+		}
+	}
 
 	log.Infof(2, "updating schema version")
 	if err := updateSchemaVersion(tx, latestSchemaVersion); err != nil {
@@ -176,3 +204,13 @@ func recreateVersionTable(tx *sql.Tx) error {
 
 	return nil
 }
+
+func addFileFingerprintAlgorithmColumn(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+ALTER TABLE file
+ADD COLUMN fingerprint_algorithm TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	return nil
+}
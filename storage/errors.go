@@ -18,6 +18,7 @@ package storage
 import (
 	"fmt"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
 )
 
 type AbsolutePathResolutionError struct {
@@ -38,3 +39,26 @@ type FileTagDoesNotExist struct {
 func (err FileTagDoesNotExist) Error() string {
 	return fmt.Sprintf("File-tag for file #%v, tag #%v and value #%v does not exist", err.FileId, err.TagId, err.ValueId)
 }
+
+// Determines whether the error occurred because the database is locked by
+// another connection, in which case the transaction may be retried.
+func IsBusy(err error) bool {
+	return database.IsBusy(err)
+}
+
+// Determines whether the error occurred because a change would have violated
+// a database constraint, such as the uniqueness of a tag name.
+func IsConstraintViolation(err error) bool {
+	return database.IsConstraintViolation(err)
+}
+
+// Determines whether the error occurred because an entity does not exist.
+func IsNotFound(err error) bool {
+	switch err.(type) {
+	case FileTagDoesNotExist, database.NoSuchFileError, database.NoSuchValueError, database.NoSuchQueryError,
+		database.NoSuchFileTagError, database.NoSuchImplicationError, database.NoSuchRuleError, database.NoSuchSettingError:
+		return true
+	}
+
+	return false
+}
@@ -128,6 +128,11 @@ func (store *Storage) FilesForQuery(tx *Tx, expression query.Expression, path st
 	return files, err
 }
 
+// Determines whether the file with the specified ID matches the specified query.
+func (store *Storage) FileMatchesQuery(tx *Tx, fileId entities.FileId, expression query.Expression, explicitOnly, ignoreCase bool) (bool, error) {
+	return database.FileMatchesQuery(tx.tx, fileId, expression, explicitOnly, ignoreCase)
+}
+
 // Retrieves the sets of duplicate files within the database.
 func (store *Storage) DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 	fileSets, err := database.DuplicateFiles(tx.tx)
@@ -140,18 +145,18 @@ func (store *Storage) DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 }
 
 // Adds a file to the database.
-func (store *Storage) AddFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+func (store *Storage) AddFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, fingerprintAlgorithm string, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
 	relPath := store.relPath(path)
-	file, err := database.InsertFile(tx.tx, relPath, fingerprint, modTime, size, isDir)
+	file, err := database.InsertFile(tx.tx, relPath, fingerprint, fingerprintAlgorithm, modTime, size, isDir)
 	store.absPath(file)
 
 	return file, err
 }
 
 // Updates a file in the database.
-func (store *Storage) UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+func (store *Storage) UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, fingerprintAlgorithm string, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
 	relPath := store.relPath(path)
-	file, err := database.UpdateFile(tx.tx, fileId, relPath, fingerprint, modTime, size, isDir)
+	file, err := database.UpdateFile(tx.tx, fileId, relPath, fingerprint, fingerprintAlgorithm, modTime, size, isDir)
 	store.absPath(file)
 
 	return file, err
@@ -159,7 +164,16 @@ func (store *Storage) UpdateFile(tx *Tx, fileId entities.FileId, path string, fi
 
 // Deletes a file from the database.
 func (store *Storage) DeleteFile(tx *Tx, fileId entities.FileId) error {
-	return database.DeleteFile(tx.tx, fileId)
+	file, err := store.File(tx, fileId)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DeleteFile(tx.tx, fileId); err != nil {
+		return err
+	}
+
+	return store.deleteCachedFingerprint(tx, file)
 }
 
 // Deletes a file if it is untagged
@@ -179,7 +193,36 @@ func (store *Storage) DeleteFileIfUntagged(tx *Tx, fileId entities.FileId) error
 
 // Deletes the specified files if they are untagged
 func (store *Storage) DeleteUntaggedFiles(tx *Tx, fileIds entities.FileIds) error {
-	return database.DeleteUntaggedFiles(tx.tx, fileIds)
+	files := make(entities.Files, 0, len(fileIds))
+	for _, fileId := range fileIds {
+		file, err := store.File(tx, fileId)
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+
+	if err := database.DeleteUntaggedFiles(tx.tx, fileIds); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		remaining, err := database.File(tx.tx, file.Id)
+		if err != nil {
+			return err
+		}
+		if remaining != nil {
+			continue
+		}
+
+		if err := store.deleteCachedFingerprint(tx, file); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // unexported
@@ -17,6 +17,7 @@ package storage
 
 import (
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage/database"
 )
 
@@ -122,6 +123,25 @@ func (storage *Storage) FileTagsByFileId(tx *Tx, fileId entities.FileId, explici
 	return fileTags, nil
 }
 
+// Retrieves the file tags for the files matching the specified query.
+func (storage *Storage) FileTagsForQuery(tx *Tx, expression query.Expression, explicitOnly, ignoreCase bool) (entities.FileTags, error) {
+	fileTags, err := database.FileTagsForQuery(tx.tx, expression, explicitOnly, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	if explicitOnly {
+		return fileTags, nil
+	}
+
+	implications, err := storage.Implications(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return addImplications(fileTags, implications), nil
+}
+
 // Adds a file tag.
 func (storage *Storage) AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
 	return database.AddFileTag(tx.tx, fileId, tagId, valueId)
@@ -235,3 +255,47 @@ func (storage *Storage) addImpliedFileTags(tx *Tx, fileTags entities.FileTags) (
 
 	return fileTags, nil
 }
+
+// Adds the file tags implied by the specified implications to the file tags,
+// which may be those of many files.
+func addImplications(fileTags entities.FileTags, implications entities.Implications) entities.FileTags {
+	type fileTagKey struct {
+		fileId  entities.FileId
+		tagId   entities.TagId
+		valueId entities.ValueId
+	}
+
+	implicationsByTagId := make(map[entities.TagId]entities.Implications)
+	for _, implication := range implications {
+		tagId := implication.ImplyingTag.Id
+		implicationsByTagId[tagId] = append(implicationsByTagId[tagId], implication)
+	}
+
+	fileTagsByKey := make(map[fileTagKey]*entities.FileTag, len(fileTags))
+	for _, fileTag := range fileTags {
+		fileTagsByKey[fileTagKey{fileTag.FileId, fileTag.TagId, fileTag.ValueId}] = fileTag
+	}
+
+	// WARN: this cannot use 'range' as fileTags is expanded within the loop
+	for index := 0; index < len(fileTags); index++ {
+		fileTag := fileTags[index]
+
+		for _, implication := range implicationsByTagId[fileTag.TagId] {
+			if implication.ImplyingValue.Id != 0 && implication.ImplyingValue.Id != fileTag.ValueId {
+				continue
+			}
+
+			key := fileTagKey{fileTag.FileId, implication.ImpliedTag.Id, implication.ImpliedValue.Id}
+			if impliedFileTag, found := fileTagsByKey[key]; found {
+				impliedFileTag.Implicit = true
+				continue
+			}
+
+			impliedFileTag := entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, implication.ImpliedValue.Id, false, true}
+			fileTags = append(fileTags, &impliedFileTag)
+			fileTagsByKey[key] = &impliedFileTag
+		}
+	}
+
+	return fileTags
+}
@@ -0,0 +1,161 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/common/filesystem"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+	"os"
+	"sync"
+)
+
+// A cache of the file fingerprints created by a particular algorithm, held in
+// the database. It may be used concurrently.
+type FingerprintCache struct {
+	// Whether to reuse the fingerprints stored for unmodified tagged files
+	// that were created by the cache's algorithm.
+	ReuseStored bool
+
+	// Whether to leave the cache unchanged, such as when pretending.
+	ReadOnly bool
+
+	store     *Storage
+	tx        *Tx
+	algorithm string
+	mutex     sync.Mutex
+}
+
+// Creates a cache of the file fingerprints created by the specified algorithm.
+func (store *Storage) NewFingerprintCache(tx *Tx, algorithm string) *FingerprintCache {
+	return &FingerprintCache{store: store, tx: tx, algorithm: algorithm}
+}
+
+// Retrieves the cached fingerprint of an unmodified file, falling back to that
+// stored for the tagged file if stored fingerprints are being reused and it was
+// created by the same algorithm.
+func (cache *FingerprintCache) Get(path string, stat os.FileInfo) (fingerprint.Fingerprint, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	fp, found, err := cache.store.CachedFingerprint(cache.tx, stat, cache.algorithm)
+	if err != nil {
+		log.Warnf("%v: could not retrieve cached fingerprint: %v", path, err)
+	}
+	if found {
+		log.Infof(3, "%v: using cached fingerprint", path)
+		return fp, true
+	}
+
+	if !cache.ReadOnly {
+		if err := cache.store.DeleteStaleCachedFingerprint(cache.tx, stat, cache.algorithm); err != nil {
+			log.Warnf("%v: could not remove stale cached fingerprint: %v", path, err)
+		}
+	}
+
+	if !cache.ReuseStored {
+		return fingerprint.Empty, false
+	}
+
+	file, err := cache.store.FileByPath(cache.tx, path)
+	if err != nil || file == nil || file.IsDir || file.Fingerprint == fingerprint.Empty {
+		return fingerprint.Empty, false
+	}
+
+	if file.FingerprintAlgorithm != cache.algorithm {
+		return fingerprint.Empty, false
+	}
+
+	if !file.ModTime.Equal(stat.ModTime().UTC()) || file.Size != stat.Size() {
+		return fingerprint.Empty, false
+	}
+
+	log.Infof(3, "%v: reusing stored fingerprint", path)
+
+	return file.Fingerprint, true
+}
+
+// Adds the calculated fingerprint of a file to the cache.
+func (cache *FingerprintCache) Put(path string, stat os.FileInfo, fp fingerprint.Fingerprint) {
+	if fp == fingerprint.Empty || cache.ReadOnly {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if err := cache.store.UpdateCachedFingerprint(cache.tx, stat, cache.algorithm, fp); err != nil {
+		log.Warnf("%v: could not cache fingerprint: %v", path, err)
+	}
+}
+
+// Retrieves the fingerprint cached for the unmodified file described by stat
+// that was created using the specified algorithm, if there is one.
+func (store *Storage) CachedFingerprint(tx *Tx, stat os.FileInfo, algorithm string) (fingerprint.Fingerprint, bool, error) {
+	device, inode, ok := filesystem.Identity(stat)
+	if !ok {
+		return fingerprint.Empty, false, nil
+	}
+
+	return database.CachedFingerprint(tx.tx, device, inode, stat.Size(), stat.ModTime().UnixNano(), algorithm)
+}
+
+// Caches the fingerprint of the file described by stat.
+func (store *Storage) UpdateCachedFingerprint(tx *Tx, stat os.FileInfo, algorithm string, fp fingerprint.Fingerprint) error {
+	device, inode, ok := filesystem.Identity(stat)
+	if !ok {
+		return nil
+	}
+
+	return database.UpdateCachedFingerprint(tx.tx, device, inode, stat.Size(), stat.ModTime().UnixNano(), algorithm, fp)
+}
+
+// Removes the cached fingerprint of the file described by stat if it is out of
+// date or was created using a different algorithm.
+func (store *Storage) DeleteStaleCachedFingerprint(tx *Tx, stat os.FileInfo, algorithm string) error {
+	device, inode, ok := filesystem.Identity(stat)
+	if !ok {
+		return nil
+	}
+
+	return database.DeleteStaleCachedFingerprint(tx.tx, device, inode, stat.Size(), stat.ModTime().UnixNano(), algorithm)
+}
+
+// unexported
+
+// Removes the cached fingerprint of a file that has been deleted from the
+// database. Nothing identifies the cached fingerprint of a file that is no
+// longer on disk: such a cache entry is removed as stale once its inode is
+// reused.
+func (store *Storage) deleteCachedFingerprint(tx *Tx, file *entities.File) error {
+	if file == nil || file.IsDir {
+		return nil
+	}
+
+	stat, err := os.Stat(file.Path())
+	if err != nil {
+		return nil
+	}
+
+	device, inode, ok := filesystem.Identity(stat)
+	if !ok {
+		return nil
+	}
+
+	return database.DeleteCachedFingerprint(tx.tx, device, inode)
+}
@@ -0,0 +1,41 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the image fingerprints calculated using the specified algorithm.
+func (store *Storage) ImageFingerprints(tx *Tx, algorithm string) (entities.ImageFingerprints, error) {
+	return database.ImageFingerprints(tx.tx, algorithm)
+}
+
+// Retrieves the image fingerprint for the specified file.
+func (store *Storage) ImageFingerprintByFileId(tx *Tx, fileId entities.FileId) (*entities.ImageFingerprint, error) {
+	return database.ImageFingerprintByFileId(tx.tx, fileId)
+}
+
+// Sets the image fingerprint for the specified file, removing it if the fingerprint is empty.
+func (store *Storage) UpdateImageFingerprint(tx *Tx, fileId entities.FileId, algorithm string, fp fingerprint.Fingerprint) error {
+	if fp == fingerprint.Empty {
+		return database.DeleteImageFingerprint(tx.tx, fileId)
+	}
+
+	return database.UpdateImageFingerprint(tx.tx, fileId, algorithm, fp)
+}
@@ -0,0 +1,36 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// The complete set of automatic tagging rules.
+func (storage *Storage) Rules(tx *Tx) (entities.Rules, error) {
+	return database.Rules(tx.tx)
+}
+
+// Adds an automatic tagging rule.
+func (storage *Storage) AddRule(tx *Tx, condition, tags string) (*entities.Rule, error) {
+	return database.InsertRule(tx.tx, condition, tags)
+}
+
+// Removes an automatic tagging rule.
+func (storage *Storage) DeleteRule(tx *Tx, ruleId entities.RuleId) error {
+	return database.DeleteRule(tx.tx, ruleId)
+}
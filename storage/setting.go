@@ -26,6 +26,8 @@ var defaultSettings = entities.Settings{
 	&entities.Setting{"autoCreateValues", "yes"},
 	&entities.Setting{"directoryFingerprintAlgorithm", "none"},
 	&entities.Setting{"fileFingerprintAlgorithm", "dynamic:SHA256"},
+	&entities.Setting{"imageFingerprintAlgorithm", "none"},
+	&entities.Setting{"metadataTags", "album artist camera genre gps year"},
 	&entities.Setting{"reportDuplicates", "yes"},
 	&entities.Setting{"symlinkFingerprintAlgorithm", "follow"}}
 
@@ -26,6 +26,8 @@ type Storage struct {
 	db       *database.Database
 	DbPath   string
 	RootPath string
+	borrowed bool
+	outer    *Tx
 }
 
 func CreateAt(path string) error {
@@ -45,10 +47,26 @@ func OpenAt(path string) (*Storage, error) {
 
 	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
 
-	return &Storage{db, path, rootPath}, nil
+	return &Storage{db, path, rootPath, false, nil}, nil
+}
+
+// Borrows the open database connection: closing the borrowed storage leaves the
+// connection open for further use.
+func (storage *Storage) Borrow() *Storage {
+	return &Storage{storage.db, storage.DbPath, storage.RootPath, true, storage.outer}
+}
+
+// Borrows the open database connection such that the transactions begun upon
+// the borrowed storage are nested within the specified transaction.
+func (storage *Storage) Nest(tx *Tx) *Storage {
+	return &Storage{storage.db, storage.DbPath, storage.RootPath, true, tx}
 }
 
 func (storage *Storage) Begin() (*Tx, error) {
+	if storage.outer != nil {
+		return storage.outer.Nest()
+	}
+
 	tx, err := storage.db.Begin()
 	if err != nil {
 		return nil, err
@@ -62,6 +80,11 @@ func (storage *Storage) Close() error {
 		return nil
 	}
 
+	if storage.borrowed {
+		storage.db = nil
+		return nil
+	}
+
 	err := storage.db.Close()
 	if err != nil {
 		return fmt.Errorf("could not close database: %v", err)
@@ -84,6 +107,17 @@ func (tx *Tx) Rollback() error {
 	return tx.tx.Rollback()
 }
 
+// Begins a transaction nested within this one that may be rolled back
+// independently.
+func (tx *Tx) Nest() (*Tx, error) {
+	nested, err := tx.tx.Nest()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{nested}, nil
+}
+
 // unexported
 
 func determineRootPath(dbPath string) (string, error) {
@@ -0,0 +1,345 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const valuesDir = "values"
+const treeDir = ".tree"
+
+// Identifies the position of the directory tree view within a path, or -1 if
+// the path is not within one. The tree view appears at the top-level as the
+// 'files' directory and within each tag directory as the '.tree' directory,
+// which cannot clash with a tag as names starting with '.' are escaped.
+func treeIndex(path []string) int {
+	switch path[0] {
+	case filesDir:
+		return 0
+	case tagsDir:
+		for index := 2; index < len(path); index++ {
+			switch path[index] {
+			case treeDir:
+				return index
+			case filesDir:
+				return -1
+			}
+		}
+	}
+
+	return -1
+}
+
+func (vfs FuseVfs) valueDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN valueDirectories")
+	defer log.Infof(2, "END valueDirectories")
+
+	values, err := vfs.store.Values(tx)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve values")
+	}
+
+	visibleValueIds, status := vfs.visibleValueIds(tx)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(values))
+	for _, value := range values {
+		if value.Name == "" || (visibleValueIds != nil && !visibleValueIds[value.Id]) {
+			continue
+		}
+
+		entries = append(entries, fuse.DirEntry{Name: escape(value.Name), Mode: fuse.S_IFDIR})
+	}
+
+	return entries, fuse.OK
+}
+
+func (vfs FuseVfs) getValueEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getValueEntryAttr(%v)", path)
+	defer log.Infof(2, "END getValueEntryAttr(%v)", path)
+
+	switch len(path) {
+	case 1:
+		tx, status := vfs.begin()
+		if status != fuse.OK {
+			return nil, status
+		}
+		defer tx.Commit()
+
+		valueName := unescape(path[0])
+
+		value, err := vfs.store.ValueByName(tx, valueName)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve value '%v'", valueName)
+		}
+		if value == nil || valueName == "" {
+			return nil, fuse.ENOENT
+		}
+
+		visibleValueIds, status := vfs.visibleValueIds(tx)
+		if status != fuse.OK {
+			return nil, status
+		}
+		if visibleValueIds != nil && !visibleValueIds[value.Id] {
+			return nil, fuse.ENOENT
+		}
+
+		modTime := vfs.cache.databaseModTime()
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
+	case 2:
+		fileId := vfs.parseFileId(path[1])
+		if fileId != 0 {
+			return vfs.getFileEntryAttr(fileId)
+		}
+	}
+
+	return nil, fuse.ENOENT
+}
+
+func (vfs FuseVfs) openValueEntryDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN openValueEntryDir(%v)", path)
+	defer log.Infof(2, "END openValueEntryDir(%v)", path)
+
+	if len(path) != 1 {
+		return nil, fuse.ENOENT
+	}
+
+	valueName := unescape(path[0])
+
+	value, err := vfs.store.ValueByName(tx, valueName)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve value '%v'", valueName)
+	}
+	if value == nil || valueName == "" {
+		return nil, fuse.ENOENT
+	}
+
+	fileTags, err := vfs.store.FileTagsByValueId(tx, value.Id)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve file-tags for value '%v'", valueName)
+	}
+
+	fileIds := make(entities.FileIds, len(fileTags))
+	for index, fileTag := range fileTags {
+		fileIds[index] = fileTag.FileId
+	}
+	sort.Sort(fileIds)
+
+	visibleFileIds, status := vfs.visibleFileIds(tx)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(fileIds))
+	for _, fileId := range fileIds.Uniq() {
+		if visibleFileIds != nil && !visibleFileIds[fileId] {
+			continue
+		}
+
+		file, err := vfs.store.File(tx, fileId)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve file '%v'", fileId)
+		}
+
+		entries = append(entries, fuse.DirEntry{Name: vfs.getLinkName(file), Mode: fuse.S_IFLNK})
+	}
+
+	return entries, fuse.OK
+}
+
+// Splits a path within the tree view into the tag directory path that filters
+// the view and the path of the real directory or file within the view.
+func splitTreePath(path []string, index int) ([]string, []string) {
+	if index == 0 {
+		return []string{}, path[1:]
+	}
+
+	return path[1:index], path[index+1:]
+}
+
+// The directories of the files shown in a tree view, calculated once for each
+// tag directory path.
+type treeListing struct {
+	entries map[string][]fuse.DirEntry
+	files   map[string]*entities.File
+}
+
+func newTreeListing(files entities.Files) *treeListing {
+	names := make(map[string]map[string]bool)
+	addName := func(dirPath, name string, isDir bool) bool {
+		dirNames, found := names[dirPath]
+		if !found {
+			dirNames = make(map[string]bool)
+			names[dirPath] = dirNames
+		}
+
+		wasDir, existed := dirNames[name]
+		dirNames[name] = wasDir || isDir
+
+		return existed
+	}
+
+	listing := treeListing{make(map[string][]fuse.DirEntry), make(map[string]*entities.File, len(files))}
+
+	for _, file := range files {
+		path := file.Path()
+		listing.files[path] = file
+
+		isDir := false
+		for path != string(filepath.Separator) {
+			dirPath := filepath.Dir(path)
+			if addName(dirPath, filepath.Base(path), isDir) && isDir {
+				break
+			}
+
+			path = dirPath
+			isDir = true
+		}
+	}
+
+	for dirPath, dirNames := range names {
+		entries := make([]fuse.DirEntry, 0, len(dirNames))
+		for name, isDir := range dirNames {
+			if isDir {
+				entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR | 0755})
+			} else {
+				entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFLNK})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+		listing.entries[dirPath] = entries
+	}
+
+	return &listing
+}
+
+// Identifies the entry at the path within the tree view: either a directory
+// containing files or a file, which is shown as a symbolic link.
+func (listing *treeListing) entry(treePath []string) (file *entities.File, isDir bool, found bool) {
+	entryPath := string(filepath.Separator) + filepath.Join(treePath...)
+
+	if _, isDir := listing.entries[entryPath]; isDir {
+		return nil, true, true
+	}
+
+	file, found = listing.files[entryPath]
+	return file, false, found
+}
+
+// Retrieves the listing of the tree view filtered by the tag directory path.
+func (vfs FuseVfs) treeListing(tx *storage.Tx, tagPath []string) (*treeListing, fuse.Status) {
+	key := strings.Join(tagPath, string(filepath.Separator))
+	if listing, found := vfs.cache.tree(key); found {
+		return listing, fuse.OK
+	}
+
+	files, err := vfs.store.FilesForQuery(tx, vfs.restrict(pathToExpression(tagPath)), "", false, false, "name")
+	if err != nil {
+		return nil, vfs.fail(err, "could not query files")
+	}
+
+	listing := newTreeListing(files)
+	vfs.cache.putTree(key, listing)
+
+	return listing, fuse.OK
+}
+
+func (vfs FuseVfs) getTreeEntryAttr(path []string, index int) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getTreeEntryAttr(%v)", path)
+	defer log.Infof(2, "END getTreeEntryAttr(%v)", path)
+
+	tagPath, treePath := splitTreePath(path, index)
+
+	if len(tagPath) > 0 {
+		if _, status := vfs.getTaggedEntryAttr(tagPath); status != fuse.OK {
+			return nil, status
+		}
+	}
+
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	listing, status := vfs.treeListing(tx, tagPath)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	file, isDir, found := listing.entry(treePath)
+	switch {
+	case isDir || len(treePath) == 0:
+		modTime := vfs.cache.databaseModTime()
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
+	case found:
+		return vfs.getFileEntryAttr(file.Id)
+	}
+
+	return nil, fuse.ENOENT
+}
+
+func (vfs FuseVfs) openTreeDir(tx *storage.Tx, path []string, index int) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN openTreeDir(%v)", path)
+	defer log.Infof(2, "END openTreeDir(%v)", path)
+
+	tagPath, treePath := splitTreePath(path, index)
+	dirPath := string(filepath.Separator) + filepath.Join(treePath...)
+
+	listing, status := vfs.treeListing(tx, tagPath)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	return append([]fuse.DirEntry{}, listing.entries[dirPath]...), fuse.OK
+}
+
+func (vfs FuseVfs) readTreeLink(tx *storage.Tx, path []string, index int) (string, fuse.Status) {
+	log.Infof(2, "BEGIN readTreeLink(%v)", path)
+	defer log.Infof(2, "END readTreeLink(%v)", path)
+
+	tagPath, treePath := splitTreePath(path, index)
+
+	listing, status := vfs.treeListing(tx, tagPath)
+	if status != fuse.OK {
+		return "", status
+	}
+
+	file, isDir, found := listing.entry(treePath)
+	if isDir || !found {
+		return "", fuse.ENOENT
+	}
+
+	absDirPath := filepath.Join(vfs.mountPath, filepath.Join(path[:len(path)-1]...))
+	relPath, err := filepath.Rel(absDirPath, file.Path())
+	if err != nil {
+		return "", vfs.fail(err, "could not make relative path")
+	}
+
+	return relPath, fuse.OK
+}
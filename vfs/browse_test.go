@@ -0,0 +1,98 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTreeView(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	addFile(test, store, filepath.Join(dir, "photos", "beach.jpg"), "holiday")
+	addFile(test, store, filepath.Join(dir, "photos", "2017", "hill.jpg"), "holiday")
+	addFile(test, store, filepath.Join(dir, "notes.txt"), "holiday")
+	addFile(test, store, filepath.Join(dir, "work.txt"), "work")
+	vfs := newFuseVfs(store, "/mnt", false, nil)
+
+	treePath := filepath.Join(append([]string{"tags", "holiday", treeDir}, vfs.splitPath(dir[1:])...)...)
+
+	assertEntries(test, vfs, treePath, []string{"notes.txt", "photos/"})
+	assertEntries(test, vfs, filepath.Join(treePath, "photos"), []string{"2017/", "beach.jpg"})
+
+	attr, status := vfs.GetAttr(filepath.Join(treePath, "photos", "2017"), nil)
+	if status != fuse.OK || attr.Mode&fuse.S_IFDIR == 0 {
+		test.Fatalf("Expected a directory but status was %v.", status)
+	}
+
+	target, status := vfs.Readlink(filepath.Join(treePath, "photos", "2017", "hill.jpg"), nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if filepath.Join("/mnt", treePath, "photos", "2017", target) != filepath.Join(dir, "photos", "2017", "hill.jpg") {
+		test.Fatalf("Unexpected link target '%v'.", target)
+	}
+
+	if _, status := vfs.GetAttr(filepath.Join(treePath, "work.txt"), nil); status != fuse.ENOENT {
+		test.Fatalf("Expected %v for a file without the tag but status was %v.", fuse.ENOENT, status)
+	}
+}
+
+func TestTreeViewDoesNotHideTags(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday", "tree", ".tree")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	assertEntries(test, vfs, "tags/holiday", []string{".tree/", "files/", "tree/", "\u200B.tree/"})
+	assertEntries(test, vfs, "tags/holiday/tree/files", []string{".photo.1.jpg.tags", "photo.1.jpg"})
+	assertEntries(test, vfs, "tags/\u200B.tree/files", []string{".photo.1.jpg.tags", "photo.1.jpg"})
+}
+
+// unexported
+
+// Asserts the sorted names of the directory's entries, with '/' appended to
+// those of directories.
+func assertEntries(test *testing.T, vfs FuseVfs, path string, expected []string) {
+	entries, status := vfs.OpenDir(path, nil)
+	if status != fuse.OK {
+		test.Fatalf("Could not open directory '%v': %v", path, status)
+	}
+
+	names := make([]string, len(entries))
+	for index, entry := range entries {
+		names[index] = entry.Name
+		if entry.Mode&fuse.S_IFDIR != 0 {
+			names[index] += "/"
+		}
+	}
+	sort.Strings(names)
+
+	if !reflect.DeepEqual(names, expected) {
+		test.Fatalf("Expected entries %v in '%v' but were %v.", expected, path, names)
+	}
+}
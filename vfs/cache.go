@@ -0,0 +1,185 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"os"
+	"sync"
+	"time"
+)
+
+// How long the kernel may cache directory entries and attributes. Attributes
+// are kept brief as the size of a '.tags' file changes with the file's tags.
+// Failed lookups are not cached as looking up a query directory creates it.
+const entryTimeout = 5 * time.Second
+const attrTimeout = time.Second
+
+// How long cached listings and attributes are used before being recalculated,
+// even if the database is unchanged, so that changes to the tagged files
+// themselves are picked up.
+const cacheTimeout = 10 * time.Second
+
+type cachedAttr struct {
+	attr   *fuse.Attr
+	status fuse.Status
+}
+
+type cachedDir struct {
+	entries []fuse.DirEntry
+	status  fuse.Status
+}
+
+// A cache of the directory listings and attributes of the virtual filesystem,
+// which is cleared whenever the database changes.
+type vfsCache struct {
+	sync.Mutex
+
+	dbPath  string
+	modTime time.Time
+	size    int64
+	expires time.Time
+	attrs   map[string]cachedAttr
+	dirs    map[string]cachedDir
+	trees   map[string]*treeListing
+}
+
+func newVfsCache(dbPath string) *vfsCache {
+	return &vfsCache{dbPath: dbPath, attrs: make(map[string]cachedAttr), dirs: make(map[string]cachedDir), trees: make(map[string]*treeListing)}
+}
+
+// Retrieves the time the database was last changed.
+func (cache *vfsCache) databaseModTime() time.Time {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.validate()
+
+	return cache.modTime
+}
+
+// Retrieves the cached attributes for the path.
+func (cache *vfsCache) attr(name string) (*fuse.Attr, fuse.Status, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.validate()
+
+	cached, found := cache.attrs[name]
+	if !found {
+		return nil, fuse.OK, false
+	}
+	if cached.attr == nil {
+		return nil, cached.status, true
+	}
+
+	attr := *cached.attr
+	return &attr, cached.status, true
+}
+
+func (cache *vfsCache) putAttr(name string, attr *fuse.Attr, status fuse.Status) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if attr != nil {
+		copied := *attr
+		attr = &copied
+	}
+
+	cache.attrs[name] = cachedAttr{attr, status}
+}
+
+// Retrieves the cached listing of the directory at the path.
+func (cache *vfsCache) dir(name string) ([]fuse.DirEntry, fuse.Status, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.validate()
+
+	cached, found := cache.dirs[name]
+	if !found {
+		return nil, fuse.OK, false
+	}
+
+	return append([]fuse.DirEntry{}, cached.entries...), cached.status, true
+}
+
+func (cache *vfsCache) putDir(name string, entries []fuse.DirEntry, status fuse.Status) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.dirs[name] = cachedDir{append([]fuse.DirEntry{}, entries...), status}
+}
+
+// Retrieves the cached tree view listing for the tag directory path.
+func (cache *vfsCache) tree(tagPath string) (*treeListing, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.validate()
+
+	listing, found := cache.trees[tagPath]
+	return listing, found
+}
+
+func (cache *vfsCache) putTree(tagPath string, listing *treeListing) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.trees[tagPath] = listing
+}
+
+// Clears the cache following a change made through the virtual filesystem.
+func (cache *vfsCache) invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.clear()
+}
+
+// unexported
+
+// Clears the cache if the database has changed or the cache has expired.
+func (cache *vfsCache) validate() {
+	now := time.Now()
+
+	var modTime time.Time
+	var size int64
+	if stat, err := os.Stat(cache.dbPath); err == nil {
+		modTime = stat.ModTime()
+		size = stat.Size()
+	} else {
+		modTime = now
+	}
+
+	if modTime.Equal(cache.modTime) && size == cache.size && now.Before(cache.expires) {
+		return
+	}
+
+	cache.clear()
+	cache.modTime = modTime
+	cache.size = size
+	cache.expires = now.Add(cacheTimeout)
+}
+
+func (cache *vfsCache) clear() {
+	cache.attrs = make(map[string]cachedAttr)
+	cache.dirs = make(map[string]cachedDir)
+	cache.trees = make(map[string]*treeListing)
+	cache.expires = time.Time{}
+}
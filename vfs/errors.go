@@ -0,0 +1,139 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const errorsFilename = ".errors"
+
+// The number of failures retained for the '.errors' file.
+const maxErrors = 100
+
+// How many times, and how often, an operation is attempted whilst the database
+// is locked by another process. (SQLite itself waits a few seconds for the lock
+// before reporting the database as busy.)
+const busyAttempts = 3
+const busyRetryDelay = 100 * time.Millisecond
+
+// The most recent failures of the virtual filesystem operations.
+type errorLog struct {
+	sync.Mutex
+	entries []string
+}
+
+func (errors *errorLog) add(message string) {
+	errors.Lock()
+	defer errors.Unlock()
+
+	entry := time.Now().Format(time.RFC3339) + " " + message + "\n"
+
+	if len(errors.entries) == maxErrors {
+		errors.entries = errors.entries[1:]
+	}
+	errors.entries = append(errors.entries, entry)
+}
+
+func (errors *errorLog) text() []byte {
+	errors.Lock()
+	defer errors.Unlock()
+
+	buffer := new(bytes.Buffer)
+	for _, entry := range errors.entries {
+		buffer.WriteString(entry)
+	}
+
+	return buffer.Bytes()
+}
+
+// Records the failure and identifies the status to report for it.
+func (vfs FuseVfs) fail(err error, format string, values ...interface{}) fuse.Status {
+	status := errorStatus(err)
+
+	if status != fuse.EBUSY {
+		message := fmt.Sprintf(format, values...) + ": " + err.Error()
+
+		log.Warn(message)
+		vfs.errors.add(message)
+	}
+
+	return status
+}
+
+// Identifies the status to report for an error.
+func errorStatus(err error) fuse.Status {
+	switch {
+	case storage.IsBusy(err):
+		return fuse.EBUSY
+	case storage.IsConstraintViolation(err), os.IsExist(err):
+		return fuse.Status(syscall.EEXIST)
+	case storage.IsNotFound(err), os.IsNotExist(err):
+		return fuse.ENOENT
+	case os.IsPermission(err):
+		return fuse.EACCES
+	}
+
+	return fuse.EIO
+}
+
+// Performs the operation, repeating it whilst the database is busy.
+func (vfs FuseVfs) retry(operation func() fuse.Status) fuse.Status {
+	status := operation()
+
+	for attempt := 1; status == fuse.EBUSY && attempt < busyAttempts; attempt++ {
+		log.Infof(2, "database is busy: retrying")
+
+		time.Sleep(time.Duration(attempt) * busyRetryDelay)
+		status = operation()
+	}
+
+	if status == fuse.EBUSY {
+		message := "database is busy"
+
+		log.Warn(message)
+		vfs.errors.add(message)
+	}
+
+	return status
+}
+
+func (vfs FuseVfs) begin() (*storage.Tx, fuse.Status) {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		return nil, vfs.fail(err, "could not begin transaction")
+	}
+
+	return tx, fuse.OK
+}
+
+func (vfs FuseVfs) commit(tx *storage.Tx) fuse.Status {
+	if err := tx.Commit(); err != nil {
+		return vfs.fail(err, "could not commit transaction")
+	}
+
+	return fuse.OK
+}
@@ -30,6 +30,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -54,13 +55,27 @@ Descend the tag directories to hone in on the files you want:
     $ ls cheese/tomato
     margherita.7
 
+Each tag directory also has a '.tree' directory that mirrors the real directory
+tree of the files it contains. (The top-level 'files' directory does the same
+for every tagged file whilst the top-level 'values' directory has a directory
+for each value containing the files tagged with it.)
+
 The tags directory also allows some operations to be performed:
 
   * Create a tag by creating a new directory
   * Rename a tag by renaming the tag directory
+  * Tag a file by creating a symbolic link to it in a tag directory
   * Untag a file by deleting the file symlink from the tag directory
+  * Retag a file by moving its symlink to another tag or value directory
   * Delete an unused tag by deleting the directory
 
+Each file symlink is accompanied by a hidden '.NAME.tags' file listing the
+file's tags one per line: writing to it, or renaming a file over it as some
+editors do when saving, replaces the file's tags. The tags can also be read
+and edited through the extended attributes of this file:
+'user.tmsu.tags' holds all of the file's tags, as shown by 'tmsu tags', and
+'user.tmsu.tag.NAME' the values applied for the tag NAME.
+
 (This file will hide once you have created a few tags.)`
 
 const queriesDir = "queries"
@@ -82,6 +97,15 @@ match the query. (It is not necessary to create the directory first.)
 You can even create new queries by typing the query into the file chooser of a
 graphical program.
 
+Query directories can be nested to refine a query further: each level must
+also be matched by the files within it. Each query directory also lists the
+other tags of its files as directories to narrow the query by.
+
+    $ ls "cheese/not wine"
+    funghi.11  margherita.7  mushroom  tomato
+    $ ls "cheese/not wine/tomato"
+    margherita.7
+
 Use ` + "`rmdir`" + ` to remove any query directory you no longer need. Do not use ` + "`rm -r`" + `
 as this will untag the contained files.
 
@@ -91,13 +115,37 @@ type FuseVfs struct {
 	store     *storage.Storage
 	mountPath string
 	server    *fuse.Server
+	links     *createdLinks
+	readOnly  bool
+	where     query.Expression
+	cache     *vfsCache
+	errors    *errorLog
+	scratch   *scratchFiles
+}
+
+// The files tagged by creating symbolic links, keyed by the path of the link
+// created, so that the link remains visible under the name it was given.
+type createdLinks struct {
+	sync.Mutex
+	fileIds map[string]entities.FileId
 }
 
-func MountVfs(store *storage.Storage, mountPath string, options []string) (*FuseVfs, error) {
-	fuseVfs := FuseVfs{nil, "", nil}
+// Mounts the virtual filesystem at the specified path. If readOnly is set then
+// the database cannot be changed through the mount and if where is not nil then
+// the mount shows only the files matching it, and their tags.
+func MountVfs(store *storage.Storage, mountPath string, options []string, readOnly bool, where query.Expression) (*FuseVfs, error) {
+	fuseVfs := newFuseVfs(store, "", readOnly, where)
+
+	if readOnly {
+		options = append(options, "ro")
+	}
 
 	pathFs := pathfs.NewPathNodeFs(&fuseVfs, nil)
-	conn := nodefs.NewFileSystemConnector(pathFs.Root(), nil)
+	connectorOptions := nodefs.NewOptions()
+	connectorOptions.EntryTimeout = entryTimeout
+	connectorOptions.AttrTimeout = attrTimeout
+	connectorOptions.NegativeTimeout = 0
+	conn := nodefs.NewFileSystemConnector(pathFs.Root(), connectorOptions)
 	mountOptions := &fuse.MountOptions{Options: options}
 
 	server, err := fuse.NewServer(conn.RawFS(), mountPath, mountOptions)
@@ -110,13 +158,16 @@ func MountVfs(store *storage.Storage, mountPath string, options []string) (*Fuse
 		return nil, fmt.Errorf("could not convert mount path '%v' to absolute: %v", mountPath, err)
 	}
 
-	fuseVfs.store = store
 	fuseVfs.mountPath = absMountPath
 	fuseVfs.server = server
 
 	return &fuseVfs, nil
 }
 
+func newFuseVfs(store *storage.Storage, mountPath string, readOnly bool, where query.Expression) FuseVfs {
+	return FuseVfs{store, mountPath, nil, &createdLinks{fileIds: make(map[string]entities.FileId)}, readOnly, where, newVfsCache(store.DbPath), &errorLog{}, &scratchFiles{files: make(map[string]*scratchFile)}}
+}
+
 func (vfs FuseVfs) Unmount() {
 	vfs.server.Unmount()
 }
@@ -152,15 +203,51 @@ func (vfs FuseVfs) Chown(name string, uid uint32, gid uint32, context *fuse.Cont
 
 func (vfs FuseVfs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
 	log.Infof(2, "BEGIN Create(%v, %v, %v)", name, flags, mode)
-	defer log.Infof(2, "BEGIN Create(%v, %v)", name, flags, mode)
+	defer log.Infof(2, "END Create(%v, %v, %v)", name, flags, mode)
 
-	return nil, fuse.ENOSYS
+	if vfs.readOnly {
+		return nil, fuse.EROFS
+	}
+
+	return vfs.createScratchFile(name)
 }
 
 func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN GetAttr(%v)", name)
 	defer log.Infof(2, "END GetAttr(%v)", name)
 
+	if data, status, found := vfs.statusFileData(name); found {
+		// not cached as the status files change without the database changing
+		if status != fuse.OK {
+			return nil, status
+		}
+
+		return vfs.getStatusFileAttr(data), fuse.OK
+	}
+
+	if file := vfs.scratch.get(name); file != nil {
+		return file.attr(), fuse.OK
+	}
+
+	if attr, status, found := vfs.cache.attr(name); found {
+		return attr, status
+	}
+
+	var attr *fuse.Attr
+	status := vfs.retry(func() fuse.Status {
+		var status fuse.Status
+		attr, status = vfs.getAttr(name)
+		return status
+	})
+
+	if status == fuse.OK || status == fuse.ENOENT {
+		vfs.cache.putAttr(name, attr, status)
+	}
+
+	return attr, status
+}
+
+func (vfs FuseVfs) getAttr(name string) (*fuse.Attr, fuse.Status) {
 	switch name {
 	case databaseFilename:
 		return vfs.getDatabaseFileAttr()
@@ -170,15 +257,27 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 		return vfs.getTagsAttr()
 	case queriesDir:
 		return vfs.getQueryAttr()
+	case valuesDir, filesDir:
+		return vfs.getFilesAttr(nil)
 	}
 
 	path := vfs.splitPath(name)
 
+	if index := treeIndex(path); index != -1 {
+		return vfs.getTreeEntryAttr(path, index)
+	}
+
+	if fileId := vfs.tagsFileId(path); fileId != 0 {
+		return vfs.getTagsFileAttr(fileId)
+	}
+
 	switch path[0] {
 	case tagsDir:
 		return vfs.getTaggedEntryAttr(path[1:])
 	case queriesDir:
 		return vfs.getQueryEntryAttr(path[1:])
+	case valuesDir:
+		return vfs.getValueEntryAttr(path[1:])
 	}
 
 	return nil, fuse.ENOENT
@@ -188,7 +287,19 @@ func (vfs FuseVfs) GetXAttr(name string, attr string, context *fuse.Context) ([]
 	log.Infof(2, "BEGIN GetXAttr(%v, %v)", name, attr)
 	defer log.Infof(2, "END GetAttr(%v, %v)", name, attr)
 
-	return nil, fuse.ENOSYS
+	fileId := vfs.xattrFileId(name)
+	if fileId == 0 {
+		return nil, fuse.ENOATTR
+	}
+
+	var data []byte
+	status := vfs.retry(func() fuse.Status {
+		var status fuse.Status
+		data, status = vfs.getFileXAttr(fileId, attr)
+		return status
+	})
+
+	return data, status
 }
 
 func (vfs FuseVfs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
@@ -202,38 +313,65 @@ func (vfs FuseVfs) ListXAttr(name string, context *fuse.Context) ([]string, fuse
 	log.Infof(2, "BEGIN ListXAttr(%v)", name)
 	defer log.Infof(2, "END ListXAttr(%v)", name)
 
-	return nil, fuse.ENOSYS
+	fileId := vfs.xattrFileId(name)
+	if fileId == 0 {
+		return []string{}, fuse.OK
+	}
+
+	var attrs []string
+	status := vfs.retry(func() fuse.Status {
+		var status fuse.Status
+		attrs, status = vfs.listFileXAttrs(fileId)
+		return status
+	})
+
+	return attrs, status
 }
 
 func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Mkdir(%v)", name)
 	defer log.Infof(2, "END Mkdir(%v)", name)
 
+	if vfs.readOnly {
+		return fuse.EROFS
+	}
+	defer vfs.cache.invalidate()
+
+	return vfs.retry(func() fuse.Status {
+		return vfs.mkdir(name)
+	})
+}
+
+func (vfs FuseVfs) mkdir(name string) fuse.Status {
 	path := vfs.splitPath(name)
 
 	if len(path) != 2 {
 		return fuse.EPERM
 	}
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
-	}
-	defer tx.Commit()
-
 	switch path[0] {
 	case tagsDir:
+		if vfs.restricted() {
+			// new tags would be hidden
+			return fuse.EPERM
+		}
+
 		tagName := unescape(path[1])
+		if err := entities.ValidateTagName(tagName); err != nil {
+			return fuse.EINVAL
+		}
 
-		if _, err := vfs.store.AddTag(tx, tagName); err != nil {
-			log.Fatalf("could not create tag '%v': %v", tagName, err)
+		tx, status := vfs.begin()
+		if status != fuse.OK {
+			return status
 		}
+		defer tx.Rollback()
 
-		if err := tx.Commit(); err != nil {
-			log.Fatalf("could not commit transaction: %v", err)
+		if _, err := vfs.store.AddTag(tx, tagName); err != nil {
+			return vfs.fail(err, "could not create tag '%v'", tagName)
 		}
 
-		return fuse.OK
+		return vfs.commit(tx)
 	case queriesDir:
 		return fuse.EINVAL
 	}
@@ -262,6 +400,17 @@ func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodef
 	log.Infof(2, "BEGIN Open(%v)", name)
 	defer log.Infof(2, "END Open(%v)", name)
 
+	if data, status, found := vfs.statusFileData(name); found {
+		if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+			return nil, fuse.EACCES
+		}
+		if status != fuse.OK {
+			return nil, status
+		}
+
+		return nodefs.NewDataFile(data), fuse.OK
+	}
+
 	switch name {
 	case filepath.Join(queriesDir, helpFilename):
 		return nodefs.NewDataFile([]byte(queryDirHelp)), fuse.OK
@@ -269,6 +418,22 @@ func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodef
 		return nodefs.NewDataFile([]byte(tagsDirHelp)), fuse.OK
 	}
 
+	if fileId := vfs.tagsFileId(vfs.splitPath(name)); fileId != 0 {
+		if vfs.readOnly && flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+			return nil, fuse.EROFS
+		}
+
+		return vfs.openTagsFile(fileId, flags&syscall.O_TRUNC != 0)
+	}
+
+	if file := vfs.scratch.get(name); file != nil {
+		if flags&syscall.O_TRUNC != 0 {
+			file.Truncate(0)
+		}
+
+		return file, fuse.OK
+	}
+
 	return nil, fuse.ENOSYS
 }
 
@@ -276,9 +441,28 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 	log.Infof(2, "BEGIN OpenDir(%v)", name)
 	defer log.Infof(2, "END OpenDir(%v)", name)
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	if entries, status, found := vfs.cache.dir(name); found {
+		return entries, status
+	}
+
+	var entries []fuse.DirEntry
+	status := vfs.retry(func() fuse.Status {
+		var status fuse.Status
+		entries, status = vfs.openDir(name)
+		return status
+	})
+
+	if status == fuse.OK || status == fuse.ENOENT {
+		vfs.cache.putDir(name, entries, status)
+	}
+
+	return entries, status
+}
+
+func (vfs FuseVfs) openDir(name string) ([]fuse.DirEntry, fuse.Status) {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
 	}
 	defer tx.Commit()
 
@@ -289,15 +473,23 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 		return vfs.tagDirectories(tx)
 	case queriesDir:
 		return vfs.queriesDirectories(tx)
+	case valuesDir:
+		return vfs.valueDirectories(tx)
 	}
 
 	path := vfs.splitPath(name)
 
+	if index := treeIndex(path); index != -1 {
+		return vfs.openTreeDir(tx, path, index)
+	}
+
 	switch path[0] {
 	case tagsDir:
 		return vfs.openTaggedEntryDir(tx, path[1:])
 	case queriesDir:
 		return vfs.openQueryEntryDir(tx, path[1:])
+	case valuesDir:
+		return vfs.openValueEntryDir(tx, path[1:])
 	}
 
 	return nil, fuse.ENOENT
@@ -307,19 +499,35 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 	log.Infof(2, "BEGIN Readlink(%v)", name)
 	defer log.Infof(2, "END Readlink(%v)", name)
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
-	}
-	defer tx.Commit()
+	var target string
+	status := vfs.retry(func() fuse.Status {
+		var status fuse.Status
+		target, status = vfs.readlink(name)
+		return status
+	})
 
+	return target, status
+}
+
+func (vfs FuseVfs) readlink(name string) (string, fuse.Status) {
 	if name == databaseFilename {
 		return vfs.readDatabaseFileLink()
 	}
 
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return "", status
+	}
+	defer tx.Commit()
+
 	path := vfs.splitPath(name)
+
+	if index := treeIndex(path); index != -1 {
+		return vfs.readTreeLink(tx, path, index)
+	}
+
 	switch path[0] {
-	case tagsDir, queriesDir:
+	case tagsDir, queriesDir, valuesDir:
 		return vfs.readTaggedEntryLink(tx, path)
 	}
 
@@ -330,75 +538,138 @@ func (vfs FuseVfs) RemoveXAttr(name string, attr string, context *fuse.Context)
 	log.Infof(2, "BEGIN RemoveXAttr(%v, %v)", name, attr)
 	defer log.Infof(2, "END RemoveXAttr(%v, %v)", name, attr)
 
-	return fuse.ENOSYS
+	if vfs.readOnly {
+		return fuse.EROFS
+	}
+	defer vfs.cache.invalidate()
+
+	fileId := vfs.xattrFileId(name)
+	if fileId == 0 {
+		return fuse.ENOATTR
+	}
+
+	return vfs.retry(func() fuse.Status {
+		return vfs.removeFileXAttr(fileId, attr)
+	})
 }
 
 func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Rename(%v, %v)", oldName, newName)
 	defer log.Infof(2, "END Rename(%v, %v)", oldName, newName)
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	if vfs.readOnly {
+		return fuse.EROFS
 	}
-	defer tx.Commit()
+	defer vfs.cache.invalidate()
+
+	if file := vfs.scratch.get(oldName); file != nil {
+		return vfs.renameScratchFile(file, oldName, newName)
+	}
+
+	return vfs.retry(func() fuse.Status {
+		return vfs.rename(oldName, newName)
+	})
+}
 
+func (vfs FuseVfs) rename(oldName string, newName string) fuse.Status {
 	oldPath := vfs.splitPath(oldName)
 	newPath := vfs.splitPath(newName)
 
-	if len(oldPath) != 2 || len(newPath) != 2 {
+	if oldPath[0] != tagsDir || newPath[0] != tagsDir || treeIndex(oldPath) != -1 || treeIndex(newPath) != -1 {
 		return fuse.EPERM
 	}
 
-	if oldPath[0] != tagsDir || newPath[0] != tagsDir {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return status
+	}
+	defer tx.Rollback()
+
+	if fileId := vfs.entryFileId(oldName); fileId != 0 && len(oldPath) > 2 {
+		file, err := vfs.visibleFile(tx, fileId)
+		if err != nil {
+			return vfs.fail(err, "could not retrieve file '%v'", fileId)
+		}
+		if file == nil {
+			return fuse.ENOENT
+		}
+
+		if status := vfs.renameLink(tx, fileId, oldName, newName); status != fuse.OK {
+			return status
+		}
+
+		if status := vfs.commit(tx); status != fuse.OK {
+			return status
+		}
+
+		vfs.links.Lock()
+		delete(vfs.links.fileIds, oldName)
+		vfs.links.fileIds[newName] = fileId
+		vfs.links.Unlock()
+
+		return fuse.OK
+	}
+
+	if len(oldPath) != 2 || len(newPath) != 2 || vfs.restricted() {
 		return fuse.EPERM
 	}
 
 	oldTagName := unescape(oldPath[1])
 	newTagName := unescape(newPath[1])
 
+	if err := entities.ValidateTagName(newTagName); err != nil {
+		return fuse.EINVAL
+	}
+
 	tag, err := vfs.store.TagByName(tx, oldTagName)
 	if err != nil {
-		log.Fatalf("could not retrieve tag '%v': %v", oldTagName, err)
+		return vfs.fail(err, "could not retrieve tag '%v'", oldTagName)
 	}
 	if tag == nil {
 		return fuse.ENOENT
 	}
 
 	if _, err := vfs.store.RenameTag(tx, tag.Id, newTagName); err != nil {
-		log.Fatalf("could not rename tag '%v' to '%v': %v", oldTagName, newTagName, err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		log.Fatalf("could not commit transaction: %v", err)
+		return vfs.fail(err, "could not rename tag '%v' to '%v'", oldTagName, newTagName)
 	}
 
-	return fuse.OK
+	return vfs.commit(tx)
 }
 
 func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Rmdir(%v)", name)
 	defer log.Infof(2, "END Rmdir(%v)", name)
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	if vfs.readOnly {
+		return fuse.EROFS
 	}
-	defer tx.Commit()
+	defer vfs.cache.invalidate()
 
+	return vfs.retry(func() fuse.Status {
+		return vfs.rmdir(name)
+	})
+}
+
+func (vfs FuseVfs) rmdir(name string) fuse.Status {
 	path := vfs.splitPath(name)
 
 	switch path[0] {
 	case tagsDir:
-		if len(path) != 2 {
+		if len(path) != 2 || vfs.restricted() {
 			// can only remove top-level tag directories
 			return fuse.EPERM
 		}
 
+		tx, status := vfs.begin()
+		if status != fuse.OK {
+			return status
+		}
+		defer tx.Rollback()
+
 		tagName := unescape(path[1])
 		tag, err := vfs.store.TagByName(tx, tagName)
 		if err != nil {
-			log.Fatalf("could not retrieve tag '%v': %v", tagName, err)
+			return vfs.fail(err, "could not retrieve tag '%v'", tagName)
 		}
 		if tag == nil {
 			return fuse.ENOENT
@@ -406,38 +677,36 @@ func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 
 		count, err := vfs.store.FileTagCountByTagId(tx, tag.Id, false)
 		if err != nil {
-			log.Fatalf("could not retrieve file-tag count for tag '%v': %v", tagName, err)
+			return vfs.fail(err, "could not retrieve file-tag count for tag '%v'", tagName)
 		}
 		if count > 0 {
 			return fuse.Status(syscall.ENOTEMPTY)
 		}
 
 		if err := vfs.store.DeleteTag(tx, tag.Id); err != nil {
-			log.Fatalf("could not delete tag '%v': %v", tagName, err)
-		}
-
-		if err := tx.Commit(); err != nil {
-			log.Fatalf("could not commit transaction: %v", err)
+			return vfs.fail(err, "could not delete tag '%v'", tagName)
 		}
 
-		return fuse.OK
+		return vfs.commit(tx)
 	case queriesDir:
-		if len(path) != 2 {
+		if len(path) != 2 || vfs.restricted() {
 			// can only remove top-level queries directories
 			return fuse.EPERM
 		}
 
+		tx, status := vfs.begin()
+		if status != fuse.OK {
+			return status
+		}
+		defer tx.Rollback()
+
 		text := path[1]
 
 		if err := vfs.store.DeleteQuery(tx, text); err != nil {
-			log.Fatalf("could not remove tag '%v': %v", name, err)
-		}
-
-		if err := tx.Commit(); err != nil {
-			log.Fatalf("could not commit transaction: %v", err)
+			return vfs.fail(err, "could not remove query '%v'", text)
 		}
 
-		return fuse.OK
+		return vfs.commit(tx)
 	}
 
 	return fuse.ENOSYS
@@ -447,14 +716,37 @@ func (vfs FuseVfs) SetXAttr(name string, attr string, data []byte, flags int, co
 	log.Infof(2, "BEGIN SetXAttr(%v, %v)", name, attr)
 	defer log.Infof(2, "END SetXAttr(%v, %v)", name, attr)
 
-	return fuse.ENOSYS
+	if vfs.readOnly {
+		return fuse.EROFS
+	}
+	defer vfs.cache.invalidate()
+
+	fileId := vfs.xattrFileId(name)
+	if fileId == 0 {
+		return fuse.Status(syscall.ENOTSUP)
+	}
+
+	return vfs.retry(func() fuse.Status {
+		return vfs.setFileXAttr(fileId, attr, data, flags)
+	})
 }
 
 func (vfs FuseVfs) StatFs(name string) *fuse.StatfsOut {
 	log.Infof(2, "BEGIN StatFs(%v)", name)
 	defer log.Infof(2, "END StatFs(%v)", name)
 
-	return &fuse.StatfsOut{}
+	var out *fuse.StatfsOut
+	status := vfs.retry(func() fuse.Status {
+		var status fuse.Status
+		out, status = vfs.statFs()
+		return status
+	})
+
+	if status != fuse.OK {
+		return &fuse.StatfsOut{}
+	}
+
+	return out
 }
 
 func (vfs FuseVfs) String() string {
@@ -465,6 +757,74 @@ func (vfs FuseVfs) Symlink(value string, linkName string, context *fuse.Context)
 	log.Infof(2, "BEGIN Symlink(%v, %v)", value, linkName)
 	defer log.Infof(2, "END Symlink(%v, %v)", value, linkName)
 
+	if vfs.readOnly {
+		return fuse.EROFS
+	}
+	defer vfs.cache.invalidate()
+
+	return vfs.retry(func() fuse.Status {
+		return vfs.symlink(value, linkName)
+	})
+}
+
+func (vfs FuseVfs) symlink(value string, linkName string) fuse.Status {
+	path := vfs.splitPath(linkName)
+
+	if treeIndex(path) != -1 {
+		return fuse.EPERM
+	}
+
+	switch path[0] {
+	case tagsDir:
+		dirPath := linkDirPath(path)
+		if len(dirPath) == 0 {
+			return fuse.EPERM
+		}
+
+		targetPath := value
+		if !filepath.IsAbs(targetPath) {
+			targetPath = filepath.Join(vfs.mountPath, filepath.Dir(linkName), targetPath)
+		}
+		targetPath = filepath.Clean(targetPath)
+
+		tx, status := vfs.begin()
+		if status != fuse.OK {
+			return status
+		}
+		defer tx.Rollback()
+
+		fileId, status := vfs.linkTargetFileId(tx, targetPath)
+		if status != fuse.OK {
+			return status
+		}
+
+		pairs := make(entities.TagIdValueIdPairs, 0, len(dirPath))
+		for _, name := range pathTagValueNames(dirPath) {
+			pair, status := vfs.lookupTagValue(tx, name)
+			if status != fuse.OK {
+				return status
+			}
+
+			pairs = append(pairs, pair)
+		}
+
+		if status := vfs.retagFile(tx, fileId, pairs, nil); status != fuse.OK {
+			return status
+		}
+
+		if status := vfs.commit(tx); status != fuse.OK {
+			return status
+		}
+
+		vfs.links.Lock()
+		vfs.links.fileIds[linkName] = fileId
+		vfs.links.Unlock()
+
+		return fuse.OK
+	case queriesDir:
+		return fuse.EPERM
+	}
+
 	return fuse.ENOSYS
 }
 
@@ -472,6 +832,18 @@ func (vfs FuseVfs) Truncate(name string, offset uint64, context *fuse.Context) f
 	log.Infof(2, "BEGIN Truncate(%v)", name)
 	defer log.Infof(2, "END Truncate(%v)", name)
 
+	if vfs.readOnly {
+		return fuse.EROFS
+	}
+
+	if fileId := vfs.tagsFileId(vfs.splitPath(name)); fileId != 0 {
+		return vfs.truncateTagsFile(fileId, offset)
+	}
+
+	if file := vfs.scratch.get(name); file != nil {
+		return file.Truncate(offset)
+	}
+
 	return fuse.ENOSYS
 }
 
@@ -479,35 +851,59 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Unlink(%v)", name)
 	defer log.Infof(2, "END Unlink(%v)", name)
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	if vfs.readOnly {
+		return fuse.EROFS
 	}
-	defer tx.Commit()
+	defer vfs.cache.invalidate()
 
-	fileId := vfs.parseFileId(name)
+	if vfs.scratch.remove(name) != nil {
+		return fuse.OK
+	}
+
+	return vfs.retry(func() fuse.Status {
+		return vfs.unlink(name)
+	})
+}
+
+func (vfs FuseVfs) unlink(name string) fuse.Status {
+	if treeIndex(vfs.splitPath(name)) != -1 {
+		return fuse.EPERM
+	}
+
+	fileId := vfs.entryFileId(name)
 	if fileId == 0 {
 		// can only unlink file symbolic links
 		return fuse.EPERM
 	}
 
-	file, err := vfs.store.File(tx, fileId)
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return status
+	}
+	defer tx.Rollback()
+
+	file, err := vfs.visibleFile(tx, fileId)
 	if err != nil {
-		log.Fatalf("could not retrieve file '%v': %v", fileId, err)
+		return vfs.fail(err, "could not retrieve file '%v'", fileId)
 	}
 	if file == nil {
 		// reply ok if file doesn't exist otherwise recursive deletes fail
+		vfs.forgetLink(name)
 		return fuse.OK
 	}
 	path := vfs.splitPath(name)
 
 	switch path[0] {
 	case tagsDir:
-		dirName := path[len(path)-3]
+		dirPath := path[:len(path)-1]
+		if dirPath[len(dirPath)-1] == filesDir {
+			dirPath = dirPath[:len(dirPath)-1]
+		}
+		dirName := dirPath[len(dirPath)-1]
 
 		var tagName, valueName string
 		if dirName[0] == '=' {
-			tagName = unescape(path[len(path)-4])
+			tagName = unescape(dirPath[len(dirPath)-2])
 			valueName = unescape(dirName[1:])
 		} else {
 			tagName = unescape(dirName)
@@ -516,30 +912,32 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 
 		tag, err := vfs.store.TagByName(tx, tagName)
 		if err != nil {
-			log.Fatal(err)
+			return vfs.fail(err, "could not retrieve tag '%v'", tagName)
 		}
 		if tag == nil {
-			log.Fatalf("could not retrieve tag '%v'.", tagName)
+			return fuse.ENOENT
 		}
 
 		value, err := vfs.store.ValueByName(tx, valueName)
 		if err != nil {
-			log.Fatal(err)
+			return vfs.fail(err, "could not retrieve value '%v'", valueName)
 		}
 		if value == nil {
-			log.Fatalf("could not retrieve value '%v'.", valueName)
+			return fuse.ENOENT
 		}
 
 		if err = vfs.store.DeleteFileTag(tx, fileId, tag.Id, value.Id); err != nil {
-			log.Fatal(err)
+			return vfs.fail(err, "could not untag file '%v'", fileId)
 		}
 
-		if err := tx.Commit(); err != nil {
-			log.Fatalf("could not commit transaction: %v", err)
+		if status := vfs.commit(tx); status != fuse.OK {
+			return status
 		}
 
+		vfs.forgetLink(name)
+
 		return fuse.OK
-	case queriesDir:
+	case queriesDir, valuesDir:
 		return fuse.EPERM
 	}
 
@@ -556,6 +954,27 @@ func (vfs FuseVfs) splitPath(path string) []string {
 	return strings.Split(path, string(filepath.Separator))
 }
 
+// Identifies the file linked to by the entry at the specified path, whether it
+// is one of the file symbolic links listed or one created by the user.
+func (vfs FuseVfs) entryFileId(name string) entities.FileId {
+	vfs.links.Lock()
+	fileId, found := vfs.links.fileIds[name]
+	vfs.links.Unlock()
+
+	if found {
+		return fileId
+	}
+
+	return vfs.parseFileId(filepath.Base(name))
+}
+
+// Forgets the file symbolic link at the specified path if created by the user.
+func (vfs FuseVfs) forgetLink(name string) {
+	vfs.links.Lock()
+	delete(vfs.links.fileIds, name)
+	vfs.links.Unlock()
+}
+
 func (vfs FuseVfs) parseFileId(name string) entities.FileId {
 	parts := strings.Split(name, ".")
 
@@ -583,8 +1002,13 @@ func (vfs FuseVfs) topFiles() ([]fuse.DirEntry, fuse.Status) {
 
 	entries := []fuse.DirEntry{
 		{Name: databaseFilename, Mode: fuse.S_IFLNK},
+		{Name: errorsFilename, Mode: fuse.S_IFREG},
+		{Name: statsFilename, Mode: fuse.S_IFREG},
+		{Name: missingFilename, Mode: fuse.S_IFREG},
 		{Name: tagsDir, Mode: fuse.S_IFDIR},
-		{Name: queriesDir, Mode: fuse.S_IFDIR}}
+		{Name: queriesDir, Mode: fuse.S_IFDIR},
+		{Name: valuesDir, Mode: fuse.S_IFDIR},
+		{Name: filesDir, Mode: fuse.S_IFDIR}}
 	return entries, fuse.OK
 }
 
@@ -594,7 +1018,24 @@ func (vfs FuseVfs) tagDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status)
 
 	tags, err := vfs.store.Tags(tx)
 	if err != nil {
-		log.Fatalf("Could not retrieve tags: %v", err)
+		return nil, vfs.fail(err, "could not retrieve tags")
+	}
+
+	if vfs.restricted() {
+		files, status := vfs.visibleFiles(tx)
+		if status != fuse.OK {
+			return nil, status
+		}
+
+		tagNames, err := vfs.tagNamesForFiles(tx, files)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve tags")
+		}
+
+		tags, err = vfs.store.TagsByNames(tx, tagNames)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve tags")
+		}
 	}
 
 	entries := make([]fuse.DirEntry, 0, len(tags))
@@ -622,7 +1063,12 @@ func (vfs FuseVfs) queriesDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Sta
 
 	queries, err := vfs.store.Queries(tx)
 	if err != nil {
-		log.Fatalf("could not retrieve queries: %v", err)
+		return nil, vfs.fail(err, "could not retrieve queries")
+	}
+
+	if vfs.restricted() {
+		// saved queries may name hidden tags
+		queries = entities.Queries{}
 	}
 
 	entries := make([]fuse.DirEntry, len(queries))
@@ -641,35 +1087,35 @@ func (vfs FuseVfs) getFilesAttr(path []string) (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getFilesAttr")
 	defer log.Infof(2, "END getFilesAttr")
 
-	now := time.Now()
-	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getTagsAttr() (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getTagsAttr")
 	defer log.Infof(2, "END getTagsAttr")
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
 	}
 	defer tx.Commit()
 
 	tagCount, err := vfs.store.TagCount(tx)
 	if err != nil {
-		log.Fatalf("could not get tag count: %v", err)
+		return nil, vfs.fail(err, "could not get tag count")
 	}
 
-	now := time.Now()
-	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(tagCount), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(tagCount), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getQueryAttr() (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getQueryAttr")
 	defer log.Infof(2, "END getQueryAttr")
 
-	now := time.Now()
-	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
@@ -677,8 +1123,8 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 	defer log.Infof(2, "END getTaggedEntryAttr(%v)", path)
 
 	if len(path) == 1 && path[0] == helpFilename {
-		now := time.Now()
-		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(tagsDirHelp)), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+		modTime := vfs.cache.databaseModTime()
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(tagsDirHelp)), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 	}
 
 	name := path[len(path)-1]
@@ -687,7 +1133,7 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return vfs.getFilesAttr(path)
 	}
 
-	fileId := vfs.parseFileId(name)
+	fileId := vfs.entryFileId(filepath.Join(tagsDir, filepath.Join(path...)))
 	if fileId != 0 {
 		return vfs.getFileEntryAttr(fileId)
 	}
@@ -700,22 +1146,30 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		}
 	}
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
 	}
 	defer tx.Commit()
 
 	tagIds, err := vfs.tagNamesToIds(tx, tagNames)
 	if err != nil {
-		log.Fatalf("could not lookup tag IDs: %v.", err)
+		return nil, vfs.fail(err, "could not lookup tag IDs")
 	}
 	if tagIds == nil {
 		return nil, fuse.ENOENT
 	}
 
-	now := time.Now()
-	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+	visible, status := vfs.expressionVisible(tx, pathToExpression(path))
+	if status != fuse.OK {
+		return nil, status
+	}
+	if !visible {
+		return nil, fuse.ENOENT
+	}
+
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
@@ -723,64 +1177,56 @@ func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 	defer log.Infof(2, "END getQueryEntryAttr(%v)", path)
 
 	if len(path) == 1 && path[0] == helpFilename {
-		now := time.Now()
-		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(queryDirHelp)), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+		modTime := vfs.cache.databaseModTime()
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(queryDirHelp)), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 	}
 
-	name := path[len(path)-1]
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
 
 	if len(path) > 1 {
-		fileId := vfs.parseFileId(name)
+		fileId, status := vfs.queryLinkFileId(tx, path[len(path)-1])
+		if status != fuse.OK {
+			return nil, status
+		}
 		if fileId != 0 {
-			return vfs.getFileEntryAttr(fileId)
+			return vfs.fileEntryAttr(tx, fileId)
 		}
-
-		return nil, fuse.ENOENT
 	}
 
-	queryText := path[0]
-
-	if queryText[len(queryText)-1] == ' ' {
-		// prevent multiple entries for same query when typing path in a GUI
+	expression, valid := queryPathExpression(path)
+	if !valid {
 		return nil, fuse.ENOENT
 	}
 
-	expression, err := query.Parse(queryText)
-	if err != nil {
+	exists, status := vfs.queryTagsExist(tx, expression)
+	if status != fuse.OK {
+		return nil, status
+	}
+	if !exists {
 		return nil, fuse.ENOENT
 	}
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
-	}
-	defer tx.Commit()
+	if len(path) == 1 {
+		queryText := path[0]
 
-	tagNames, err := query.TagNames(expression)
-	if err != nil {
-		log.Fatalf("could not identify tag names: %v", err)
-	}
-
-	tags, err := vfs.store.TagsByNames(tx, tagNames)
-	for _, tagName := range tagNames {
-		if !containsTag(tags, tagName) {
-			return nil, fuse.ENOENT
-		}
-	}
-
-	q, err := vfs.store.Query(tx, queryText)
-	if err != nil {
-		log.Fatalf("could not retrieve query '%v': %v", queryText, err)
-	}
-	if q == nil {
-		_, err = vfs.store.AddQuery(tx, queryText)
+		q, err := vfs.store.Query(tx, queryText)
 		if err != nil {
-			log.Fatalf("could not add query '%v': %v", queryText, err)
+			return nil, vfs.fail(err, "could not retrieve query '%v'", queryText)
+		}
+		if q == nil && !vfs.readOnly && !vfs.restricted() {
+			_, err = vfs.store.AddQuery(tx, queryText)
+			if err != nil {
+				return nil, vfs.fail(err, "could not add query '%v'", queryText)
+			}
 		}
 	}
 
-	now := time.Now()
-	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 }
 
 func (vfs FuseVfs) getDatabaseFileAttr() (*fuse.Attr, fuse.Status) {
@@ -788,7 +1234,7 @@ func (vfs FuseVfs) getDatabaseFileAttr() (*fuse.Attr, fuse.Status) {
 
 	fileInfo, err := os.Stat(databasePath)
 	if err != nil {
-		log.Fatalf("could not stat database: %v", err)
+		return nil, vfs.fail(err, "could not stat database")
 	}
 
 	modTime := fileInfo.ModTime()
@@ -797,15 +1243,19 @@ func (vfs FuseVfs) getDatabaseFileAttr() (*fuse.Attr, fuse.Status) {
 }
 
 func (vfs FuseVfs) getFileEntryAttr(fileId entities.FileId) (*fuse.Attr, fuse.Status) {
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
 	}
 	defer tx.Commit()
 
-	file, err := vfs.store.File(tx, fileId)
+	return vfs.fileEntryAttr(tx, fileId)
+}
+
+func (vfs FuseVfs) fileEntryAttr(tx *storage.Tx, fileId entities.FileId) (*fuse.Attr, fuse.Status) {
+	file, err := vfs.visibleFile(tx, fileId)
 	if err != nil {
-		log.Fatalf("could not retrieve file #%v: %v", fileId, err)
+		return nil, vfs.fail(err, "could not retrieve file #%v", fileId)
 	}
 	if file == nil {
 		return &fuse.Attr{Mode: fuse.S_IFREG}, fuse.ENOENT
@@ -835,25 +1285,25 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 		return vfs.openTaggedEntryFilesDir(tx, path[:len(path)-1])
 	}
 
-	expression := pathToExpression(path)
+	expression := vfs.restrict(pathToExpression(path))
 	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
 	if err != nil {
-		log.Fatalf("could not query files: %v", err)
+		return nil, vfs.fail(err, "could not query files")
 	}
 
 	var valueNames []string
 	if lastPathElement[0] != '=' {
-		expression := pathToExpression(path[:len(path)-1])
+		expression := vfs.restrict(pathToExpression(path[:len(path)-1]))
 		files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
 		if err != nil {
-			log.Fatalf("could not query files: %v", err)
+			return nil, vfs.fail(err, "could not query files")
 		}
 
 		tagName := unescape(lastPathElement)
 
 		valueNames, err = vfs.tagValueNamesForFiles(tx, tagName, files)
 		if err != nil {
-			log.Fatalf("could not retrieve values for '%v': %v", tagName, err)
+			return nil, vfs.fail(err, "could not retrieve values for '%v'", tagName)
 		}
 	} else {
 		valueNames = []string{}
@@ -861,27 +1311,27 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 
 	furtherTagNames, err := vfs.tagNamesForFiles(tx, files)
 	if err != nil {
-		log.Fatalf("could not retrieve further tags: %v", err)
+		return nil, vfs.fail(err, "could not retrieve further tags")
 	}
 
 	entries := make([]fuse.DirEntry, 0, len(files)+len(furtherTagNames))
 	for _, tagName := range furtherTagNames {
-		tagName = escape(tagName)
+		dirName := escape(tagName)
 
-		if tagName == filesDir {
+		if dirName == filesDir {
 			continue
 		}
 
 		hasValues, err := vfs.tagHasValues(tx, tagName)
 		if err != nil {
-			log.Fatalf("could not determine whether tag has values: %v", err)
+			return nil, vfs.fail(err, "could not determine whether tag has values")
 		}
 
-		if !hasValues && containsString(path, tagName) {
+		if !hasValues && containsString(path, dirName) {
 			continue
 		}
 
-		entries = append(entries, fuse.DirEntry{Name: tagName, Mode: fuse.S_IFDIR | 0755})
+		entries = append(entries, fuse.DirEntry{Name: dirName, Mode: fuse.S_IFDIR | 0755})
 	}
 
 	for _, valueName := range valueNames {
@@ -890,6 +1340,7 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 	}
 
 	entries = append(entries, fuse.DirEntry{Name: filesDir, Mode: fuse.S_IFDIR | 0755})
+	entries = append(entries, fuse.DirEntry{Name: treeDir, Mode: fuse.S_IFDIR | 0755})
 
 	return entries, fuse.OK
 }
@@ -898,17 +1349,18 @@ func (vfs FuseVfs) openTaggedEntryFilesDir(tx *storage.Tx, path []string) ([]fus
 	log.Infof(2, "BEGIN openTaggedEntryFilesDir(%v)", path)
 	defer log.Infof(2, "END openTaggedEntryFilesDir(%v)", path)
 
-	expression := pathToExpression(path)
+	expression := vfs.restrict(pathToExpression(path))
 	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
 	if err != nil {
-		log.Fatalf("could not query files: %v", err)
+		return nil, vfs.fail(err, "could not query files")
 	}
 
-	entries := make([]fuse.DirEntry, 0, len(files))
+	entries := make([]fuse.DirEntry, 0, len(files)*2)
 
 	for _, file := range files {
 		linkName := vfs.getLinkName(file)
 		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+		entries = append(entries, fuse.DirEntry{Name: tagsFileName(linkName), Mode: fuse.S_IFREG})
 	}
 
 	return entries, fuse.OK
@@ -918,37 +1370,93 @@ func (vfs FuseVfs) openQueryEntryDir(tx *storage.Tx, path []string) ([]fuse.DirE
 	log.Infof(2, "BEGIN openQueryEntryDir(%v)", path)
 	defer log.Infof(2, "END openQueryEntryDir(%v)", path)
 
-	queryText := path[0]
+	expression, valid := queryPathExpression(path)
+	if !valid {
+		return nil, fuse.ENOENT
+	}
 
-	expression, err := query.Parse(queryText)
+	exists, status := vfs.queryTagsExist(tx, expression)
+	if status != fuse.OK {
+		return nil, status
+	}
+	if !exists {
+		return nil, fuse.ENOENT
+	}
+
+	files, err := vfs.store.FilesForQuery(tx, vfs.restrict(expression), "", false, false, "name")
 	if err != nil {
-		log.Fatalf("could not parse query: %v", err)
+		return nil, vfs.fail(err, "could not query files")
 	}
 
+	queryTagNames, err := query.TagNames(expression)
+	if err != nil {
+		return nil, vfs.fail(err, "could not identify tag names")
+	}
+
+	furtherTagNames, err := vfs.tagNamesForFiles(tx, files)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve further tags")
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(furtherTagNames)+len(files)*2)
+	for _, tagName := range furtherTagNames {
+		if containsString(queryTagNames, tagName) {
+			continue
+		}
+
+		if dirName, valid := queryTagDirName(tagName); valid {
+			entries = append(entries, fuse.DirEntry{Name: dirName, Mode: fuse.S_IFDIR | 0755})
+		}
+	}
+
+	for _, file := range files {
+		linkName := vfs.getLinkName(file)
+		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+		entries = append(entries, fuse.DirEntry{Name: tagsFileName(linkName), Mode: fuse.S_IFREG})
+	}
+
+	return entries, fuse.OK
+}
+
+// Determines whether the tags named in the query exist and are visible.
+func (vfs FuseVfs) queryTagsExist(tx *storage.Tx, expression query.Expression) (bool, fuse.Status) {
 	tagNames, err := query.TagNames(expression)
 	if err != nil {
-		log.Fatalf("could not identify tag names: %v", err)
+		return false, vfs.fail(err, "could not identify tag names")
 	}
 
 	tags, err := vfs.store.TagsByNames(tx, tagNames)
+	if err != nil {
+		return false, vfs.fail(err, "could not retrieve tags")
+	}
 	for _, tagName := range tagNames {
 		if !containsTag(tags, tagName) {
-			return nil, fuse.ENOENT
+			return false, fuse.OK
 		}
 	}
 
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
-	if err != nil {
-		log.Fatalf("could not query files: %v", err)
+	return vfs.tagsVisible(tx, tagNames)
+}
+
+// Identifies the file whose symbolic link has the specified name within a query
+// directory, returning zero if the name is not that of a file symbolic link.
+// (The link name is checked in full as the text of a nested query directory,
+// such as 'rating > 2.5', may otherwise be mistaken for a file link.)
+func (vfs FuseVfs) queryLinkFileId(tx *storage.Tx, name string) (entities.FileId, fuse.Status) {
+	fileId := vfs.parseFileId(name)
+	if fileId == 0 {
+		return 0, fuse.OK
 	}
 
-	entries := make([]fuse.DirEntry, 0, len(files))
-	for _, file := range files {
-		linkName := vfs.getLinkName(file)
-		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+	file, err := vfs.visibleFile(tx, fileId)
+	if err != nil {
+		return 0, vfs.fail(err, "could not retrieve file '%v'", fileId)
+	}
+	if file == nil || vfs.getLinkName(file) != name {
+		return 0, fuse.OK
 	}
 
-	return entries, fuse.OK
+	return fileId, fuse.OK
 }
 
 func (vfs FuseVfs) readDatabaseFileLink() (string, fuse.Status) {
@@ -962,27 +1470,63 @@ func (vfs FuseVfs) readTaggedEntryLink(tx *storage.Tx, path []string) (string, f
 	log.Infof(2, "BEGIN readTaggedEntryLink(%v)", path)
 	defer log.Infof(2, "END readTaggedEntryLink(%v)", path)
 
-	name := path[len(path)-1]
-
-	fileId := vfs.parseFileId(name)
+	fileId := vfs.entryFileId(filepath.Join(path...))
 	if fileId == 0 {
 		return "", fuse.ENOENT
 	}
 
-	file, err := vfs.store.File(tx, fileId)
+	file, err := vfs.visibleFile(tx, fileId)
 	if err != nil {
-		log.Fatalf("could not find file %v in database.", fileId)
+		return "", vfs.fail(err, "could not find file %v in database", fileId)
+	}
+	if file == nil {
+		return "", fuse.ENOENT
 	}
 
 	absDirPath := filepath.Join(vfs.mountPath, filepath.Join(path[:len(path)-1]...))
 	relPath, err := filepath.Rel(absDirPath, file.Path())
 	if err != nil {
-		log.Fatalf("could not make relative path: %v", err)
+		return "", vfs.fail(err, "could not make relative path")
 	}
 
 	return relPath, fuse.OK
 }
 
+// Identifies the absolute path of the file linked to by the symbolic link at the
+// specified path.
+func (vfs FuseVfs) linkTarget(name string) (string, fuse.Status) {
+	if name == databaseFilename {
+		return vfs.store.DbPath, fuse.OK
+	}
+
+	path := vfs.splitPath(name)
+	if index := treeIndex(path); index != -1 {
+		_, treePath := splitTreePath(path, index)
+		return string(filepath.Separator) + filepath.Join(treePath...), fuse.OK
+	}
+
+	fileId := vfs.entryFileId(name)
+	if fileId == 0 {
+		return "", fuse.ENOENT
+	}
+
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return "", status
+	}
+	defer tx.Commit()
+
+	file, err := vfs.visibleFile(tx, fileId)
+	if err != nil {
+		return "", vfs.fail(err, "could not retrieve file '%v'", fileId)
+	}
+	if file == nil {
+		return "", fuse.ENOENT
+	}
+
+	return file.Path(), fuse.OK
+}
+
 func (vfs FuseVfs) getLinkName(file *entities.File) string {
 	extension := filepath.Ext(file.Path())
 	fileName := filepath.Base(file.Path())
@@ -1017,7 +1561,7 @@ func (vfs FuseVfs) tagNamesToIds(tx *storage.Tx, tagNames []string) (entities.Ta
 func (vfs FuseVfs) tagValueNamesForFiles(tx *storage.Tx, tagName string, files entities.Files) ([]string, error) {
 	tag, err := vfs.store.TagByName(tx, tagName)
 	if err != nil {
-		log.Fatalf("could not look up tag '%v': %v", tagName, err)
+		return nil, fmt.Errorf("could not look up tag '%v': %v", tagName, err)
 	}
 	if tag == nil {
 		return []string{}, nil
@@ -1096,6 +1640,17 @@ func (vfs FuseVfs) tagHasValues(tx *storage.Tx, tagName string) (bool, error) {
 	return len(values) > 0, nil
 }
 
+// Identifies the tag directory path containing the file symbolic link at the
+// specified path, which may be within the tag directory's 'files' directory.
+func linkDirPath(path []string) []string {
+	dirPath := path[1 : len(path)-1]
+	if len(dirPath) > 0 && dirPath[len(dirPath)-1] == filesDir {
+		dirPath = dirPath[:len(dirPath)-1]
+	}
+
+	return dirPath
+}
+
 func pathToExpression(path []string) query.Expression {
 	var expression query.Expression = query.EmptyExpression{}
 
@@ -1122,6 +1677,50 @@ func pathToExpression(path []string) query.Expression {
 	return expression
 }
 
+// Builds the expression for a query directory path: each nested query directory
+// refines the query of its parent.
+func queryPathExpression(path []string) (query.Expression, bool) {
+	var expression query.Expression
+
+	for index, queryText := range path {
+		if queryText == "" || queryText[len(queryText)-1] == ' ' {
+			// prevent multiple entries for same query when typing path in a GUI
+			return nil, false
+		}
+
+		elementExpression, err := query.Parse(queryText)
+		if err != nil {
+			return nil, false
+		}
+
+		if index == 0 {
+			expression = elementExpression
+		} else {
+			expression = query.AndExpression{expression, elementExpression}
+		}
+	}
+
+	return expression, true
+}
+
+// Formats the tag name as the text of a query directory, identifying whether the
+// tag can be named by one: names that read as an operator, for example, cannot.
+func queryTagDirName(tagName string) (string, bool) {
+	if strings.ContainsRune(tagName, filepath.Separator) {
+		return "", false
+	}
+
+	queryText := escapeName(tagName, ' ', '(', ')', '=', '!', '<', '>')
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return "", false
+	}
+
+	tagExpression, isTag := expression.(query.TagExpression)
+	return queryText, isTag && tagExpression.Name == tagName
+}
+
 func fileIdToAscii(fileId entities.FileId) string {
 	return strconv.FormatUint(uint64(fileId), 10)
 }
@@ -1154,10 +1753,20 @@ func containsString(values []string, value string) bool {
 func escape(name string) string {
 	name = strings.Replace(name, `/`, "\u200B\u2215", -1)
 	name = strings.Replace(name, `\`, "\u200B\u2216", -1)
+
+	// names starting with '.' are reserved for the directories of the VFS itself
+	if strings.HasPrefix(name, ".") {
+		name = "\u200B" + name
+	}
+
 	return name
 }
 
 func unescape(name string) string {
+	if strings.HasPrefix(name, "\u200B.") {
+		name = name[len("\u200B"):]
+	}
+
 	name = strings.Replace(name, "\u200B\u2215", `/`, -1)
 	name = strings.Replace(name, "\u200B\u2216", `\`, -1)
 	return name
@@ -0,0 +1,131 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+)
+
+// Whether the mount is restricted to the files matching a query.
+func (vfs FuseVfs) restricted() bool {
+	return vfs.where != nil
+}
+
+// Restricts the expression to the files the mount is restricted to.
+func (vfs FuseVfs) restrict(expression query.Expression) query.Expression {
+	if vfs.where == nil {
+		return expression
+	}
+
+	return query.AndExpression{vfs.where, expression}
+}
+
+// Retrieves the file if it is visible in the mount, or nil if it does not
+// exist or is hidden.
+func (vfs FuseVfs) visibleFile(tx *storage.Tx, fileId entities.FileId) (*entities.File, error) {
+	file, err := vfs.store.File(tx, fileId)
+	if err != nil || file == nil || vfs.where == nil {
+		return file, err
+	}
+
+	visible, err := vfs.store.FileMatchesQuery(tx, fileId, vfs.where, false, false)
+	if err != nil || !visible {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Retrieves the files visible in the mount.
+func (vfs FuseVfs) visibleFiles(tx *storage.Tx) (entities.Files, fuse.Status) {
+	files, err := vfs.store.FilesForQuery(tx, vfs.restrict(query.EmptyExpression{}), "", false, false, "name")
+	if err != nil {
+		return nil, vfs.fail(err, "could not query files")
+	}
+
+	return files, fuse.OK
+}
+
+// Determines whether any visible file matches the expression: a restricted
+// mount hides the tags and values of the files outside the restriction.
+func (vfs FuseVfs) expressionVisible(tx *storage.Tx, expression query.Expression) (bool, fuse.Status) {
+	if vfs.where == nil {
+		return true, fuse.OK
+	}
+
+	count, err := vfs.store.FileCountForQuery(tx, vfs.restrict(expression), "", false, false)
+	if err != nil {
+		return false, vfs.fail(err, "could not query files")
+	}
+
+	return count > 0, fuse.OK
+}
+
+// Determines whether all of the tags are visible in the mount.
+func (vfs FuseVfs) tagsVisible(tx *storage.Tx, tagNames []string) (bool, fuse.Status) {
+	for _, tagName := range tagNames {
+		visible, status := vfs.expressionVisible(tx, query.TagExpression{tagName})
+		if status != fuse.OK || !visible {
+			return false, status
+		}
+	}
+
+	return true, fuse.OK
+}
+
+// Identifies the files visible in the mount, or nil if it is unrestricted.
+func (vfs FuseVfs) visibleFileIds(tx *storage.Tx) (map[entities.FileId]bool, fuse.Status) {
+	if vfs.where == nil {
+		return nil, fuse.OK
+	}
+
+	files, status := vfs.visibleFiles(tx)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	fileIds := make(map[entities.FileId]bool)
+	for _, file := range files {
+		fileIds[file.Id] = true
+	}
+
+	return fileIds, fuse.OK
+}
+
+// Identifies the values applied to the files visible in the mount, or nil if
+// it is unrestricted.
+func (vfs FuseVfs) visibleValueIds(tx *storage.Tx) (map[entities.ValueId]bool, fuse.Status) {
+	if vfs.where == nil {
+		return nil, fuse.OK
+	}
+
+	fileTags, err := vfs.store.FileTagsForQuery(tx, vfs.where, false, false)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve file-tags")
+	}
+
+	valueIds := make(map[entities.ValueId]bool)
+	for _, valueId := range fileTags.ValueIds() {
+		valueIds[valueId] = true
+	}
+
+	return valueIds, fuse.OK
+}
@@ -0,0 +1,153 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRestrictedMount(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	addFile(test, store, filepath.Join(dir, "public.txt"), "public", "year=2018")
+	addFile(test, store, filepath.Join(dir, "private.txt"), "private", "year=2017")
+	addImplication(test, store, "public", "shared")
+
+	where, err := query.Parse("public")
+	if err != nil {
+		test.Fatal(err)
+	}
+	vfs := newFuseVfs(store, "/mnt", false, where)
+
+	if _, status := vfs.GetAttr("tags/year/files/public.1.txt", nil); status != fuse.OK {
+		test.Fatalf("Expected the matching file to be visible but status was %v.", status)
+	}
+	if _, status := vfs.GetAttr("tags/year/files/private.2.txt", nil); status != fuse.ENOENT {
+		test.Fatalf("Expected %v but status was %v.", fuse.ENOENT, status)
+	}
+	if _, status := vfs.Readlink("tags/year/files/private.2.txt", nil); status != fuse.ENOENT {
+		test.Fatalf("Expected %v but status was %v.", fuse.ENOENT, status)
+	}
+	if _, status := vfs.Open("tags/year/files/.private.2.txt.tags", syscall.O_RDONLY, nil); status != fuse.ENOENT {
+		test.Fatalf("Expected %v but status was %v.", fuse.ENOENT, status)
+	}
+	if status := vfs.Rename("tags/year/files/private.2.txt", "tags/public/files/private.2.txt", nil); status != fuse.ENOENT {
+		test.Fatalf("Expected %v but status was %v.", fuse.ENOENT, status)
+	}
+
+	assertEntries(test, vfs, "tags", []string{"public/", "shared/", "year/"})
+	assertEntries(test, vfs, "tags/year/files", []string{".public.1.txt.tags", "public.1.txt"})
+	assertEntries(test, vfs, "values", []string{"2018/"})
+
+	handle, status := vfs.Open(statsFilename, syscall.O_RDONLY, nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	buffer := make([]byte, 1024)
+	result, status := handle.Read(buffer, 0)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	data, _ := result.Bytes(buffer)
+
+	expected := `Tags: 3
+Values: 1
+Files: 1
+Taggings: 3
+Mean tags per file: 3.00
+Mean files per tag: 1.00
+`
+	if string(data) != expected {
+		test.Fatalf("Expected statistics:\n%v\nbut were:\n%v", expected, string(data))
+	}
+}
+
+func TestReadOnlyMount(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday")
+	vfs := newFuseVfs(store, "/mnt", true, nil)
+
+	linkPath := "tags/holiday/files/photo.1.jpg"
+	tagsFilePath := "tags/holiday/files/.photo.1.jpg.tags"
+
+	if status := vfs.Mkdir("tags/beach", 0755, nil); status != fuse.EROFS {
+		test.Fatalf("Mkdir: expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if status := vfs.Symlink(filepath.Join(dir, "photo.jpg"), "tags/holiday/other.jpg", nil); status != fuse.EROFS {
+		test.Fatalf("Symlink: expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if status := vfs.Rename(linkPath, "tags/beach/photo.1.jpg", nil); status != fuse.EROFS {
+		test.Fatalf("Rename: expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if status := vfs.Unlink(linkPath, nil); status != fuse.EROFS {
+		test.Fatalf("Unlink: expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if status := vfs.Rmdir("tags/holiday", nil); status != fuse.EROFS {
+		test.Fatalf("Rmdir: expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if status := vfs.Truncate(tagsFilePath, 0, nil); status != fuse.EROFS {
+		test.Fatalf("Truncate: expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if _, status := vfs.Open(tagsFilePath, syscall.O_WRONLY, nil); status != fuse.EROFS {
+		test.Fatalf("Open: expected %v but status was %v.", fuse.EROFS, status)
+	}
+
+	if _, status := vfs.Readlink(linkPath, nil); status != fuse.OK {
+		test.Fatalf("Readlink: expected the link to be readable but status was %v.", status)
+	}
+	if tags := fileTags(test, store, file.Id); len(tags) != 1 || tags[0] != "holiday" {
+		test.Fatalf("Expected tags [holiday] but were %v.", tags)
+	}
+}
+
+// unexported
+
+func addImplication(test *testing.T, store *storage.Storage, tag, impliedTag string) {
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	vfs := newFuseVfs(store, "", false, nil)
+
+	pair, status := vfs.lookupTagValue(tx, parseTagValueName(tag))
+	if status != fuse.OK {
+		test.Fatalf("could not create tag '%v': %v", tag, status)
+	}
+
+	impliedPair, status := vfs.lookupTagValue(tx, parseTagValueName(impliedTag))
+	if status != fuse.OK {
+		test.Fatalf("could not create tag '%v': %v", impliedTag, status)
+	}
+
+	if err := store.AddImplication(tx, pair, impliedPair); err != nil {
+		test.Fatal(err)
+	}
+}
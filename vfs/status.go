@@ -0,0 +1,212 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const statsFilename = ".stats"
+const missingFilename = ".missing"
+
+// The block size reported for the virtual filesystem.
+const blockSize = 4096
+
+// Generates the content of the read-only status file with the specified name
+// in the root of the mount. The content is generated afresh on each access so
+// that the status files always reflect the current state of the database.
+func (vfs FuseVfs) statusFileData(name string) ([]byte, fuse.Status, bool) {
+	switch name {
+	case errorsFilename:
+		return vfs.errors.text(), fuse.OK, true
+	case statsFilename:
+		data, status := vfs.readStatsFile()
+		return data, status, true
+	case missingFilename:
+		data, status := vfs.readMissingFile()
+		return data, status, true
+	}
+
+	return nil, fuse.ENOENT, false
+}
+
+func (vfs FuseVfs) getStatusFileAttr(data []byte) *fuse.Attr {
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(data)), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}
+}
+
+type statistics struct {
+	tagCount     uint
+	valueCount   uint
+	fileCount    uint
+	fileTagCount uint
+}
+
+// Counts the tags, values, files and taggings visible in the mount.
+func (vfs FuseVfs) statistics(tx *storage.Tx) (statistics, fuse.Status) {
+	if vfs.restricted() {
+		return vfs.restrictedStatistics(tx)
+	}
+
+	var stats statistics
+	var err error
+
+	if stats.tagCount, err = vfs.store.TagCount(tx); err != nil {
+		return stats, vfs.fail(err, "could not retrieve tag count")
+	}
+
+	if stats.valueCount, err = vfs.store.ValueCount(tx); err != nil {
+		return stats, vfs.fail(err, "could not retrieve value count")
+	}
+
+	if stats.fileCount, err = vfs.store.FileCount(tx); err != nil {
+		return stats, vfs.fail(err, "could not retrieve file count")
+	}
+
+	if stats.fileTagCount, err = vfs.store.FileTagCount(tx); err != nil {
+		return stats, vfs.fail(err, "could not retrieve taggings count")
+	}
+
+	return stats, fuse.OK
+}
+
+func (vfs FuseVfs) restrictedStatistics(tx *storage.Tx) (statistics, fuse.Status) {
+	var stats statistics
+	var err error
+
+	if stats.fileCount, err = vfs.store.FileCountForQuery(tx, vfs.where, "", false, false); err != nil {
+		return stats, vfs.fail(err, "could not query files")
+	}
+
+	fileTags, err := vfs.store.FileTagsForQuery(tx, vfs.where, false, false)
+	if err != nil {
+		return stats, vfs.fail(err, "could not retrieve file-tags")
+	}
+
+	tagIds := make(map[entities.TagId]bool)
+	valueIds := make(map[entities.ValueId]bool)
+
+	for _, fileTag := range fileTags {
+		tagIds[fileTag.TagId] = true
+		if fileTag.ValueId != 0 {
+			valueIds[fileTag.ValueId] = true
+		}
+	}
+
+	stats.tagCount = uint(len(tagIds))
+	stats.valueCount = uint(len(valueIds))
+	stats.fileTagCount = uint(len(fileTags))
+
+	return stats, fuse.OK
+}
+
+// Formats the statistics as shown by 'tmsu info --stats'.
+func (vfs FuseVfs) readStatsFile() ([]byte, fuse.Status) {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	stats, status := vfs.statistics(tx)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	var averageTagsPerFile float32
+	if stats.fileCount > 0 {
+		averageTagsPerFile = float32(stats.fileTagCount) / float32(stats.fileCount)
+	}
+
+	var averageFilesPerTag float32
+	if stats.tagCount > 0 {
+		averageFilesPerTag = float32(stats.fileTagCount) / float32(stats.tagCount)
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "Tags: %v\n", stats.tagCount)
+	fmt.Fprintf(buffer, "Values: %v\n", stats.valueCount)
+	fmt.Fprintf(buffer, "Files: %v\n", stats.fileCount)
+	fmt.Fprintf(buffer, "Taggings: %v\n", stats.fileTagCount)
+	fmt.Fprintf(buffer, "Mean tags per file: %1.2f\n", averageTagsPerFile)
+	fmt.Fprintf(buffer, "Mean files per tag: %1.2f\n", averageFilesPerTag)
+
+	return buffer.Bytes(), fuse.OK
+}
+
+// Lists the paths of the tagged files that no longer exist on disk.
+func (vfs FuseVfs) readMissingFile() ([]byte, fuse.Status) {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	files, status := vfs.visibleFiles(tx)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	buffer := new(bytes.Buffer)
+	for _, file := range files {
+		if _, err := os.Lstat(file.Path()); os.IsNotExist(err) {
+			buffer.WriteString(file.Path())
+			buffer.WriteByte('\n')
+		}
+	}
+
+	return buffer.Bytes(), fuse.OK
+}
+
+// Reports the space on the filesystem holding the database, into which the
+// database can grow, and the number of tagged files as the inodes used.
+func (vfs FuseVfs) statFs() (*fuse.StatfsOut, fuse.Status) {
+	out := &fuse.StatfsOut{Bsize: blockSize, Frsize: blockSize, NameLen: 255}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(vfs.store.DbPath), &stat); err != nil {
+		return nil, vfs.fail(err, "could not determine free space for database")
+	}
+
+	out.Blocks = stat.Blocks * uint64(stat.Bsize) / blockSize
+	out.Bfree = stat.Bfree * uint64(stat.Bsize) / blockSize
+	out.Bavail = stat.Bavail * uint64(stat.Bsize) / blockSize
+
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	stats, status := vfs.statistics(tx)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	out.Files = uint64(stats.fileCount)
+	out.Ffree = 0
+
+	return out, fuse.OK
+}
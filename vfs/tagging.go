@@ -0,0 +1,395 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bytes"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The names of a tag and (possibly empty) value applied to a file.
+type tagValueName struct {
+	tagName   string
+	valueName string
+}
+
+// Formats the tags as they are shown by 'tmsu tags', separated by spaces.
+func formatTagValueNames(names []tagValueName) string {
+	formatted := make([]string, len(names))
+
+	for index, name := range names {
+		formatted[index] = escapeName(name.tagName, '=', ' ')
+
+		if name.valueName != "" {
+			formatted[index] += "=" + escapeName(name.valueName, '=', ' ')
+		}
+	}
+
+	return strings.Join(formatted, " ")
+}
+
+// Parses the tags formatted by formatTagValueNames (or as typed on the command-line).
+func parseTagValueNames(tags string) []tagValueName {
+	words := text.Tokenize(tags)
+	names := make([]tagValueName, 0, len(words))
+
+	for _, word := range words {
+		names = append(names, parseTagValueName(word))
+	}
+
+	return names
+}
+
+func parseTagValueName(word string) tagValueName {
+	tagNameBuffer := new(bytes.Buffer)
+	valueNameBuffer := new(bytes.Buffer)
+	var buffer = tagNameBuffer
+	var escaped bool
+
+	for _, r := range word {
+		switch {
+		case escaped:
+			buffer.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '=' && buffer == tagNameBuffer:
+			buffer = valueNameBuffer
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+
+	return tagValueName{tagNameBuffer.String(), valueNameBuffer.String()}
+}
+
+// Identifies the tags (and values) of a tag directory path: each tag
+// directory may be followed by a directory for one of its values.
+func pathTagValueNames(path []string) []tagValueName {
+	names := make([]tagValueName, 0, len(path))
+
+	for _, element := range path {
+		if element[0] == '=' && len(names) > 0 {
+			names[len(names)-1].valueName = unescape(element[1:])
+		} else {
+			names = append(names, tagValueName{unescape(element), ""})
+		}
+	}
+
+	return names
+}
+
+func escapeName(name string, chars ...rune) string {
+	name = strings.Replace(name, `\`, `\\`, -1)
+
+	for _, char := range chars {
+		name = strings.Replace(name, string(char), `\`+string(char), -1)
+	}
+
+	return name
+}
+
+// Retrieves the names of the tags explicitly applied to the file, ordered by
+// tag and then value name.
+func (vfs FuseVfs) explicitTagValueNames(tx *storage.Tx, fileId entities.FileId) ([]tagValueName, fuse.Status) {
+	fileTags, err := vfs.store.FileTagsByFileId(tx, fileId, true)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve file-tags for file '%v'", fileId)
+	}
+
+	names := make([]tagValueName, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tag, err := vfs.store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve tag '%v'", fileTag.TagId)
+		}
+
+		value, err := vfs.store.Value(tx, fileTag.ValueId)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve value '%v'", fileTag.ValueId)
+		}
+
+		valueName := ""
+		if value != nil {
+			valueName = value.Name
+		}
+
+		names = append(names, tagValueName{tag.Name, valueName})
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].tagName != names[j].tagName {
+			return names[i].tagName < names[j].tagName
+		}
+
+		return names[i].valueName < names[j].valueName
+	})
+
+	return names, fuse.OK
+}
+
+// Looks up the tag and value, creating them if the database settings permit.
+// EINVAL is returned if they do not exist and cannot be created.
+func (vfs FuseVfs) lookupTagValue(tx *storage.Tx, name tagValueName) (entities.TagIdValueIdPair, fuse.Status) {
+	settings, err := vfs.store.Settings(tx)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, vfs.fail(err, "could not retrieve settings")
+	}
+
+	tag, err := vfs.store.TagByName(tx, name.tagName)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, vfs.fail(err, "could not retrieve tag '%v'", name.tagName)
+	}
+	if tag == nil {
+		if !settings.AutoCreateTags() {
+			return entities.TagIdValueIdPair{}, fuse.EINVAL
+		}
+
+		tag, err = vfs.store.AddTag(tx, name.tagName)
+		if err != nil {
+			log.Infof(2, "could not create tag '%v': %v", name.tagName, err)
+			return entities.TagIdValueIdPair{}, fuse.EINVAL
+		}
+	}
+
+	value, err := vfs.store.ValueByName(tx, name.valueName)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, vfs.fail(err, "could not retrieve value '%v'", name.valueName)
+	}
+	if value == nil {
+		if !settings.AutoCreateValues() {
+			return entities.TagIdValueIdPair{}, fuse.EINVAL
+		}
+
+		value, err = vfs.store.AddValue(tx, name.valueName)
+		if err != nil {
+			log.Infof(2, "could not create value '%v': %v", name.valueName, err)
+			return entities.TagIdValueIdPair{}, fuse.EINVAL
+		}
+	}
+
+	return entities.TagIdValueIdPair{tag.Id, value.Id}, fuse.OK
+}
+
+// Applies the tags to the file, then removes those specified. The file is
+// removed from the database if it is left untagged.
+func (vfs FuseVfs) retagFile(tx *storage.Tx, fileId entities.FileId, add, remove entities.TagIdValueIdPairs) fuse.Status {
+	for _, pair := range add {
+		if _, err := vfs.store.AddFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+			return vfs.fail(err, "could not tag file '%v'", fileId)
+		}
+	}
+
+	for _, pair := range remove {
+		if err := vfs.store.DeleteFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+			return vfs.fail(err, "could not untag file '%v'", fileId)
+		}
+	}
+
+	return fuse.OK
+}
+
+// Identifies the file a new symbolic link points to, adding it to the database
+// if necessary. Targets within the virtual filesystem must be file symbolic
+// links, in which case the file they link to is used.
+func (vfs FuseVfs) linkTargetFileId(tx *storage.Tx, path string) (entities.FileId, fuse.Status) {
+	if relPath, err := filepath.Rel(vfs.mountPath, path); err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		fileId := vfs.entryFileId(relPath)
+		if fileId == 0 {
+			return 0, fuse.EINVAL
+		}
+
+		file, err := vfs.visibleFile(tx, fileId)
+		if err != nil {
+			return 0, vfs.fail(err, "could not retrieve file '%v'", fileId)
+		}
+		if file == nil {
+			return 0, fuse.EINVAL
+		}
+
+		return fileId, fuse.OK
+	}
+
+	// a relative path leaving a hierarchy that is not mounted, such as that
+	// served over WebDAV, would otherwise resolve against the working directory
+	if !filepath.IsAbs(path) {
+		return 0, fuse.EACCES
+	}
+
+	stat, err := os.Lstat(path)
+	if err != nil {
+		log.Infof(2, "%v: could not stat link target: %v", path, err)
+		return 0, fuse.ToStatus(err)
+	}
+
+	file, err := vfs.store.FileByPath(tx, path)
+	if err != nil {
+		return 0, vfs.fail(err, "could not retrieve file '%v'", path)
+	}
+	if file != nil {
+		return file.Id, fuse.OK
+	}
+
+	settings, err := vfs.store.Settings(tx)
+	if err != nil {
+		return 0, vfs.fail(err, "could not retrieve settings")
+	}
+
+	cache := vfs.store.NewFingerprintCache(tx, settings.FileFingerprintAlgorithm())
+
+	fp, err := fingerprint.CreateWithCache(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), cache)
+	if err != nil {
+		return 0, vfs.fail(err, "%v: could not create fingerprint", path)
+	}
+
+	file, err = vfs.store.AddFile(tx, path, fp, settings.FileFingerprintAlgorithm(), stat.ModTime(), stat.Size(), stat.IsDir())
+	if err != nil {
+		return 0, vfs.fail(err, "could not add file '%v'", path)
+	}
+
+	if imageAlgorithm := settings.ImageFingerprintAlgorithm(); imageAlgorithm != "none" && imageAlgorithm != "" {
+		if imageFp, err := fingerprint.CreateImage(path, imageAlgorithm); err == nil {
+			if err := vfs.store.UpdateImageFingerprint(tx, file.Id, imageAlgorithm, imageFp); err != nil {
+				return 0, vfs.fail(err, "could not update image fingerprint for '%v'", path)
+			}
+		}
+	}
+
+	return file.Id, fuse.OK
+}
+
+// Retags the file whose symbolic link is being moved from one tag directory to
+// another: the tags of the old directory path that are absent from the new are
+// removed and those only of the new path added. The caller commits the change.
+func (vfs FuseVfs) renameLink(tx *storage.Tx, fileId entities.FileId, oldName, newName string) fuse.Status {
+	newDirPath := linkDirPath(vfs.splitPath(newName))
+	if len(newDirPath) == 0 {
+		return fuse.EPERM
+	}
+
+	oldNames := pathTagValueNames(linkDirPath(vfs.splitPath(oldName)))
+	newNames := pathTagValueNames(newDirPath)
+
+	var add, remove entities.TagIdValueIdPairs
+
+	for _, name := range newNames {
+		if containsTagValueName(oldNames, name) {
+			continue
+		}
+
+		pair, status := vfs.lookupTagValue(tx, name)
+		if status != fuse.OK {
+			return status
+		}
+
+		add = append(add, pair)
+	}
+
+	fileTags, err := vfs.store.FileTagsByFileId(tx, fileId, false)
+	if err != nil {
+		return vfs.fail(err, "could not retrieve tags for file '%v'", fileId)
+	}
+
+	for _, name := range oldNames {
+		if containsTagValueName(newNames, name) {
+			continue
+		}
+
+		pairs, status := vfs.appliedFileTags(tx, fileTags, name)
+		if status != fuse.OK {
+			return status
+		}
+
+		for _, pair := range pairs {
+			if !containsPair(add, pair) {
+				remove = append(remove, pair)
+			}
+		}
+	}
+
+	return vfs.retagFile(tx, fileId, add, remove)
+}
+
+// Identifies the explicit file-tags through which the file appears in the
+// directory for the tag and value: for a directory of a tag without a value
+// these are all of the file's file-tags for the tag, whatever their values.
+// EPERM is returned if the file appears there through an implication, as
+// removing its file-tags would not remove the file from the directory.
+func (vfs FuseVfs) appliedFileTags(tx *storage.Tx, fileTags entities.FileTags, name tagValueName) (entities.TagIdValueIdPairs, fuse.Status) {
+	tag, err := vfs.store.TagByName(tx, name.tagName)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve tag '%v'", name.tagName)
+	}
+	if tag == nil {
+		return nil, fuse.OK
+	}
+
+	var valueId entities.ValueId
+	if name.valueName != "" {
+		value, err := vfs.store.ValueByName(tx, name.valueName)
+		if err != nil {
+			return nil, vfs.fail(err, "could not retrieve value '%v'", name.valueName)
+		}
+		if value == nil {
+			return nil, fuse.OK
+		}
+
+		valueId = value.Id
+	}
+
+	var pairs entities.TagIdValueIdPairs
+	implied := false
+
+	for _, fileTag := range fileTags {
+		if fileTag.TagId != tag.Id || (name.valueName != "" && fileTag.ValueId != valueId) {
+			continue
+		}
+
+		if fileTag.Implicit {
+			implied = true
+		}
+		if fileTag.Explicit {
+			pairs = append(pairs, entities.TagIdValueIdPair{fileTag.TagId, fileTag.ValueId})
+		}
+	}
+
+	if implied {
+		return nil, fuse.EPERM
+	}
+
+	return pairs, fuse.OK
+}
+
+func containsPair(pairs entities.TagIdValueIdPairs, pair entities.TagIdValueIdPair) bool {
+	for _, candidate := range pairs {
+		if candidate == pair {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/entities"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRenameLinkFromValuelessTagDirectory(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "year=2017", "year=2018", "beach")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	if status := vfs.Rename("tags/year/files/photo.1.jpg", "tags/holiday/files/photo.1.jpg", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+
+	if tags, expected := fileTags(test, store, file.Id), []string{"beach", "holiday"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+}
+
+func TestRenameLinkToValueOfSameTag(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "year=2017")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	if status := vfs.Rename("tags/year/files/photo.1.jpg", "tags/year/=2018/files/photo.1.jpg", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+
+	if tags, expected := fileTags(test, store, file.Id), []string{"year=2018"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+}
+
+func TestRenameLinkFromImpliedTagDirectory(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "song.mp3"), "mp3", "music")
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	mp3, _ := store.TagByName(tx, "mp3")
+	music, _ := store.TagByName(tx, "music")
+	if err := store.AddImplication(tx, entities.TagIdValueIdPair{mp3.Id, 0}, entities.TagIdValueIdPair{music.Id, 0}); err != nil {
+		test.Fatal(err)
+	}
+	tx.Commit()
+
+	vfs := newFuseVfs(store, "", false, nil)
+
+	if status := vfs.Rename("tags/music/files/song.1.mp3", "tags/jazz/files/song.1.mp3", nil); status != fuse.EPERM {
+		test.Fatalf("Expected %v but status was %v.", fuse.EPERM, status)
+	}
+
+	if tags, expected := fileTags(test, store, file.Id), []string{"mp3", "music"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+}
+
+func TestSymlinkRelativeTargetOutsideHierarchy(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	// resolves to this package's own source from the working directory
+	if status := vfs.Symlink("../../../vfs/tagging_test.go", "tags/holiday/tagging_test.go", nil); status != fuse.EACCES {
+		test.Fatalf("Expected status %v but was %v.", fuse.EACCES, status)
+	}
+}
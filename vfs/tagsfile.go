@@ -0,0 +1,422 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bytes"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strings"
+	"sync"
+)
+
+const tagsFilePrefix = "."
+const tagsFileSuffix = ".tags"
+
+// Identifies the file whose companion tags file is at the specified path,
+// returning zero if the path is not that of a tags file.
+func (vfs FuseVfs) tagsFileId(path []string) entities.FileId {
+	name := path[len(path)-1]
+	if !strings.HasPrefix(name, tagsFilePrefix) || !strings.HasSuffix(name, tagsFileSuffix) || len(name) <= len(tagsFilePrefix)+len(tagsFileSuffix) {
+		return 0
+	}
+
+	if !tagsFileDir(path) {
+		return 0
+	}
+
+	return vfs.parseFileId(name[len(tagsFilePrefix) : len(name)-len(tagsFileSuffix)])
+}
+
+// Determines whether the entry at the specified path is in a directory that
+// lists tags files.
+func tagsFileDir(path []string) bool {
+	switch path[0] {
+	case tagsDir:
+		return len(path) >= 4 && path[len(path)-2] == filesDir && treeIndex(path) == -1
+	case queriesDir:
+		return len(path) >= 3
+	}
+
+	return false
+}
+
+// The name of the companion tags file for a file symbolic link.
+func tagsFileName(linkName string) string {
+	return tagsFilePrefix + linkName + tagsFileSuffix
+}
+
+// Formats the tags one per line, as 'tag' or 'tag=value'.
+func formatTagsFile(names []tagValueName) []byte {
+	buffer := new(bytes.Buffer)
+
+	for _, name := range names {
+		buffer.WriteString(escapeName(name.tagName, '='))
+
+		if name.valueName != "" {
+			buffer.WriteString("=" + escapeName(name.valueName))
+		}
+
+		buffer.WriteString("\n")
+	}
+
+	return buffer.Bytes()
+}
+
+// Parses the tags written one per line, ignoring blank lines.
+func parseTagsFile(data []byte) []tagValueName {
+	lines := strings.Split(string(data), "\n")
+	names := make([]tagValueName, 0, len(lines))
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name := parseTagValueName(line)
+		if !containsTagValueName(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (vfs FuseVfs) readTagsFile(fileId entities.FileId) ([]byte, fuse.Status) {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	file, err := vfs.visibleFile(tx, fileId)
+	if err != nil {
+		return nil, vfs.fail(err, "could not retrieve file '%v'", fileId)
+	}
+	if file == nil {
+		return nil, fuse.ENOENT
+	}
+
+	names, status := vfs.explicitTagValueNames(tx, fileId)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	return formatTagsFile(names), fuse.OK
+}
+
+func (vfs FuseVfs) getTagsFileAttr(fileId entities.FileId) (*fuse.Attr, fuse.Status) {
+	data, status := vfs.readTagsFile(fileId)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	var mode uint32 = 0644
+	if vfs.readOnly {
+		mode = 0444
+	}
+
+	modTime := vfs.cache.databaseModTime()
+	return &fuse.Attr{Mode: fuse.S_IFREG | mode, Nlink: 1, Size: uint64(len(data)), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
+}
+
+// Replaces the explicit tags of the file with those listed in the tags file
+// data.
+func (vfs FuseVfs) writeTagsFile(fileId entities.FileId, data []byte) fuse.Status {
+	names := parseTagsFile(data)
+
+	status := vfs.retry(func() fuse.Status {
+		return vfs.updateFileTags(fileId, func(tx *storage.Tx, current []tagValueName) ([]tagValueName, fuse.Status) {
+			return names, fuse.OK
+		})
+	})
+	if status != fuse.OK {
+		return status
+	}
+
+	vfs.cache.invalidate()
+
+	return fuse.OK
+}
+
+// Truncates the tags file to the specified size, replacing the file's tags
+// with those that remain.
+func (vfs FuseVfs) truncateTagsFile(fileId entities.FileId, size uint64) fuse.Status {
+	data, status := vfs.readTagsFile(fileId)
+	if status != fuse.OK {
+		return status
+	}
+
+	return vfs.writeTagsFile(fileId, resizeBuffer(data, size))
+}
+
+func (vfs FuseVfs) openTagsFile(fileId entities.FileId, truncate bool) (nodefs.File, fuse.Status) {
+	data, status := vfs.readTagsFile(fileId)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	if truncate {
+		return &tagsFile{File: nodefs.NewDefaultFile(), vfs: vfs, fileId: fileId, data: []byte{}, dirty: true}, fuse.OK
+	}
+
+	return &tagsFile{File: nodefs.NewDefaultFile(), vfs: vfs, fileId: fileId, data: data}, fuse.OK
+}
+
+// An open tags file. Writes are buffered and, when the file is flushed,
+// replace the file's explicit tags.
+type tagsFile struct {
+	nodefs.File
+
+	vfs    FuseVfs
+	fileId entities.FileId
+	mutex  sync.Mutex
+	data   []byte
+	dirty  bool
+}
+
+func (file *tagsFile) String() string {
+	return "tagsFile"
+}
+
+func (file *tagsFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	return readBuffer(file.data, dest, off), fuse.OK
+}
+
+func (file *tagsFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	file.data = writeBuffer(file.data, data, off)
+	file.dirty = true
+
+	return uint32(len(data)), fuse.OK
+}
+
+func (file *tagsFile) Truncate(size uint64) fuse.Status {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	file.data = resizeBuffer(file.data, size)
+	file.dirty = true
+
+	return fuse.OK
+}
+
+func (file *tagsFile) GetAttr(out *fuse.Attr) fuse.Status {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	modTime := file.vfs.cache.databaseModTime()
+	out.Mode = fuse.S_IFREG | 0644
+	if file.vfs.readOnly {
+		out.Mode = fuse.S_IFREG | 0444
+	}
+	out.Nlink = 1
+	out.Size = uint64(len(file.data))
+	out.Mtime = uint64(modTime.Unix())
+	out.Mtimensec = uint32(modTime.Nanosecond())
+
+	return fuse.OK
+}
+
+func (file *tagsFile) Flush() fuse.Status {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	if !file.dirty {
+		return fuse.OK
+	}
+
+	if status := file.vfs.writeTagsFile(file.fileId, file.data); status != fuse.OK {
+		return status
+	}
+
+	file.dirty = false
+
+	return fuse.OK
+}
+
+func (file *tagsFile) Fsync(flags int) fuse.Status {
+	return file.Flush()
+}
+
+// The files created alongside the tags files, such as those an editor writes
+// before renaming them over the tags file it is saving, keyed by path. They
+// are held in memory only.
+type scratchFiles struct {
+	sync.Mutex
+	files map[string]*scratchFile
+}
+
+func (scratch *scratchFiles) get(name string) *scratchFile {
+	scratch.Lock()
+	defer scratch.Unlock()
+
+	return scratch.files[name]
+}
+
+func (scratch *scratchFiles) put(name string, file *scratchFile) {
+	scratch.Lock()
+	defer scratch.Unlock()
+
+	scratch.files[name] = file
+}
+
+func (scratch *scratchFiles) remove(name string) *scratchFile {
+	scratch.Lock()
+	defer scratch.Unlock()
+
+	file := scratch.files[name]
+	delete(scratch.files, name)
+
+	return file
+}
+
+// Creates a scratch file at the specified path, which must be in a directory
+// that lists tags files. Creating a tags file opens it instead.
+func (vfs FuseVfs) createScratchFile(name string) (nodefs.File, fuse.Status) {
+	path := vfs.splitPath(name)
+
+	if fileId := vfs.tagsFileId(path); fileId != 0 {
+		return vfs.openTagsFile(fileId, true)
+	}
+
+	if !tagsFileDir(path) || vfs.entryFileId(name) != 0 {
+		return nil, fuse.EPERM
+	}
+
+	file := &scratchFile{File: nodefs.NewDefaultFile(), data: []byte{}}
+	vfs.scratch.put(name, file)
+
+	return file, fuse.OK
+}
+
+// Renames the scratch file over the tags file at the specified path, replacing
+// the tags of its file, or to another scratch file.
+func (vfs FuseVfs) renameScratchFile(file *scratchFile, oldName, newName string) fuse.Status {
+	newPath := vfs.splitPath(newName)
+
+	if fileId := vfs.tagsFileId(newPath); fileId != 0 {
+		file.mutex.Lock()
+		status := vfs.writeTagsFile(fileId, file.data)
+		file.mutex.Unlock()
+
+		if status != fuse.OK {
+			return status
+		}
+
+		vfs.scratch.remove(oldName)
+		return fuse.OK
+	}
+
+	if !tagsFileDir(newPath) || vfs.entryFileId(newName) != 0 {
+		return fuse.EPERM
+	}
+
+	vfs.scratch.remove(oldName)
+	vfs.scratch.put(newName, file)
+
+	return fuse.OK
+}
+
+// A scratch file, shared by all of its open handles.
+type scratchFile struct {
+	nodefs.File
+
+	mutex sync.Mutex
+	data  []byte
+}
+
+func (file *scratchFile) String() string {
+	return "scratchFile"
+}
+
+func (file *scratchFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	return readBuffer(file.data, dest, off), fuse.OK
+}
+
+func (file *scratchFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	file.data = writeBuffer(file.data, data, off)
+
+	return uint32(len(data)), fuse.OK
+}
+
+func (file *scratchFile) Truncate(size uint64) fuse.Status {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	file.data = resizeBuffer(file.data, size)
+
+	return fuse.OK
+}
+
+func (file *scratchFile) GetAttr(out *fuse.Attr) fuse.Status {
+	*out = *file.attr()
+	return fuse.OK
+}
+
+func (file *scratchFile) attr() *fuse.Attr {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	return &fuse.Attr{Mode: fuse.S_IFREG | 0644, Nlink: 1, Size: uint64(len(file.data))}
+}
+
+func readBuffer(buffer []byte, dest []byte, off int64) fuse.ReadResult {
+	if off >= int64(len(buffer)) {
+		return fuse.ReadResultData(nil)
+	}
+
+	end := off + int64(len(dest))
+	if end > int64(len(buffer)) {
+		end = int64(len(buffer))
+	}
+
+	return fuse.ReadResultData(buffer[off:end])
+}
+
+func writeBuffer(buffer []byte, data []byte, off int64) []byte {
+	if end := off + int64(len(data)); end > int64(len(buffer)) {
+		buffer = append(buffer, make([]byte, end-int64(len(buffer)))...)
+	}
+
+	copy(buffer[off:], data)
+
+	return buffer
+}
+
+func resizeBuffer(buffer []byte, size uint64) []byte {
+	if size > uint64(len(buffer)) {
+		return append(buffer, make([]byte, size-uint64(len(buffer)))...)
+	}
+
+	return buffer[:size]
+}
@@ -0,0 +1,124 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestTruncateTagsFile(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday", "year=2017")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	tagsFilePath := "tags/holiday/files/.photo.1.jpg.tags"
+
+	if status := vfs.Truncate(tagsFilePath, uint64(len("holiday\n")), nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if tags, expected := fileTags(test, store, file.Id), []string{"holiday"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+
+	handle, status := vfs.Open(tagsFilePath, syscall.O_RDWR, nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if _, status := handle.Write([]byte("beach\n"), 0); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if status := handle.Truncate(uint64(len("beach\n"))); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if status := handle.Flush(); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if tags, expected := fileTags(test, store, file.Id), []string{"beach"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+}
+
+func TestRenameOverTagsFile(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	tempPath := "tags/holiday/files/.photo.1.jpg.tags.swp"
+	tagsFilePath := "tags/holiday/files/.photo.1.jpg.tags"
+
+	handle, status := vfs.Create(tempPath, syscall.O_WRONLY, 0644, nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if _, status := handle.Write([]byte("holiday\nyear=2017\n"), 0); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if status := handle.Flush(); status != fuse.OK {
+		test.Fatal(status)
+	}
+
+	attr, status := vfs.GetAttr(tempPath, nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if attr.Size != uint64(len("holiday\nyear=2017\n")) {
+		test.Fatalf("Unexpected size %v.", attr.Size)
+	}
+	if tags, expected := fileTags(test, store, file.Id), []string{"holiday"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+
+	if status := vfs.Rename(tempPath, tagsFilePath, nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if tags, expected := fileTags(test, store, file.Id), []string{"holiday", "year=2017"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+	if _, status := vfs.GetAttr(tempPath, nil); status != fuse.ENOENT {
+		test.Fatalf("Expected %v but status was %v.", fuse.ENOENT, status)
+	}
+}
+
+func TestCreateOutsideFilesDirectory(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	if _, status := vfs.Create("tags/holiday/notes.txt", syscall.O_WRONLY, 0644, nil); status != fuse.EPERM {
+		test.Fatalf("Expected %v but status was %v.", fuse.EPERM, status)
+	}
+
+	vfs = newFuseVfs(store, "", true, nil)
+	if _, status := vfs.Create("tags/holiday/files/.photo.1.jpg.tags.swp", syscall.O_WRONLY, 0644, nil); status != fuse.EROFS {
+		test.Fatalf("Expected %v but status was %v.", fuse.EROFS, status)
+	}
+}
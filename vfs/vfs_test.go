@@ -0,0 +1,118 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// unexported
+
+func createStore(test *testing.T) (string, *storage.Storage) {
+	dir, err := ioutil.TempDir("", "tmsu-vfs")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "db")
+	if err := storage.CreateAt(path); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return dir, store
+}
+
+// Adds the file at path to the database with the specified tags, each either
+// 'tag' or 'tag=value'.
+func addFile(test *testing.T, store *storage.Storage, path string, tags ...string) *entities.File {
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.AddFile(tx, path, fingerprint.Fingerprint(path), "SHA256", time.Now(), 0, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	vfs := newFuseVfs(store, "", false, nil)
+	for _, tag := range tags {
+		pair, status := vfs.lookupTagValue(tx, parseTagValueName(tag))
+		if status != fuse.OK {
+			test.Fatalf("could not create tag '%v': %v", tag, status)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	return file
+}
+
+// The tags of the file, formatted as for 'tmsu tags'.
+func fileTags(test *testing.T, store *storage.Storage, fileId entities.FileId) []string {
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	fileTags, err := store.FileTagsByFileId(tx, fileId, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tags := make([]string, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tag, err := store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		name := tag.Name
+		if fileTag.ValueId != 0 {
+			value, err := store.Value(tx, fileTag.ValueId)
+			if err != nil {
+				test.Fatal(err)
+			}
+
+			name += "=" + value.Name
+		}
+
+		tags = append(tags, name)
+	}
+
+	sort.Strings(tags)
+
+	return tags
+}
@@ -0,0 +1,436 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"golang.org/x/net/webdav"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Creates an HTTP handler serving the hierarchy of the virtual filesystem over
+// WebDAV. As WebDAV has no symbolic links, the file symbolic links are served
+// as the files they link to whilst a file is tagged by uploading the path of
+// the file, as the target of a symbolic link would be, to a tag directory.
+// Only files within the allowed paths, or the database root if none are
+// specified, can be tagged or read.
+func NewWebDavHandler(store *storage.Storage, readOnly bool, where query.Expression, allowedPaths []string) http.Handler {
+	if len(allowedPaths) == 0 {
+		allowedPaths = []string{store.RootPath}
+	}
+
+	// the hierarchy is not mounted anywhere so relative link targets are
+	// resolved within the hierarchy itself
+	fileSystem := webDavFileSystem{newFuseVfs(store, "", readOnly, where), allowedPaths}
+
+	logger := func(request *http.Request, err error) {
+		if err != nil {
+			log.Infof(2, "%v %v: %v", request.Method, request.URL.Path, err)
+		}
+	}
+
+	return &webdav.Handler{FileSystem: fileSystem, LockSystem: webdav.NewMemLS(), Logger: logger}
+}
+
+type webDavFileSystem struct {
+	vfs          FuseVfs
+	allowedPaths []string
+}
+
+func (fileSystem webDavFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = webDavName(name)
+
+	if status := fileSystem.vfs.Mkdir(name, uint32(perm), nil); status != fuse.OK {
+		return webDavError("mkdir", name, status)
+	}
+
+	return nil
+}
+
+func (fileSystem webDavFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = webDavName(name)
+
+	attr, status := fileSystem.vfs.GetAttr(name, nil)
+	if status == fuse.ENOENT && flag&os.O_CREATE != 0 {
+		if fileSystem.vfs.readOnly {
+			return nil, webDavError("open", name, fuse.EROFS)
+		}
+
+		return &webDavLinkFile{fileSystem: fileSystem, name: name}, nil
+	}
+	if status != fuse.OK {
+		return nil, webDavError("open", name, status)
+	}
+
+	switch attr.Mode & syscall.S_IFMT {
+	case fuse.S_IFDIR:
+		entries, status := fileSystem.vfs.OpenDir(name, nil)
+		if status != fuse.OK {
+			return nil, webDavError("open", name, status)
+		}
+
+		return &webDavDir{fileSystem: fileSystem, name: name, entries: entries}, nil
+	case fuse.S_IFLNK:
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			// the content of tagged files cannot be changed
+			return nil, webDavError("open", name, fuse.EPERM)
+		}
+
+		target, status := fileSystem.vfs.linkTarget(name)
+		if status != fuse.OK {
+			return nil, webDavError("open", name, status)
+		}
+		if !fileSystem.allowed(target) {
+			return nil, webDavError("open", name, fuse.EACCES)
+		}
+
+		return os.Open(target)
+	}
+
+	file, status := fileSystem.vfs.Open(name, uint32(flag), nil)
+	if status != fuse.OK {
+		return nil, webDavError("open", name, status)
+	}
+
+	return &webDavDataFile{file: file, name: name}, nil
+}
+
+func (fileSystem webDavFileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = webDavName(name)
+
+	attr, status := fileSystem.vfs.GetAttr(name, nil)
+	if status != fuse.OK {
+		return webDavError("remove", name, status)
+	}
+
+	switch attr.Mode & syscall.S_IFMT {
+	case fuse.S_IFDIR:
+		status = fileSystem.vfs.Rmdir(name, nil)
+	case fuse.S_IFLNK:
+		status = fileSystem.vfs.Unlink(name, nil)
+	default:
+		status = fuse.EPERM
+	}
+
+	if status != fuse.OK {
+		return webDavError("remove", name, status)
+	}
+
+	return nil
+}
+
+func (fileSystem webDavFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldName = webDavName(oldName)
+	newName = webDavName(newName)
+
+	if status := fileSystem.vfs.Rename(oldName, newName, nil); status != fuse.OK {
+		return webDavError("rename", oldName, status)
+	}
+
+	return nil
+}
+
+func (fileSystem webDavFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return fileSystem.stat(webDavName(name))
+}
+
+func (fileSystem webDavFileSystem) stat(name string) (os.FileInfo, error) {
+	attr, status := fileSystem.vfs.GetAttr(name, nil)
+	if status != fuse.OK {
+		return nil, webDavError("stat", name, status)
+	}
+
+	info := attrFileInfo(path.Base("/"+name), attr)
+
+	if attr.Mode&syscall.S_IFMT == fuse.S_IFLNK {
+		target, status := fileSystem.vfs.linkTarget(name)
+		if status != fuse.OK {
+			return nil, webDavError("stat", name, status)
+		}
+
+		// a missing or disallowed file is shown as empty rather than hiding
+		// the entry
+		if !fileSystem.allowed(target) {
+			return info, nil
+		}
+		if targetInfo, err := os.Stat(target); err == nil {
+			info.size = targetInfo.Size()
+			info.mode = targetInfo.Mode()
+			info.modTime = targetInfo.ModTime()
+		}
+	}
+
+	return info, nil
+}
+
+// Determines whether the file at the specified path, once symbolic links are
+// resolved, is within one of the allowed paths.
+func (fileSystem webDavFileSystem) allowed(path string) bool {
+	return _path.Within(path, fileSystem.allowedPaths)
+}
+
+// A directory of the hierarchy.
+type webDavDir struct {
+	fileSystem webDavFileSystem
+	name       string
+	entries    []fuse.DirEntry
+	offset     int
+}
+
+func (dir *webDavDir) Close() error {
+	return nil
+}
+
+func (dir *webDavDir) Read(p []byte) (int, error) {
+	return 0, webDavError("read", dir.name, fuse.Status(syscall.EISDIR))
+}
+
+func (dir *webDavDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		dir.offset = 0
+		return 0, nil
+	}
+
+	return 0, webDavError("seek", dir.name, fuse.Status(syscall.EISDIR))
+}
+
+func (dir *webDavDir) Readdir(count int) ([]os.FileInfo, error) {
+	infos := make([]os.FileInfo, 0, len(dir.entries))
+
+	for ; dir.offset < len(dir.entries) && (count <= 0 || len(infos) < count); dir.offset++ {
+		info, err := dir.fileSystem.stat(filepath.Join(dir.name, dir.entries[dir.offset].Name))
+		if err != nil {
+			log.Infof(2, "%v: could not stat directory entry: %v", dir.name, err)
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	if count > 0 && len(infos) == 0 {
+		return nil, io.EOF
+	}
+
+	return infos, nil
+}
+
+func (dir *webDavDir) Stat() (os.FileInfo, error) {
+	return dir.fileSystem.stat(dir.name)
+}
+
+func (dir *webDavDir) Write(p []byte) (int, error) {
+	return 0, webDavError("write", dir.name, fuse.Status(syscall.EISDIR))
+}
+
+// A virtual file of the hierarchy, such as a '.tags' file.
+type webDavDataFile struct {
+	file   nodefs.File
+	name   string
+	offset int64
+}
+
+func (file *webDavDataFile) Close() error {
+	defer file.file.Release()
+
+	if status := file.file.Flush(); status != fuse.OK {
+		return webDavError("close", file.name, status)
+	}
+
+	return nil
+}
+
+func (file *webDavDataFile) Read(p []byte) (int, error) {
+	result, status := file.file.Read(p, file.offset)
+	if status != fuse.OK {
+		return 0, webDavError("read", file.name, status)
+	}
+
+	data, status := result.Bytes(p)
+	if status != fuse.OK {
+		return 0, webDavError("read", file.name, status)
+	}
+	if len(data) == 0 {
+		return 0, io.EOF
+	}
+
+	copied := copy(p, data)
+	file.offset += int64(copied)
+
+	return copied, nil
+}
+
+func (file *webDavDataFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		var attr fuse.Attr
+		if status := file.file.GetAttr(&attr); status != fuse.OK {
+			return 0, webDavError("seek", file.name, status)
+		}
+
+		offset += int64(attr.Size)
+	}
+
+	if offset < 0 {
+		return 0, webDavError("seek", file.name, fuse.EINVAL)
+	}
+
+	file.offset = offset
+	return offset, nil
+}
+
+func (file *webDavDataFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, webDavError("readdir", file.name, fuse.Status(syscall.ENOTDIR))
+}
+
+func (file *webDavDataFile) Stat() (os.FileInfo, error) {
+	var attr fuse.Attr
+	if status := file.file.GetAttr(&attr); status != fuse.OK {
+		return nil, webDavError("stat", file.name, status)
+	}
+
+	return attrFileInfo(path.Base("/"+file.name), &attr), nil
+}
+
+func (file *webDavDataFile) Write(p []byte) (int, error) {
+	written, status := file.file.Write(p, file.offset)
+	if status != fuse.OK {
+		return 0, webDavError("write", file.name, status)
+	}
+
+	file.offset += int64(written)
+	return int(written), nil
+}
+
+// A file being uploaded to a tag directory, the content of which is the path of
+// the file to tag. The file is tagged once the upload is complete.
+type webDavLinkFile struct {
+	fileSystem webDavFileSystem
+	name       string
+	content    bytes.Buffer
+}
+
+func (file *webDavLinkFile) Close() error {
+	target := strings.TrimSpace(file.content.String())
+	if target == "" {
+		return webDavError("symlink", file.name, fuse.EINVAL)
+	}
+
+	if filepath.IsAbs(target) {
+		if !file.fileSystem.allowed(target) {
+			return webDavError("symlink", file.name, fuse.EACCES)
+		}
+	} else {
+		// relative targets are resolved against the link's directory and must
+		// remain within the hierarchy, where they are already tagged
+		relPath := filepath.Join(filepath.Dir(file.name), target)
+		if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return webDavError("symlink", file.name, fuse.EACCES)
+		}
+	}
+
+	if status := file.fileSystem.vfs.Symlink(target, file.name, nil); status != fuse.OK {
+		return webDavError("symlink", file.name, status)
+	}
+
+	return nil
+}
+
+func (file *webDavLinkFile) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (file *webDavLinkFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (file *webDavLinkFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, webDavError("readdir", file.name, fuse.Status(syscall.ENOTDIR))
+}
+
+func (file *webDavLinkFile) Stat() (os.FileInfo, error) {
+	return &webDavFileInfo{name: path.Base("/" + file.name), size: int64(file.content.Len()), mode: 0644, modTime: time.Now()}, nil
+}
+
+func (file *webDavLinkFile) Write(p []byte) (int, error) {
+	return file.content.Write(p)
+}
+
+type webDavFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func attrFileInfo(name string, attr *fuse.Attr) *webDavFileInfo {
+	mode := os.FileMode(attr.Mode & 0777)
+	if attr.Mode&syscall.S_IFMT == fuse.S_IFDIR {
+		mode |= os.ModeDir
+	}
+
+	return &webDavFileInfo{name, int64(attr.Size), mode, time.Unix(int64(attr.Mtime), int64(attr.Mtimensec))}
+}
+
+func (info *webDavFileInfo) Name() string {
+	return info.name
+}
+
+func (info *webDavFileInfo) Size() int64 {
+	return info.size
+}
+
+func (info *webDavFileInfo) Mode() os.FileMode {
+	return info.mode
+}
+
+func (info *webDavFileInfo) ModTime() time.Time {
+	return info.modTime
+}
+
+func (info *webDavFileInfo) IsDir() bool {
+	return info.mode.IsDir()
+}
+
+func (info *webDavFileInfo) Sys() interface{} {
+	return nil
+}
+
+// Converts a WebDAV path to a path within the hierarchy.
+func webDavName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func webDavError(operation, name string, status fuse.Status) error {
+	return &os.PathError{Op: operation, Path: "/" + name, Err: syscall.Errno(status)}
+}
@@ -0,0 +1,289 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bytes"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strings"
+	"syscall"
+)
+
+// The extended attribute holding all of a file's (explicit) tags, formatted as
+// for 'tmsu tags'.
+const tagsXAttr = "user.tmsu.tags"
+
+// The prefix of the extended attributes, one per tag applied to a file,
+// holding the values applied for that tag.
+const tagXAttrPrefix = "user.tmsu.tag."
+
+// setxattr flags
+const (
+	xattrCreate  = 1
+	xattrReplace = 2
+)
+
+// Identifies the file whose extended attributes are served at the specified
+// path, returning zero if there are none. The attributes are served on each
+// file's companion tags file rather than its symbolic link, as Linux refuses
+// 'user.' attributes on symbolic links.
+func (vfs FuseVfs) xattrFileId(name string) entities.FileId {
+	return vfs.tagsFileId(vfs.splitPath(name))
+}
+
+func (vfs FuseVfs) getFileXAttr(fileId entities.FileId, attr string) ([]byte, fuse.Status) {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	names, status := vfs.explicitTagValueNames(tx, fileId)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	switch {
+	case attr == tagsXAttr:
+		return []byte(formatTagValueNames(names)), fuse.OK
+	case strings.HasPrefix(attr, tagXAttrPrefix):
+		tagName := attr[len(tagXAttrPrefix):]
+
+		valueNames := make([]string, 0, 1)
+		found := false
+		for _, name := range names {
+			if name.tagName == tagName {
+				found = true
+
+				if name.valueName != "" {
+					valueNames = append(valueNames, escapeName(name.valueName, ' '))
+				}
+			}
+		}
+
+		if !found {
+			return nil, fuse.ENOATTR
+		}
+
+		return []byte(strings.Join(valueNames, " ")), fuse.OK
+	}
+
+	return nil, fuse.ENOATTR
+}
+
+func (vfs FuseVfs) listFileXAttrs(fileId entities.FileId) ([]string, fuse.Status) {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return nil, status
+	}
+	defer tx.Commit()
+
+	names, status := vfs.explicitTagValueNames(tx, fileId)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	attrs := []string{tagsXAttr}
+
+	for _, name := range names {
+		attr := tagXAttrPrefix + name.tagName
+
+		if attrs[len(attrs)-1] != attr {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	return attrs, fuse.OK
+}
+
+func (vfs FuseVfs) setFileXAttr(fileId entities.FileId, attr string, data []byte, flags int) fuse.Status {
+	return vfs.updateFileTags(fileId, func(tx *storage.Tx, names []tagValueName) ([]tagValueName, fuse.Status) {
+		switch {
+		case attr == tagsXAttr:
+			if flags&xattrCreate != 0 {
+				return nil, fuse.Status(syscall.EEXIST)
+			}
+
+			return parseTagValueNames(string(data)), fuse.OK
+		case strings.HasPrefix(attr, tagXAttrPrefix):
+			tagName := attr[len(tagXAttrPrefix):]
+			if tagName == "" {
+				return nil, fuse.EINVAL
+			}
+
+			updated, found := withoutTag(names, tagName)
+			if found && flags&xattrCreate != 0 {
+				return nil, fuse.Status(syscall.EEXIST)
+			}
+			if !found && flags&xattrReplace != 0 {
+				return nil, fuse.ENOATTR
+			}
+
+			valueNames := parseValueNames(string(data))
+			if len(valueNames) == 0 {
+				valueNames = []string{""}
+			}
+
+			for _, valueName := range valueNames {
+				updated = append(updated, tagValueName{tagName, valueName})
+			}
+
+			return updated, fuse.OK
+		}
+
+		return nil, fuse.Status(syscall.ENOTSUP)
+	})
+}
+
+func (vfs FuseVfs) removeFileXAttr(fileId entities.FileId, attr string) fuse.Status {
+	return vfs.updateFileTags(fileId, func(tx *storage.Tx, names []tagValueName) ([]tagValueName, fuse.Status) {
+		switch {
+		case attr == tagsXAttr:
+			return []tagValueName{}, fuse.OK
+		case strings.HasPrefix(attr, tagXAttrPrefix):
+			updated, found := withoutTag(names, attr[len(tagXAttrPrefix):])
+			if !found {
+				return nil, fuse.ENOATTR
+			}
+
+			return updated, fuse.OK
+		}
+
+		return nil, fuse.ENOATTR
+	})
+}
+
+// Replaces the file's explicit tags with those returned by the update
+// function, within a transaction that is rolled back should it fail.
+func (vfs FuseVfs) updateFileTags(fileId entities.FileId, update func(*storage.Tx, []tagValueName) ([]tagValueName, fuse.Status)) fuse.Status {
+	tx, status := vfs.begin()
+	if status != fuse.OK {
+		return status
+	}
+
+	status = vfs.updateFileTagsInTx(tx, fileId, update)
+	if status != fuse.OK {
+		tx.Rollback()
+		return status
+	}
+
+	return vfs.commit(tx)
+}
+
+func (vfs FuseVfs) updateFileTagsInTx(tx *storage.Tx, fileId entities.FileId, update func(*storage.Tx, []tagValueName) ([]tagValueName, fuse.Status)) fuse.Status {
+	file, err := vfs.visibleFile(tx, fileId)
+	if err != nil {
+		return vfs.fail(err, "could not retrieve file '%v'", fileId)
+	}
+	if file == nil {
+		return fuse.ENOENT
+	}
+
+	current, status := vfs.explicitTagValueNames(tx, fileId)
+	if status != fuse.OK {
+		return status
+	}
+
+	updated, status := update(tx, current)
+	if status != fuse.OK {
+		return status
+	}
+
+	add := make(entities.TagIdValueIdPairs, 0, len(updated))
+	for _, name := range updated {
+		pair, status := vfs.lookupTagValue(tx, name)
+		if status != fuse.OK {
+			return status
+		}
+
+		add = append(add, pair)
+	}
+
+	remove := make(entities.TagIdValueIdPairs, 0, len(current))
+	for _, name := range current {
+		if containsTagValueName(updated, name) {
+			continue
+		}
+
+		pair, status := vfs.lookupTagValue(tx, name)
+		if status != fuse.OK {
+			return status
+		}
+
+		remove = append(remove, pair)
+	}
+
+	return vfs.retagFile(tx, fileId, add, remove)
+}
+
+func withoutTag(names []tagValueName, tagName string) ([]tagValueName, bool) {
+	without := make([]tagValueName, 0, len(names))
+	found := false
+
+	for _, name := range names {
+		if name.tagName == tagName {
+			found = true
+			continue
+		}
+
+		without = append(without, name)
+	}
+
+	return without, found
+}
+
+func containsTagValueName(names []tagValueName, searchName tagValueName) bool {
+	for _, name := range names {
+		if name == searchName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parses the space separated value names of a per-tag extended attribute.
+func parseValueNames(values string) []string {
+	words := text.Tokenize(values)
+
+	for index, word := range words {
+		words[index] = unescapeName(word)
+	}
+
+	return words
+}
+
+func unescapeName(name string) string {
+	buffer := new(bytes.Buffer)
+	var escaped bool
+
+	for _, r := range name {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+
+		buffer.WriteRune(r)
+		escaped = false
+	}
+
+	return buffer.String()
+}
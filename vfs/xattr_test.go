@@ -0,0 +1,91 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTagsFileXAttrs(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday", "colour=dark red")
+	vfs := newFuseVfs(store, "", false, nil)
+
+	linkPath := "tags/holiday/files/photo.1.jpg"
+	tagsFilePath := "tags/holiday/files/.photo.1.jpg.tags"
+
+	if _, status := vfs.GetXAttr(linkPath, tagsXAttr, nil); status != fuse.ENOATTR {
+		test.Fatalf("Expected no attributes on the symbolic link but status was %v.", status)
+	}
+
+	attrs, status := vfs.ListXAttr(tagsFilePath, nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if expected := []string{tagsXAttr, tagXAttrPrefix + "colour", tagXAttrPrefix + "holiday"}; !reflect.DeepEqual(attrs, expected) {
+		test.Fatalf("Expected attributes %v but were %v.", expected, attrs)
+	}
+
+	data, status := vfs.GetXAttr(tagsFilePath, tagsXAttr, nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if string(data) != `colour=dark\ red holiday` {
+		test.Fatalf("Unexpected tags attribute '%v'.", string(data))
+	}
+
+	if status := vfs.SetXAttr(tagsFilePath, tagXAttrPrefix+"year", []byte("2017"), 0, nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+	if status := vfs.RemoveXAttr(tagsFilePath, tagXAttrPrefix+"colour", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+
+	if tags, expected := fileTags(test, store, file.Id), []string{"holiday", "year=2017"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+}
+
+func TestReadOnlyXAttrs(test *testing.T) {
+	dir, store := createStore(test)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	file := addFile(test, store, filepath.Join(dir, "photo.jpg"), "holiday")
+	vfs := newFuseVfs(store, "", true, nil)
+
+	tagsFilePath := "tags/holiday/files/.photo.1.jpg.tags"
+
+	if status := vfs.SetXAttr(tagsFilePath, tagXAttrPrefix+"year", []byte("2017"), 0, nil); status != fuse.EROFS {
+		test.Fatalf("Expected %v but status was %v.", fuse.EROFS, status)
+	}
+	if status := vfs.RemoveXAttr(tagsFilePath, tagXAttrPrefix+"holiday", nil); status != fuse.EROFS {
+		test.Fatalf("Expected %v but status was %v.", fuse.EROFS, status)
+	}
+
+	if tags, expected := fileTags(test, store, file.Id), []string{"holiday"}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v.", expected, tags)
+	}
+}